@@ -1,12 +1,23 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"flag"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
 	"path/filepath"
+	"sync/internal/api"
 	"sync/internal/config"
 	"sync/internal/service"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
@@ -17,17 +28,226 @@ func main() {
 		log.Fatal("加载配置失败:", err)
 	}
 
-	syncService, err := service.NewSyncService(cfg)
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		os.Exit(runDiff(cfg, os.Args[2:]))
+	}
+
+	dryRun := flag.Bool("dry-run", false, "执行一轮完整的同步流程但不写入，输出每张表本应执行的变更")
+	dryRunSQL := flag.String("dry-run-sql", "", "dry-run 时把本应执行的 SQL 写入该文件")
+	flag.Parse()
+	if *dryRun {
+		os.Exit(runDryRun(cfg, *dryRunSQL))
+	}
+
+	// 配置了多个目标库（源库）时每个库独立同步
+	syncService, err := service.NewSyncGroup(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
 	syncService.RegisterObserver(&service.LogObserver{})
+	syncService.RegisterObserver(service.NewMetricsObserver(prometheus.DefaultRegisterer))
+
+	// 启动管理接口
+	server := api.NewServer(cfg.Server, syncService, promhttp.Handler())
+	go func() {
+		log.Printf("管理接口监听 %s", server.Addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal("管理接口启动失败:", err)
+		}
+	}()
+
+	// 收到 SIGINT/SIGTERM 后不再开始新的同步，进行中的批次在宽限期内提交或回滚
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	// 启动同步服务
-	ctx := context.Background()
+	done := make(chan error, 1)
+	go func() {
+		done <- syncService.StartSync(ctx)
+	}()
 	fmt.Println("mysql-sync 启动成功 🚗🚀")
-	if err := syncService.StartSync(ctx); err != nil {
-		log.Fatal(err)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			log.Fatal(err)
+		}
+	case <-ctx.Done():
+		gracePeriod := time.Duration(cfg.Server.ShutdownTimeout) * time.Second
+		log.Printf("收到退出信号，等待进行中的批次完成，最长 %v", gracePeriod)
+
+		select {
+		case err := <-done:
+			if err != nil {
+				log.Printf("同步服务退出: %v", err)
+			}
+		case <-time.After(gracePeriod):
+			log.Printf("等待超时，取消进行中的数据库操作")
+			syncService.Stop()
+			<-done
+		}
+	}
+	syncService.Stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("关闭管理接口失败: %v", err)
+	}
+	log.Println("mysql-sync 已退出")
+}
+
+// runDiff 逐行比较一对表，列出目标表缺少、多出和不一致的行：
+//
+//	sync-tool diff -table user [-source ustgz] [-target backup] [-sql repair.sql] [-apply]
+//
+// 退出码：0 两边一致或已修复，1 存在差异，2 出错
+func runDiff(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	table := flags.String("table", "", "要比较的源表，必须在 table_pairs 中")
+	source := flags.String("source", "", "要比较的源库，配置了 database.sources 时必填")
+	target := flags.String("target", "", "要比较的目标库，配置了 database.targets 时必填")
+	sqlFile := flags.String("sql", "", "把修复语句写入该文件")
+	apply := flags.Bool("apply", false, "直接在目标表上修复差异")
+	_ = flags.Parse(args)
+
+	if len(cfg.Database.Sources) > 0 {
+		sourceCfg, err := cfg.ForSource(*source)
+		if err != nil {
+			log.Printf("配置了多个源库，请用 -source 指定: %v", err)
+			return 2
+		}
+		cfg = sourceCfg
+	}
+	if len(cfg.Database.Targets) > 0 {
+		targetCfg, err := cfg.ForTarget(*target)
+		if err != nil {
+			log.Printf("配置了多个目标库，请用 -target 指定: %v", err)
+			return 2
+		}
+		cfg = targetCfg
 	}
 
+	var pair *config.TablePair
+	for i := range cfg.Sync.TablePairs {
+		if cfg.Sync.TablePairs[i].Source == *table {
+			pair = &cfg.Sync.TablePairs[i]
+		}
+	}
+	if pair == nil {
+		log.Printf("table_pairs 中没有源表 %q", *table)
+		return 2
+	}
+
+	syncService, err := service.NewSyncService(cfg)
+	if err != nil {
+		log.Print(err)
+		return 2
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		syncService.Stop()
+	}()
+
+	opts := service.DiffOptions{
+		Apply:  *apply,
+		Report: func(diff service.RowDiff) { fmt.Println(diff) },
+	}
+	var repair *bufio.Writer
+	if *sqlFile != "" {
+		file, err := os.Create(*sqlFile)
+		if err != nil {
+			log.Printf("创建修复语句文件失败: %v", err)
+			return 2
+		}
+		defer file.Close()
+		repair = bufio.NewWriter(file)
+		fmt.Fprintf(repair, "-- %s -> %s 的修复语句，生成于 %s\n", pair.Source, pair.Target, time.Now().Format(time.RFC3339))
+		opts.RepairSQL = repair
+	}
+
+	summary, err := syncService.DiffTable(*pair, opts)
+	if repair != nil {
+		if flushErr := repair.Flush(); flushErr != nil && err == nil {
+			err = fmt.Errorf("写入修复语句失败: %w", flushErr)
+		}
+	}
+	if err != nil {
+		log.Printf("比较表 %s 失败: %v", pair.Source, err)
+		return 2
+	}
+
+	log.Printf("表 %s -> %s: 源表 %d 行，目标表缺少 %d 行，多出 %d 行，不一致 %d 行",
+		pair.Source, pair.Target, summary.SourceRows, summary.Missing, summary.Extra, summary.Changed)
+	if summary.Differences() > 0 && !*apply {
+		return 1
+	}
+	return 0
+}
+
+// runDryRun 对所有表执行一轮同步流程但不写入，输出每张表本应执行的 DDL、新增、修改、删除的行数和示例主键：
+//
+//	sync-tool -dry-run [-dry-run-sql changes.sql]
+//
+// 退出码：0 没有需要执行的变更，1 存在变更，2 出错
+func runDryRun(cfg *config.Config, sqlFile string) int {
+	group, err := service.NewSyncGroup(cfg)
+	if err != nil {
+		log.Print(err)
+		return 2
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		group.Stop()
+	}()
+
+	var changes *bufio.Writer
+	if sqlFile != "" {
+		file, err := os.Create(sqlFile)
+		if err != nil {
+			log.Printf("创建 SQL 文件失败: %v", err)
+			return 2
+		}
+		defer file.Close()
+		changes = bufio.NewWriter(file)
+		fmt.Fprintf(changes, "-- dry-run 本应执行的语句，生成于 %s\n", time.Now().Format(time.RFC3339))
+	}
+
+	var reports []service.DryRunReport
+	if changes != nil {
+		reports, err = group.DryRun(changes)
+		if flushErr := changes.Flush(); flushErr != nil && err == nil {
+			err = fmt.Errorf("写入 SQL 文件失败: %w", flushErr)
+		}
+	} else {
+		reports, err = group.DryRun(nil)
+	}
+
+	pending, failed := 0, 0
+	for _, report := range reports {
+		fmt.Println(report)
+		if report.Pending() {
+			pending++
+		}
+		if report.Err != nil {
+			failed++
+		}
+	}
+	if err != nil {
+		log.Printf("dry-run 失败: %v", err)
+		return 2
+	}
+
+	log.Printf("dry-run 完成: %d 张表，%d 张表有变更，%d 张表出错", len(reports), pending, failed)
+	switch {
+	case failed > 0:
+		return 2
+	case pending > 0:
+		return 1
+	}
+	return 0
 }
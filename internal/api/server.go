@@ -0,0 +1,140 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync/internal/config"
+	"sync/internal/service"
+	"time"
+)
+
+// SyncService 管理接口依赖的同步服务操作
+type SyncService interface {
+	Tasks() []service.TaskStatus
+	TriggerSync(sourceTable string) error
+	PauseTask(sourceTable string) error
+	ResumeTask(sourceTable string) error
+	Config() config.Config
+}
+
+// NewServer 创建监听 server.host:server.port 的管理接口
+//
+//	GET  /healthz                    存活检查
+//	GET  /api/tasks                  所有同步任务的状态
+//	POST /api/tasks/{table}/sync     立即同步一张表
+//	POST /api/tasks/{table}/pause    暂停一张表
+//	POST /api/tasks/{table}/resume   恢复一张表
+//	GET  /api/config                 生效的配置（密码已脱敏）
+//	GET  /metrics                    Prometheus 指标（metrics 不为空时）
+func NewServer(cfg config.ServerConfig, svc SyncService, metrics http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Handler:           NewHandler(svc, metrics),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+// NewHandler 返回管理接口的路由
+func NewHandler(svc SyncService, metrics http.Handler) http.Handler {
+	h := &handler{svc: svc}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", h.healthz)
+	mux.HandleFunc("/api/tasks", h.listTasks)
+	mux.HandleFunc("/api/tasks/", h.taskAction)
+	mux.HandleFunc("/api/config", h.getConfig)
+	if metrics != nil {
+		mux.Handle("/metrics", metrics)
+	}
+	return mux
+}
+
+type handler struct {
+	svc SyncService
+}
+
+func (h *handler) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (h *handler) listTasks(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, h.svc.Tasks())
+}
+
+// taskAction 处理 /api/tasks/{table}/{action}
+func (h *handler) taskAction(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/tasks/"), "/")
+	if len(parts) != 2 || parts[0] == "" {
+		writeError(w, http.StatusNotFound, errors.New("路径应为 /api/tasks/{table}/{sync|pause|resume}"))
+		return
+	}
+	table, action := parts[0], parts[1]
+
+	var err error
+	switch action {
+	case "sync":
+		err = h.svc.TriggerSync(table)
+	case "pause":
+		err = h.svc.PauseTask(table)
+	case "resume":
+		err = h.svc.ResumeTask(table)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("不支持的操作: %s", action))
+		return
+	}
+
+	switch {
+	case err == nil:
+		log.Printf("管理接口: 表 %s 执行 %s", table, action)
+		status := http.StatusOK
+		if action == "sync" {
+			status = http.StatusAccepted
+		}
+		writeJSON(w, status, map[string]string{"table": table, "action": action})
+	case errors.Is(err, service.ErrTaskNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, service.ErrTaskRunning), errors.Is(err, service.ErrTaskPaused), errors.Is(err, service.ErrNotSupported),
+		errors.Is(err, service.ErrStopping):
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func (h *handler) getConfig(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, h.svc.Config())
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("不支持的请求方法: %s", r.Method))
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("管理接口: 写入响应失败: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/internal/config"
+	"sync/internal/service"
+	"testing"
+)
+
+type fakeService struct {
+	calls []string
+	err   error
+}
+
+func (f *fakeService) Tasks() []service.TaskStatus {
+	return []service.TaskStatus{{SourceTable: "user", TargetTable: "user", Status: "completed"}}
+}
+
+func (f *fakeService) TriggerSync(table string) error {
+	f.calls = append(f.calls, "sync "+table)
+	return f.err
+}
+
+func (f *fakeService) PauseTask(table string) error {
+	f.calls = append(f.calls, "pause "+table)
+	return f.err
+}
+
+func (f *fakeService) ResumeTask(table string) error {
+	f.calls = append(f.calls, "resume "+table)
+	return f.err
+}
+
+func (f *fakeService) Config() config.Config {
+	cfg := config.Config{}
+	cfg.Database.Source.Password = "******"
+	return cfg
+}
+
+func TestHandler(t *testing.T) {
+	cases := []struct {
+		method, path string
+		err          error
+		status       int
+		call         string
+	}{
+		{http.MethodGet, "/api/tasks", nil, http.StatusOK, ""},
+		{http.MethodPost, "/api/tasks", nil, http.StatusMethodNotAllowed, ""},
+		{http.MethodPost, "/api/tasks/user/sync", nil, http.StatusAccepted, "sync user"},
+		{http.MethodPost, "/api/tasks/user/sync", service.ErrTaskRunning, http.StatusConflict, "sync user"},
+		{http.MethodPost, "/api/tasks/user/pause", nil, http.StatusOK, "pause user"},
+		{http.MethodPost, "/api/tasks/missing/resume", service.ErrTaskNotFound, http.StatusNotFound, "resume missing"},
+		{http.MethodPost, "/api/tasks/user/drop", nil, http.StatusNotFound, ""},
+		{http.MethodGet, "/api/tasks/user/sync", nil, http.StatusMethodNotAllowed, ""},
+		{http.MethodGet, "/api/config", nil, http.StatusOK, ""},
+	}
+
+	for _, c := range cases {
+		svc := &fakeService{err: c.err}
+		rec := httptest.NewRecorder()
+		NewHandler(svc, nil).ServeHTTP(rec, httptest.NewRequest(c.method, c.path, nil))
+
+		if rec.Code != c.status {
+			t.Errorf("%s %s 状态码为 %d，期望 %d: %s", c.method, c.path, rec.Code, c.status, rec.Body.String())
+		}
+		if got := strings.Join(svc.calls, ","); got != c.call {
+			t.Errorf("%s %s 调用了 %q，期望 %q", c.method, c.path, got, c.call)
+		}
+	}
+}
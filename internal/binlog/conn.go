@@ -0,0 +1,392 @@
+package binlog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// MySQL 协议常量（只保留复制连接需要的部分）
+const (
+	clientLongPassword               = 0x00000001
+	clientLongFlag                   = 0x00000004
+	clientProtocol41                 = 0x00000200
+	clientTransactions               = 0x00002000
+	clientSecureConnection           = 0x00008000
+	clientMultiResults               = 0x00020000
+	clientPluginAuth                 = 0x00080000
+	clientPluginAuthLenencClientData = 0x00200000
+
+	comQuery          = 0x03
+	comBinlogDump     = 0x12
+	comRegisterSlave  = 0x15
+	comBinlogDumpGTID = 0x1e
+	binlogThroughGTID = 0x04
+	maxPacketSize     = 1<<24 - 1
+	charsetUTF8MB4    = 45
+	pluginNative      = "mysql_native_password"
+	pluginCachingSHA2 = "caching_sha2_password"
+)
+
+// ServerError 服务端返回的 ERR 包
+type ServerError struct {
+	Code    uint16
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("mysql error %d: %s", e.Code, e.Message)
+}
+
+// conn 最小化的 MySQL 客户端连接，只实现复制所需的握手、COM_QUERY、COM_BINLOG_DUMP 和 COM_BINLOG_DUMP_GTID
+type conn struct {
+	netConn net.Conn
+	reader  *bufio.Reader
+	seq     uint8
+	timeout time.Duration
+}
+
+func dial(addr, user, password string, timeout time.Duration) (*conn, error) {
+	nc, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("连接 %s 失败: %w", addr, err)
+	}
+
+	c := &conn{netConn: nc, reader: bufio.NewReaderSize(nc, 64*1024), timeout: timeout}
+	if err := c.handshake(user, password); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *conn) Close() error {
+	return c.netConn.Close()
+}
+
+// readPacket 读取一个完整的逻辑包（自动拼接超过 16MB 的分片）
+func (c *conn) readPacket() ([]byte, error) {
+	var payload []byte
+	for {
+		if c.timeout > 0 {
+			c.netConn.SetReadDeadline(time.Now().Add(c.timeout))
+		}
+
+		var header [4]byte
+		if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+			return nil, err
+		}
+		length := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+		c.seq = header[3] + 1
+
+		chunk := make([]byte, length)
+		if _, err := io.ReadFull(c.reader, chunk); err != nil {
+			return nil, err
+		}
+		payload = append(payload, chunk...)
+
+		if length < maxPacketSize {
+			return payload, nil
+		}
+	}
+}
+
+func (c *conn) writePacket(data []byte) error {
+	if c.timeout > 0 {
+		c.netConn.SetWriteDeadline(time.Now().Add(c.timeout))
+	}
+
+	pkt := make([]byte, 4+len(data))
+	pkt[0] = byte(len(data))
+	pkt[1] = byte(len(data) >> 8)
+	pkt[2] = byte(len(data) >> 16)
+	pkt[3] = c.seq
+	copy(pkt[4:], data)
+
+	if _, err := c.netConn.Write(pkt); err != nil {
+		return err
+	}
+	c.seq++
+	return nil
+}
+
+func (c *conn) writeCommand(cmd byte, payload []byte) error {
+	c.seq = 0
+	return c.writePacket(append([]byte{cmd}, payload...))
+}
+
+// handshake 完成 HandshakeV10 + HandshakeResponse41 以及后续的认证切换
+func (c *conn) handshake(user, password string) error {
+	data, err := c.readPacket()
+	if err != nil {
+		return fmt.Errorf("读取握手包失败: %w", err)
+	}
+	if data[0] == 0xff {
+		return parseServerError(data)
+	}
+	if data[0] != 10 {
+		return fmt.Errorf("不支持的协议版本: %d", data[0])
+	}
+
+	pos := 1 + bytes.IndexByte(data[1:], 0x00) + 1 // server version
+	pos += 4                                       // connection id
+	scramble := append([]byte{}, data[pos:pos+8]...)
+	pos += 8 + 1 // auth-plugin-data-part-1 + filler
+	capabilities := uint32(binary.LittleEndian.Uint16(data[pos:]))
+	pos += 2
+
+	plugin := pluginNative
+	if len(data) > pos {
+		pos += 1 + 2 // charset + status
+		capabilities |= uint32(binary.LittleEndian.Uint16(data[pos:])) << 16
+		pos += 2
+		authLen := int(data[pos])
+		pos += 1 + 10
+
+		if capabilities&clientSecureConnection != 0 {
+			n := authLen - 8
+			if n < 13 {
+				n = 13
+			}
+			scramble = append(scramble, data[pos:pos+n-1]...) // 去掉末尾的 0x00
+			pos += n
+		}
+		if capabilities&clientPluginAuth != 0 && pos < len(data) {
+			end := bytes.IndexByte(data[pos:], 0x00)
+			if end < 0 {
+				plugin = string(data[pos:])
+			} else {
+				plugin = string(data[pos : pos+end])
+			}
+		}
+	}
+
+	authResp, err := scramblePassword(plugin, password, scramble)
+	if err != nil {
+		return err
+	}
+
+	flags := uint32(clientLongPassword | clientLongFlag | clientProtocol41 | clientTransactions |
+		clientSecureConnection | clientMultiResults | clientPluginAuth | clientPluginAuthLenencClientData)
+
+	resp := make([]byte, 0, 64+len(user)+len(authResp))
+	resp = binary.LittleEndian.AppendUint32(resp, flags)
+	resp = binary.LittleEndian.AppendUint32(resp, maxPacketSize)
+	resp = append(resp, charsetUTF8MB4)
+	resp = append(resp, make([]byte, 23)...)
+	resp = append(resp, user...)
+	resp = append(resp, 0x00)
+	resp = appendLengthEncodedInt(resp, uint64(len(authResp)))
+	resp = append(resp, authResp...)
+	resp = append(resp, plugin...)
+	resp = append(resp, 0x00)
+
+	if err := c.writePacket(resp); err != nil {
+		return fmt.Errorf("发送握手响应失败: %w", err)
+	}
+
+	return c.readAuthResult(plugin, password, scramble)
+}
+
+func (c *conn) readAuthResult(plugin, password string, scramble []byte) error {
+	for {
+		data, err := c.readPacket()
+		if err != nil {
+			return fmt.Errorf("读取认证结果失败: %w", err)
+		}
+
+		switch data[0] {
+		case 0x00:
+			return nil
+		case 0xff:
+			return parseServerError(data)
+		case 0xfe:
+			// AuthSwitchRequest：服务端要求换一种认证插件
+			end := bytes.IndexByte(data[1:], 0x00)
+			if end < 0 {
+				return errors.New("非法的 AuthSwitchRequest 包")
+			}
+			plugin = string(data[1 : 1+end])
+			scramble = bytes.TrimRight(data[2+end:], "\x00")
+
+			authResp, err := scramblePassword(plugin, password, scramble)
+			if err != nil {
+				return err
+			}
+			if err := c.writePacket(authResp); err != nil {
+				return err
+			}
+		case 0x01:
+			if plugin != pluginCachingSHA2 || len(data) < 2 {
+				return fmt.Errorf("认证插件 %s 返回了无法处理的数据", plugin)
+			}
+			switch data[1] {
+			case 0x03:
+				// fast auth 成功，继续读取 OK 包
+			case 0x04:
+				// full auth：非 TLS 连接需要用服务端公钥加密密码
+				if err := c.writePacket([]byte{0x02}); err != nil {
+					return err
+				}
+				keyData, err := c.readPacket()
+				if err != nil {
+					return fmt.Errorf("读取服务端公钥失败: %w", err)
+				}
+				enc, err := encryptPassword(password, scramble, keyData[1:])
+				if err != nil {
+					return err
+				}
+				if err := c.writePacket(enc); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("未知的 caching_sha2_password 状态: %d", data[1])
+			}
+		default:
+			return fmt.Errorf("未知的认证响应: 0x%02x", data[0])
+		}
+	}
+}
+
+// exec 执行一条语句并丢弃可能返回的结果集
+func (c *conn) exec(query string) error {
+	if err := c.writeCommand(comQuery, []byte(query)); err != nil {
+		return err
+	}
+
+	data, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	switch data[0] {
+	case 0x00:
+		return nil
+	case 0xff:
+		return parseServerError(data)
+	}
+
+	// 结果集：列定义 + EOF + 行 + EOF
+	for eofs := 0; eofs < 2; {
+		data, err = c.readPacket()
+		if err != nil {
+			return err
+		}
+		if data[0] == 0xff {
+			return parseServerError(data)
+		}
+		if data[0] == 0xfe && len(data) < 9 {
+			eofs++
+		}
+	}
+	return nil
+}
+
+func parseServerError(data []byte) error {
+	if len(data) < 3 {
+		return &ServerError{Message: "unknown error"}
+	}
+	e := &ServerError{Code: binary.LittleEndian.Uint16(data[1:3])}
+	msg := data[3:]
+	if len(msg) > 0 && msg[0] == '#' && len(msg) >= 6 {
+		msg = msg[6:]
+	}
+	e.Message = string(msg)
+	return e
+}
+
+func scramblePassword(plugin, password string, scramble []byte) ([]byte, error) {
+	if password == "" {
+		return nil, nil
+	}
+
+	switch plugin {
+	case pluginNative:
+		// SHA1(password) XOR SHA1(scramble + SHA1(SHA1(password)))
+		h := sha1.Sum([]byte(password))
+		hh := sha1.Sum(h[:])
+		s := sha1.New()
+		s.Write(scramble[:20])
+		s.Write(hh[:])
+		out := s.Sum(nil)
+		for i := range out {
+			out[i] ^= h[i]
+		}
+		return out, nil
+	case pluginCachingSHA2:
+		// SHA256(password) XOR SHA256(SHA256(SHA256(password)) + scramble)
+		h := sha256.Sum256([]byte(password))
+		hh := sha256.Sum256(h[:])
+		s := sha256.New()
+		s.Write(hh[:])
+		s.Write(scramble)
+		out := s.Sum(nil)
+		for i := range out {
+			out[i] ^= h[i]
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("不支持的认证插件: %s", plugin)
+	}
+}
+
+func encryptPassword(password string, scramble, pemData []byte) ([]byte, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New("无法解析服务端公钥")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("无法解析服务端公钥: %w", err)
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("服务端公钥不是 RSA 公钥")
+	}
+
+	plain := append([]byte(password), 0x00)
+	for i := range plain {
+		plain[i] ^= scramble[i%len(scramble)]
+	}
+	return rsa.EncryptOAEP(sha1.New(), rand.Reader, rsaPub, plain, nil)
+}
+
+func appendLengthEncodedInt(b []byte, n uint64) []byte {
+	switch {
+	case n < 251:
+		return append(b, byte(n))
+	case n < 1<<16:
+		return append(b, 0xfc, byte(n), byte(n>>8))
+	case n < 1<<24:
+		return append(b, 0xfd, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		return binary.LittleEndian.AppendUint64(append(b, 0xfe), n)
+	}
+}
+
+// readLengthEncodedInt 返回值和占用的字节数
+func readLengthEncodedInt(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	switch b[0] {
+	case 0xfc:
+		return uint64(b[1]) | uint64(b[2])<<8, 3
+	case 0xfd:
+		return uint64(b[1]) | uint64(b[2])<<8 | uint64(b[3])<<16, 4
+	case 0xfe:
+		return binary.LittleEndian.Uint64(b[1:9]), 9
+	default:
+		return uint64(b[0]), 1
+	}
+}
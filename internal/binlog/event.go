@@ -0,0 +1,907 @@
+package binlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// binlog 事件类型
+const (
+	queryEvent             = 2
+	rotateEvent            = 4
+	formatDescriptionEvent = 15
+	xidEvent               = 16
+	tableMapEvent          = 19
+	writeRowsEventV1       = 23
+	updateRowsEventV1      = 24
+	deleteRowsEventV1      = 25
+	heartbeatEvent         = 27
+	writeRowsEventV2       = 30
+	updateRowsEventV2      = 31
+	deleteRowsEventV2      = 32
+	gtidEvent              = 33
+	anonymousGTIDEvent     = 34
+	partialUpdateRowsEvent = 39
+	transactionPayload     = 40
+
+	eventHeaderSize = 19
+	checksumCRC32   = 1
+)
+
+// MySQL 字段类型（binlog 中使用的取值）
+const (
+	typeDecimal    = 0
+	typeTiny       = 1
+	typeShort      = 2
+	typeLong       = 3
+	typeFloat      = 4
+	typeDouble     = 5
+	typeNull       = 6
+	typeTimestamp  = 7
+	typeLongLong   = 8
+	typeInt24      = 9
+	typeDate       = 10
+	typeTime       = 11
+	typeDateTime   = 12
+	typeYear       = 13
+	typeNewDate    = 14
+	typeVarchar    = 15
+	typeBit        = 16
+	typeTimestamp2 = 17
+	typeDateTime2  = 18
+	typeTime2      = 19
+	typeJSON       = 245
+	typeNewDecimal = 246
+	typeEnum       = 247
+	typeSet        = 248
+	typeTinyBlob   = 249
+	typeMediumBlob = 250
+	typeLongBlob   = 251
+	typeBlob       = 252
+	typeVarString  = 253
+	typeString     = 254
+	typeGeometry   = 255
+)
+
+// TABLE_MAP 可选元数据中的列符号信息（MySQL 8.0 binlog_row_metadata）
+const metaSignedness = 1
+
+// Action 行变更类型
+type Action int
+
+const (
+	Insert Action = iota + 1
+	Update
+	Delete
+)
+
+func (a Action) String() string {
+	switch a {
+	case Insert:
+		return "insert"
+	case Update:
+		return "update"
+	case Delete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// Position binlog 文件名 + 偏移量。源库开启 GTID 时 GTIDSet 为已执行的 GTID 集合，
+// 不为空时按 GTID 续传，源库切换后文件名和偏移量不同也能接上
+type Position struct {
+	File    string
+	Pos     uint32
+	GTIDSet string
+}
+
+func (p Position) String() string {
+	if p.GTIDSet != "" {
+		return fmt.Sprintf("%s:%d (GTID %s)", p.File, p.Pos, p.GTIDSet)
+	}
+	return fmt.Sprintf("%s:%d", p.File, p.Pos)
+}
+
+// Row 一个行镜像，下标与表的列顺序一致；未包含在镜像中的列为 nil
+type Row []interface{}
+
+// RowChange 单行变更，Insert 只有 After，Delete 只有 Before
+type RowChange struct {
+	Before Row
+	After  Row
+	// BeforePresent / AfterPresent 标记镜像中实际包含的列（binlog_row_image=MINIMAL 时只有部分列）
+	BeforePresent []bool
+	AfterPresent  []bool
+}
+
+// RowsEvent WRITE/UPDATE/DELETE_ROWS 事件解析后的结果
+type RowsEvent struct {
+	Schema  string
+	Table   string
+	Action  Action
+	Changes []RowChange
+}
+
+// Event 交给调用方的事件
+type Event struct {
+	// Position 该事件结束后的位置，从这里重新开始不会重复消费该事件；
+	// 按 GTID 续传时只有事务边界（Commit 和 DDL）的事件带 GTIDSet
+	Position Position
+	// Rows 行变更事件
+	Rows *RowsEvent
+	// Commit 为 true 表示事务提交（XID 事件），是保存位点的安全点
+	Commit bool
+	// Schema/Query 非 BEGIN 的 QUERY 事件（一般为 DDL）
+	Schema string
+	Query  string
+}
+
+type tableMap struct {
+	schema      string
+	table       string
+	columnTypes []byte
+	columnMeta  []uint16
+	unsigned    []bool
+}
+
+// parser 维护解析 binlog 所需的状态（当前文件、TABLE_MAP 缓存、校验和算法、已执行的 GTID）
+type parser struct {
+	file         string
+	checksum     byte
+	formatParsed bool
+	tables       map[uint64]*tableMap
+	// gtids 按 GTID 续传时已执行的集合，事务提交时加入 gtid；为空时不跟踪
+	gtids gtidSet
+	gtid  *gtidNext
+}
+
+// gtidNext 当前事务的 GTID
+type gtidNext struct {
+	sid string
+	gno int64
+}
+
+func newParser(file string) *parser {
+	return &parser{file: file, tables: make(map[uint64]*tableMap)}
+}
+
+// parse 解析一个完整事件（包含 19 字节事件头），不需要交给调用方的事件返回 nil
+func (p *parser) parse(data []byte) (*Event, error) {
+	if len(data) < eventHeaderSize {
+		return nil, fmt.Errorf("事件长度不足: %d", len(data))
+	}
+
+	eventType := data[4]
+	logPos := binary.LittleEndian.Uint32(data[13:17])
+	body := data[eventHeaderSize:]
+
+	if eventType == formatDescriptionEvent {
+		return nil, p.parseFormatDescription(data)
+	}
+	switch {
+	case p.formatParsed && p.checksum == checksumCRC32:
+		if !validChecksum(data) {
+			return nil, fmt.Errorf("事件 %d (%s:%d) 的 CRC32 校验和不一致，binlog 可能已损坏", eventType, p.file, logPos)
+		}
+		body = body[:len(body)-4]
+	case !p.formatParsed && validChecksum(data):
+		// FORMAT_DESCRIPTION 之前只有源库伪造的 ROTATE，是否带校验和取决于源库版本，校验和正确时去掉
+		body = body[:len(body)-4]
+	}
+
+	switch eventType {
+	case rotateEvent:
+		if len(body) < 8 {
+			return nil, errors.New("非法的 ROTATE 事件")
+		}
+		p.file = string(body[8:])
+		return nil, nil
+
+	case tableMapEvent:
+		return nil, p.parseTableMap(body)
+
+	case writeRowsEventV1, writeRowsEventV2,
+		updateRowsEventV1, updateRowsEventV2,
+		deleteRowsEventV1, deleteRowsEventV2:
+		rows, err := p.parseRows(eventType, body)
+		if err != nil {
+			return nil, err
+		}
+		return &Event{Position: Position{File: p.file, Pos: logPos}, Rows: rows}, nil
+
+	case gtidEvent:
+		// flags(1) + server_uuid(16) + gno(8)
+		if len(body) < 25 {
+			return nil, errors.New("非法的 GTID 事件")
+		}
+		p.gtid = &gtidNext{sid: formatSID(body[1:17]), gno: int64(binary.LittleEndian.Uint64(body[17:25]))}
+		return nil, nil
+
+	case anonymousGTIDEvent:
+		p.gtid = nil
+		return nil, nil
+
+	case xidEvent:
+		return &Event{Position: p.commit(logPos), Commit: true}, nil
+
+	case queryEvent:
+		schema, query, err := parseQuery(body)
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(query, "BEGIN") {
+			return nil, nil
+		}
+		if strings.EqualFold(query, "COMMIT") {
+			// 非事务引擎的语句以 QUERY(COMMIT) 结束
+			return &Event{Position: p.commit(logPos), Commit: true}, nil
+		}
+		// DDL 自成一个事务，有自己的 GTID
+		return &Event{Position: p.commit(logPos), Schema: schema, Query: query}, nil
+
+	case partialUpdateRowsEvent:
+		return nil, errors.New("不支持 PARTIAL_UPDATE_ROWS_EVENT，请关闭 binlog_row_value_options=PARTIAL_JSON")
+
+	case transactionPayload:
+		return nil, errors.New("不支持压缩的 binlog 事务，请关闭 binlog_transaction_compression")
+
+	default:
+		// GTID、PREVIOUS_GTIDS、ROWS_QUERY、HEARTBEAT 等事件不影响数据
+		return nil, nil
+	}
+}
+
+// commit 事务在 logPos 结束，把当前事务的 GTID 加入已执行的集合，返回可以续传的位置
+func (p *parser) commit(logPos uint32) Position {
+	pos := Position{File: p.file, Pos: logPos}
+	if p.gtids != nil {
+		if p.gtid != nil {
+			p.gtids.add(p.gtid.sid, p.gtid.gno)
+			p.gtid = nil
+		}
+		pos.GTIDSet = p.gtids.String()
+	}
+	return pos
+}
+
+// parseFormatDescription 读取之后的事件使用的校验和算法。FORMAT_DESCRIPTION 总是带算法和校验和，
+// 算法为 CRC32 时它自己的校验和也要检查
+func (p *parser) parseFormatDescription(data []byte) error {
+	body := data[eventHeaderSize:]
+	// binlog version(2) + server version(50) + create timestamp(4) + header length(1) + post header lengths + checksum alg(1) + crc(4)
+	if len(body) < 2+50+4+1+5 {
+		return errors.New("非法的 FORMAT_DESCRIPTION 事件")
+	}
+	p.checksum = body[len(body)-5]
+	if p.checksum == checksumCRC32 && !validChecksum(data) {
+		return errors.New("FORMAT_DESCRIPTION 事件的 CRC32 校验和不一致，binlog 可能已损坏")
+	}
+	p.formatParsed = true
+	return nil
+}
+
+// validChecksum 事件（含事件头）最后 4 字节是否为前面所有字节的 CRC32
+func validChecksum(data []byte) bool {
+	if len(data) < eventHeaderSize+4 {
+		return false
+	}
+	n := len(data) - 4
+	return crc32.ChecksumIEEE(data[:n]) == binary.LittleEndian.Uint32(data[n:])
+}
+
+func parseQuery(body []byte) (string, string, error) {
+	// thread id(4) + exec time(4) + schema length(1) + error code(2) + status vars length(2)
+	if len(body) < 13 {
+		return "", "", errors.New("非法的 QUERY 事件")
+	}
+	schemaLen := int(body[8])
+	statusLen := int(binary.LittleEndian.Uint16(body[11:13]))
+	pos := 13 + statusLen
+	if len(body) < pos+schemaLen+1 {
+		return "", "", errors.New("非法的 QUERY 事件")
+	}
+	schema := string(body[pos : pos+schemaLen])
+	return schema, string(body[pos+schemaLen+1:]), nil
+}
+
+func (p *parser) parseTableMap(body []byte) error {
+	r := &reader{data: body}
+	tableID := r.uint48()
+	r.skip(2) // flags
+
+	t := &tableMap{}
+	t.schema = string(r.bytes(int(r.uint8())))
+	r.skip(1)
+	t.table = string(r.bytes(int(r.uint8())))
+	r.skip(1)
+
+	columnCount := int(r.lenenc())
+	t.columnTypes = append([]byte{}, r.bytes(columnCount)...)
+
+	metaData := r.bytes(int(r.lenenc()))
+	meta, err := parseColumnMeta(t.columnTypes, metaData)
+	if err != nil {
+		return fmt.Errorf("解析表 %s.%s 的列元数据失败: %w", t.schema, t.table, err)
+	}
+	t.columnMeta = meta
+	r.skip((columnCount + 7) / 8) // nullable bitmap
+	if r.err != nil {
+		return fmt.Errorf("解析 TABLE_MAP 事件失败: %w", r.err)
+	}
+
+	// MySQL 8.0 的可选元数据，只关心无符号列
+	for r.remaining() > 0 && r.err == nil {
+		metaType := r.uint8()
+		value := r.bytes(int(r.lenenc()))
+		if metaType == metaSignedness {
+			t.unsigned = parseSignedness(t.columnTypes, value)
+		}
+	}
+
+	p.tables[tableID] = t
+	return nil
+}
+
+func parseColumnMeta(types []byte, data []byte) ([]uint16, error) {
+	meta := make([]uint16, len(types))
+	pos := 0
+	for i, t := range types {
+		switch t {
+		case typeString:
+			if pos+2 > len(data) {
+				return nil, errors.New("元数据长度不足")
+			}
+			meta[i] = uint16(data[pos])<<8 | uint16(data[pos+1])
+			pos += 2
+		case typeNewDecimal:
+			if pos+2 > len(data) {
+				return nil, errors.New("元数据长度不足")
+			}
+			meta[i] = uint16(data[pos])<<8 | uint16(data[pos+1])
+			pos += 2
+		case typeVarString, typeVarchar, typeBit:
+			if pos+2 > len(data) {
+				return nil, errors.New("元数据长度不足")
+			}
+			meta[i] = binary.LittleEndian.Uint16(data[pos:])
+			pos += 2
+		case typeBlob, typeDouble, typeFloat, typeGeometry, typeJSON,
+			typeTime2, typeDateTime2, typeTimestamp2:
+			if pos+1 > len(data) {
+				return nil, errors.New("元数据长度不足")
+			}
+			meta[i] = uint16(data[pos])
+			pos++
+		}
+	}
+	return meta, nil
+}
+
+func isNumericType(t byte) bool {
+	switch t {
+	case typeTiny, typeShort, typeInt24, typeLong, typeLongLong,
+		typeNewDecimal, typeFloat, typeDouble:
+		return true
+	}
+	return false
+}
+
+func parseSignedness(types []byte, bitmap []byte) []bool {
+	unsigned := make([]bool, len(types))
+	n := 0
+	for i, t := range types {
+		if !isNumericType(t) {
+			continue
+		}
+		if n/8 < len(bitmap) && bitmap[n/8]&(0x80>>uint(n%8)) != 0 {
+			unsigned[i] = true
+		}
+		n++
+	}
+	return unsigned
+}
+
+func (p *parser) parseRows(eventType byte, body []byte) (*RowsEvent, error) {
+	r := &reader{data: body}
+	tableID := r.uint48()
+	r.skip(2) // flags
+
+	if eventType >= writeRowsEventV2 {
+		extraLen := int(r.uint16())
+		r.skip(extraLen - 2)
+	}
+
+	t, ok := p.tables[tableID]
+	if !ok {
+		return nil, fmt.Errorf("未找到 table id %d 对应的 TABLE_MAP 事件", tableID)
+	}
+
+	columnCount := int(r.lenenc())
+	if columnCount != len(t.columnTypes) {
+		return nil, fmt.Errorf("表 %s.%s 的列数与 TABLE_MAP 不一致", t.schema, t.table)
+	}
+
+	event := &RowsEvent{Schema: t.schema, Table: t.table}
+	switch eventType {
+	case writeRowsEventV1, writeRowsEventV2:
+		event.Action = Insert
+	case updateRowsEventV1, updateRowsEventV2:
+		event.Action = Update
+	default:
+		event.Action = Delete
+	}
+
+	present := r.bitmap(columnCount)
+	presentAfter := present
+	if event.Action == Update {
+		presentAfter = r.bitmap(columnCount)
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("解析行事件失败: %w", r.err)
+	}
+
+	for r.remaining() > 0 {
+		var change RowChange
+		row, err := r.rowImage(t, present)
+		if err != nil {
+			return nil, fmt.Errorf("解析表 %s.%s 的行数据失败: %w", t.schema, t.table, err)
+		}
+
+		switch event.Action {
+		case Insert:
+			change.After, change.AfterPresent = row, present
+		case Delete:
+			change.Before, change.BeforePresent = row, present
+		case Update:
+			change.Before, change.BeforePresent = row, present
+			after, err := r.rowImage(t, presentAfter)
+			if err != nil {
+				return nil, fmt.Errorf("解析表 %s.%s 的行数据失败: %w", t.schema, t.table, err)
+			}
+			change.After, change.AfterPresent = after, presentAfter
+		}
+		event.Changes = append(event.Changes, change)
+	}
+
+	return event, nil
+}
+
+// reader 顺序读取字节，越界时记录错误而不是 panic
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *reader) remaining() int {
+	return len(r.data) - r.pos
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.data) {
+		r.err = errors.New("数据长度不足")
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *reader) skip(n int) {
+	r.bytes(n)
+}
+
+func (r *reader) uint8() uint8 {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *reader) uint16() uint16 {
+	b := r.bytes(2)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(b)
+}
+
+func (r *reader) uint48() uint64 {
+	b := r.bytes(6)
+	if b == nil {
+		return 0
+	}
+	return uint64(b[0]) | uint64(b[1])<<8 | uint64(b[2])<<16 |
+		uint64(b[3])<<24 | uint64(b[4])<<32 | uint64(b[5])<<40
+}
+
+func (r *reader) lenenc() uint64 {
+	if r.err != nil || r.pos >= len(r.data) {
+		r.err = errors.New("数据长度不足")
+		return 0
+	}
+	v, n := readLengthEncodedInt(r.data[r.pos:])
+	r.skip(n)
+	return v
+}
+
+func (r *reader) bitmap(n int) []bool {
+	b := r.bytes((n + 7) / 8)
+	bits := make([]bool, n)
+	if b == nil {
+		return bits
+	}
+	for i := range bits {
+		bits[i] = b[i/8]&(1<<uint(i%8)) != 0
+	}
+	return bits
+}
+
+func (r *reader) rowImage(t *tableMap, present []bool) (Row, error) {
+	presentCount := 0
+	for _, ok := range present {
+		if ok {
+			presentCount++
+		}
+	}
+	nulls := r.bitmap(presentCount)
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	row := make(Row, len(t.columnTypes))
+	n := 0
+	for i, ok := range present {
+		if !ok {
+			continue
+		}
+		isNull := nulls[n]
+		n++
+		if isNull {
+			continue
+		}
+
+		unsigned := t.unsigned != nil && t.unsigned[i]
+		v, err := r.value(t.columnTypes[i], t.columnMeta[i], unsigned)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 列: %w", i+1, err)
+		}
+		row[i] = v
+	}
+	return row, r.err
+}
+
+// value 按列类型解码一个值。数值和时间类型解码为 Go 值，JSON/GEOMETRY 保留原始字节
+func (r *reader) value(columnType byte, meta uint16, unsigned bool) (interface{}, error) {
+	switch columnType {
+	case typeTiny:
+		b := r.bytes(1)
+		if r.err != nil {
+			return nil, r.err
+		}
+		if unsigned {
+			return uint64(b[0]), nil
+		}
+		return int64(int8(b[0])), nil
+
+	case typeShort:
+		v := r.uint16()
+		if unsigned {
+			return uint64(v), r.err
+		}
+		return int64(int16(v)), r.err
+
+	case typeInt24:
+		b := r.bytes(3)
+		if r.err != nil {
+			return nil, r.err
+		}
+		v := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+		if unsigned {
+			return uint64(v), nil
+		}
+		if v&0x800000 != 0 {
+			v |= 0xff000000
+		}
+		return int64(int32(v)), nil
+
+	case typeLong:
+		b := r.bytes(4)
+		if r.err != nil {
+			return nil, r.err
+		}
+		v := binary.LittleEndian.Uint32(b)
+		if unsigned {
+			return uint64(v), nil
+		}
+		return int64(int32(v)), nil
+
+	case typeLongLong:
+		b := r.bytes(8)
+		if r.err != nil {
+			return nil, r.err
+		}
+		v := binary.LittleEndian.Uint64(b)
+		if unsigned {
+			return v, nil
+		}
+		return int64(v), nil
+
+	case typeFloat:
+		b := r.bytes(4)
+		if r.err != nil {
+			return nil, r.err
+		}
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), nil
+
+	case typeDouble:
+		b := r.bytes(8)
+		if r.err != nil {
+			return nil, r.err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+
+	case typeNewDecimal:
+		precision, scale := int(meta>>8), int(meta&0xff)
+		b := r.bytes(decimalSize(precision, scale))
+		if r.err != nil {
+			return nil, r.err
+		}
+		return decodeDecimal(b, precision, scale), nil
+
+	case typeYear:
+		b := r.bytes(1)
+		if r.err != nil {
+			return nil, r.err
+		}
+		if b[0] == 0 {
+			return int64(0), nil
+		}
+		return int64(b[0]) + 1900, nil
+
+	case typeDate, typeNewDate:
+		b := r.bytes(3)
+		if r.err != nil {
+			return nil, r.err
+		}
+		v := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+		return fmt.Sprintf("%04d-%02d-%02d", v>>9, (v>>5)&15, v&31), nil
+
+	case typeTimestamp:
+		b := r.bytes(4)
+		if r.err != nil {
+			return nil, r.err
+		}
+		return time.Unix(int64(binary.LittleEndian.Uint32(b)), 0).UTC(), nil
+
+	case typeTimestamp2:
+		b := r.bytes(4)
+		frac := r.fraction(meta)
+		if r.err != nil {
+			return nil, r.err
+		}
+		return time.Unix(int64(binary.BigEndian.Uint32(b)), int64(frac)*1000).UTC(), nil
+
+	case typeDateTime:
+		b := r.bytes(8)
+		if r.err != nil {
+			return nil, r.err
+		}
+		v := binary.LittleEndian.Uint64(b)
+		d, t := v/1000000, v%1000000
+		return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d",
+			d/10000, (d%10000)/100, d%100, t/10000, (t%10000)/100, t%100), nil
+
+	case typeDateTime2:
+		b := r.bytes(5)
+		frac := r.fraction(meta)
+		if r.err != nil {
+			return nil, r.err
+		}
+		v := uint64(b[0])<<32 | uint64(b[1])<<24 | uint64(b[2])<<16 | uint64(b[3])<<8 | uint64(b[4])
+		v -= 0x8000000000
+		ymd, hms := v>>17, v&(1<<17-1)
+		ym := ymd >> 5
+		s := fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d",
+			ym/13, ym%13, ymd&31, hms>>12, (hms>>6)&63, hms&63)
+		if meta > 0 {
+			s += "." + fmt.Sprintf("%06d", frac)[:meta]
+		}
+		return s, nil
+
+	case typeTime:
+		b := r.bytes(3)
+		if r.err != nil {
+			return nil, r.err
+		}
+		v := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+		return fmt.Sprintf("%02d:%02d:%02d", v/10000, (v%10000)/100, v%100), nil
+
+	case typeTime2:
+		b := r.bytes(3)
+		frac := r.fraction(meta)
+		if r.err != nil {
+			return nil, r.err
+		}
+		v := int64(uint32(b[0])<<16|uint32(b[1])<<8|uint32(b[2])) - 0x800000
+		sign := ""
+		if v < 0 {
+			sign, v = "-", -v
+		}
+		s := fmt.Sprintf("%s%02d:%02d:%02d", sign, (v>>12)&0x3ff, (v>>6)&63, v&63)
+		if meta > 0 {
+			s += "." + fmt.Sprintf("%06d", frac)[:meta]
+		}
+		return s, nil
+
+	case typeVarchar, typeVarString:
+		return r.lengthPrefixed(meta)
+
+	case typeString:
+		realType, length := byte(meta>>8), int(meta&0xff)
+		if meta >= 256 && realType&0x30 != 0x30 {
+			length |= int((realType&0x30)^0x30) << 4
+			realType |= 0x30
+		}
+		switch realType {
+		case typeEnum:
+			b := r.bytes(length)
+			if r.err != nil {
+				return nil, r.err
+			}
+			return littleEndianUint(b), nil
+		case typeSet:
+			b := r.bytes(length)
+			if r.err != nil {
+				return nil, r.err
+			}
+			return littleEndianUint(b), nil
+		default:
+			return r.lengthPrefixed(uint16(length))
+		}
+
+	case typeBit:
+		nbits := int(meta>>8)*8 + int(meta&0xff)
+		b := r.bytes((nbits + 7) / 8)
+		if r.err != nil {
+			return nil, r.err
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, nil
+
+	case typeBlob, typeTinyBlob, typeMediumBlob, typeLongBlob, typeGeometry, typeJSON:
+		n := int(littleEndianUint(r.bytes(int(meta))))
+		b := r.bytes(n)
+		if r.err != nil {
+			return nil, r.err
+		}
+		return append([]byte{}, b...), nil
+
+	case typeNull:
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("不支持的列类型 %d", columnType)
+	}
+}
+
+// fraction 读取 TIME2/DATETIME2/TIMESTAMP2 的小数秒部分，返回微秒
+func (r *reader) fraction(fsp uint16) uint32 {
+	switch fsp {
+	case 1, 2:
+		b := r.bytes(1)
+		if b == nil {
+			return 0
+		}
+		return uint32(b[0]) * 10000
+	case 3, 4:
+		b := r.bytes(2)
+		if b == nil {
+			return 0
+		}
+		return uint32(binary.BigEndian.Uint16(b)) * 100
+	case 5, 6:
+		b := r.bytes(3)
+		if b == nil {
+			return 0
+		}
+		return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+	}
+	return 0
+}
+
+func (r *reader) lengthPrefixed(maxLength uint16) (interface{}, error) {
+	var n int
+	if maxLength < 256 {
+		n = int(r.uint8())
+	} else {
+		n = int(r.uint16())
+	}
+	b := r.bytes(n)
+	if r.err != nil {
+		return nil, r.err
+	}
+	return string(b), nil
+}
+
+func littleEndianUint(b []byte) uint64 {
+	var v uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	return v
+}
+
+var digitsToBytes = [10]int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+
+func decimalSize(precision, scale int) int {
+	intg := precision - scale
+	return intg/9*4 + digitsToBytes[intg%9] + scale/9*4 + digitsToBytes[scale%9]
+}
+
+// decodeDecimal 将 MySQL 二进制 DECIMAL 解码为十进制字符串，避免精度丢失
+func decodeDecimal(data []byte, precision, scale int) string {
+	b := append([]byte{}, data...)
+	negative := b[0]&0x80 == 0
+	b[0] ^= 0x80
+	if negative {
+		for i := range b {
+			b[i] = ^b[i]
+		}
+	}
+
+	intg := precision - scale
+	var sb strings.Builder
+	if negative {
+		sb.WriteByte('-')
+	}
+
+	pos := 0
+	readGroup := func(size int) uint64 {
+		var v uint64
+		for _, c := range b[pos : pos+size] {
+			v = v<<8 | uint64(c)
+		}
+		pos += size
+		return v
+	}
+
+	var intPart bytes.Buffer
+	if lead := digitsToBytes[intg%9]; lead > 0 {
+		intPart.WriteString(strconv.FormatUint(readGroup(lead), 10))
+	}
+	for i := 0; i < intg/9; i++ {
+		intPart.WriteString(fmt.Sprintf("%09d", readGroup(4)))
+	}
+	digits := strings.TrimLeft(intPart.String(), "0")
+	if digits == "" {
+		digits = "0"
+	}
+	sb.WriteString(digits)
+
+	if scale > 0 {
+		sb.WriteByte('.')
+		for i := 0; i < scale/9; i++ {
+			sb.WriteString(fmt.Sprintf("%09d", readGroup(4)))
+		}
+		if rest := scale % 9; rest > 0 {
+			sb.WriteString(fmt.Sprintf("%0*d", rest, readGroup(digitsToBytes[rest])))
+		}
+	}
+	return sb.String()
+}
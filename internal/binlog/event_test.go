@@ -0,0 +1,304 @@
+package binlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+// ----------------------------- 构造事件的工具函数 -----------------------------
+
+func buildEvent(eventType byte, logPos uint32, body []byte, withChecksum bool) []byte {
+	size := eventHeaderSize + len(body)
+	if withChecksum {
+		size += 4
+	}
+	event := make([]byte, eventHeaderSize, size)
+	event[4] = eventType
+	binary.LittleEndian.PutUint32(event[9:], uint32(size))
+	binary.LittleEndian.PutUint32(event[13:], logPos)
+	event = append(event, body...)
+	if withChecksum {
+		event = binary.LittleEndian.AppendUint32(event, crc32.ChecksumIEEE(event))
+	}
+	return event
+}
+
+// formatDescription FORMAT_DESCRIPTION 事件总是带算法和校验和，算法为 OFF 时校验和为 0
+func formatDescription(checksum byte) []byte {
+	body := make([]byte, 2+50+4+1)
+	body = append(body, make([]byte, 40)...) // post header lengths
+	body = append(body, checksum)
+	if checksum != checksumCRC32 {
+		return buildEvent(formatDescriptionEvent, 120, append(body, 0, 0, 0, 0), false)
+	}
+	return buildEvent(formatDescriptionEvent, 120, body, true)
+}
+
+func rotateBody(file string) []byte {
+	return append(binary.LittleEndian.AppendUint64(nil, 4), file...)
+}
+
+func gtidBody(sid string, gno uint64) []byte {
+	uuid, _ := sidBytes(sid)
+	body := append([]byte{1}, uuid...)
+	return binary.LittleEndian.AppendUint64(body, gno)
+}
+
+// tableMapBody 表结构: id BIGINT UNSIGNED, name VARCHAR(64), price DECIMAL(10,2), created_at DATETIME
+func tableMapBody(tableID uint64) []byte {
+	body := []byte{byte(tableID), byte(tableID >> 8), byte(tableID >> 16), 0, 0, 0, 0, 0}
+	body = append(body, 2, 'd', 'b', 0)
+	body = append(body, 5, 'g', 'o', 'o', 'd', 's', 0)
+	body = append(body, 4)
+	body = append(body, typeLongLong, typeVarchar, typeNewDecimal, typeDateTime2)
+	meta := []byte{64, 0, 10, 2, 0}
+	body = append(body, byte(len(meta)))
+	body = append(body, meta...)
+	body = append(body, 0x0e) // nullable bitmap
+	// SIGNEDNESS: 数值列依次为 id、price，id 无符号
+	body = append(body, metaSignedness, 1, 0x80)
+	return body
+}
+
+func rowImage(id uint64, name string, price []byte, created []byte) []byte {
+	row := []byte{0x00} // null bitmap
+	row = binary.LittleEndian.AppendUint64(row, id)
+	row = append(row, byte(len(name)))
+	row = append(row, name...)
+	row = append(row, price...)
+	return append(row, created...)
+}
+
+func datetime2(year, month, day, hour, minute, second uint64) []byte {
+	ymd := (year*13+month)<<5 | day
+	hms := hour<<12 | minute<<6 | second
+	v := ymd<<17 | hms + 0x8000000000
+	return []byte{byte(v >> 32), byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+func rowsBody(tableID uint64) []byte {
+	body := []byte{byte(tableID), byte(tableID >> 8), byte(tableID >> 16), 0, 0, 0, 0, 0}
+	body = append(body, 2, 0) // extra data length
+	body = append(body, 4)    // column count
+	body = append(body, 0x0f) // columns present
+	return body
+}
+
+// ----------------------------- 测试 -----------------------------
+
+func TestParseRowsEvents(t *testing.T) {
+	for _, withChecksum := range []bool{false, true} {
+		p := newParser("")
+		alg := byte(0)
+		if withChecksum {
+			alg = checksumCRC32
+		}
+
+		// 源库先发送伪造的 ROTATE 告知当前文件，再发送 FORMAT_DESCRIPTION
+		if _, err := p.parse(buildEvent(rotateEvent, 0, rotateBody("mysql-bin.000001"), withChecksum)); err != nil {
+			t.Fatalf("解析伪造的 ROTATE 失败: %v", err)
+		}
+		if p.file != "mysql-bin.000001" {
+			t.Errorf("伪造的 ROTATE 文件名错误: %q", p.file)
+		}
+		if _, err := p.parse(formatDescription(alg)); err != nil {
+			t.Fatalf("解析 FORMAT_DESCRIPTION 失败: %v", err)
+		}
+		if _, err := p.parse(buildEvent(tableMapEvent, 200, tableMapBody(42), withChecksum)); err != nil {
+			t.Fatalf("解析 TABLE_MAP 失败: %v", err)
+		}
+
+		price := []byte{0x80, 0x00, 0x00, 0x0c, 0x22}    // 12.34
+		negative := []byte{0x7f, 0xff, 0xff, 0xf3, 0xdd} // -12.34
+		created := datetime2(2024, 1, 2, 3, 4, 5)
+		maxID := uint64(1<<63 + 1)
+
+		insert := rowsBody(42)
+		insert = append(insert, rowImage(maxID, "abc", price, created)...)
+		event, err := p.parse(buildEvent(writeRowsEventV2, 300, insert, withChecksum))
+		if err != nil {
+			t.Fatalf("解析 WRITE_ROWS 失败: %v", err)
+		}
+		if event.Position != (Position{File: "mysql-bin.000001", Pos: 300}) {
+			t.Errorf("位点错误: %v", event.Position)
+		}
+		rows := event.Rows
+		if rows.Schema != "db" || rows.Table != "goods" || rows.Action != Insert || len(rows.Changes) != 1 {
+			t.Fatalf("行事件解析错误: %+v", rows)
+		}
+		got := rows.Changes[0].After
+		if got[0] != maxID || got[1] != "abc" || got[2] != "12.34" || got[3] != "2024-01-02 03:04:05" {
+			t.Errorf("行数据解析错误: %#v", got)
+		}
+
+		update := append([]byte{}, rowsBody(42)...)
+		update = append(update, 0x0f) // 修改后镜像的列
+		update = append(update, rowImage(7, "old", price, created)...)
+		update = append(update, rowImage(8, "new", negative, created)...)
+		event, err = p.parse(buildEvent(updateRowsEventV2, 400, update, withChecksum))
+		if err != nil {
+			t.Fatalf("解析 UPDATE_ROWS 失败: %v", err)
+		}
+		change := event.Rows.Changes[0]
+		if change.Before[0] != uint64(7) || change.After[0] != uint64(8) || change.After[2] != "-12.34" {
+			t.Errorf("更新事件解析错误: before=%#v after=%#v", change.Before, change.After)
+		}
+
+		event, err = p.parse(buildEvent(xidEvent, 431, make([]byte, 8), withChecksum))
+		if err != nil || !event.Commit || event.Position.Pos != 431 {
+			t.Errorf("XID 事件解析错误: %+v, %v", event, err)
+		}
+
+		if _, err := p.parse(buildEvent(rotateEvent, 0, rotateBody("mysql-bin.000002"), withChecksum)); err != nil {
+			t.Fatalf("解析 ROTATE 失败: %v", err)
+		}
+		if p.file != "mysql-bin.000002" {
+			t.Errorf("ROTATE 后文件名错误: %s", p.file)
+		}
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	p := newParser("mysql-bin.000001")
+	if _, err := p.parse(formatDescription(checksumCRC32)); err != nil {
+		t.Fatalf("解析 FORMAT_DESCRIPTION 失败: %v", err)
+	}
+	event := buildEvent(xidEvent, 431, make([]byte, 8), true)
+	event[eventHeaderSize] ^= 0xff
+	if _, err := p.parse(event); err == nil {
+		t.Errorf("校验和不一致的事件应返回错误")
+	}
+
+	// 算法为 OFF 时不校验，也不去掉最后 4 字节
+	p = newParser("mysql-bin.000001")
+	if _, err := p.parse(formatDescription(0)); err != nil {
+		t.Fatalf("解析 FORMAT_DESCRIPTION 失败: %v", err)
+	}
+	if _, err := p.parse(buildEvent(rotateEvent, 0, rotateBody("mysql-bin.000002"), false)); err != nil || p.file != "mysql-bin.000002" {
+		t.Errorf("未开启校验和时 ROTATE 解析错误: %q %v", p.file, err)
+	}
+}
+
+func TestParseGTIDEvents(t *testing.T) {
+	const sid = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	gtids, err := parseGTIDSet(sid + ":1-5")
+	if err != nil {
+		t.Fatalf("解析 GTID 集合失败: %v", err)
+	}
+	p := newParser("")
+	p.gtids = gtids
+	for _, event := range [][]byte{
+		buildEvent(rotateEvent, 0, rotateBody("mysql-bin.000007"), true),
+		formatDescription(checksumCRC32),
+		buildEvent(gtidEvent, 180, gtidBody(sid, 6), true),
+		buildEvent(queryEvent, 250, queryBody("BEGIN"), true),
+	} {
+		if _, err := p.parse(event); err != nil {
+			t.Fatalf("解析事件失败: %v", err)
+		}
+	}
+
+	event, err := p.parse(buildEvent(xidEvent, 300, make([]byte, 8), true))
+	if err != nil || !event.Commit {
+		t.Fatalf("XID 事件解析错误: %+v, %v", event, err)
+	}
+	want := Position{File: "mysql-bin.000007", Pos: 300, GTIDSet: sid + ":1-6"}
+	if event.Position != want {
+		t.Errorf("提交后的位点错误: %v", event.Position)
+	}
+
+	// DDL 自成一个事务；匿名事务不加入集合
+	if _, err := p.parse(buildEvent(gtidEvent, 350, gtidBody(sid, 8), true)); err != nil {
+		t.Fatalf("解析 GTID 失败: %v", err)
+	}
+	event, err = p.parse(buildEvent(queryEvent, 400, queryBody("ALTER TABLE goods ADD COLUMN c INT"), true))
+	if err != nil || event.Position.GTIDSet != sid+":1-6:8" {
+		t.Errorf("DDL 后的位点错误: %+v, %v", event, err)
+	}
+	if _, err := p.parse(buildEvent(anonymousGTIDEvent, 450, make([]byte, 25), true)); err != nil {
+		t.Fatalf("解析匿名 GTID 失败: %v", err)
+	}
+	event, err = p.parse(buildEvent(xidEvent, 500, make([]byte, 8), true))
+	if err != nil || event.Position.GTIDSet != sid+":1-6:8" {
+		t.Errorf("匿名事务不应改变 GTID 集合: %+v, %v", event, err)
+	}
+}
+
+func TestGTIDSet(t *testing.T) {
+	const a = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	const b = "00000000-0000-0000-0000-000000000001"
+	set, err := parseGTIDSet(a + ":1-3:7,\n" + b + ":5")
+	if err != nil {
+		t.Fatalf("解析 GTID 集合失败: %v", err)
+	}
+	set.add(a, 4)
+	set.add(b, 6)
+	if got := set.String(); got != b+":5-6,"+a+":1-4:7" {
+		t.Errorf("GTID 集合格式错误: %s", got)
+	}
+	for _, invalid := range []string{"abc:1", a, a + ":0", a + ":5-3", a + ":tag:1"} {
+		if _, err := parseGTIDSet(invalid); err == nil {
+			t.Errorf("%q 应解析失败", invalid)
+		}
+	}
+
+	// COM_BINLOG_DUMP_GTID 中的区间为左闭右开
+	payload := binlogDumpGTIDPayload(100, gtidSet{b: {{5, 6}}})
+	want := []byte{binlogThroughGTID, 0, 100, 0, 0, 0, 0, 0, 0, 0, 4, 0, 0, 0, 0, 0, 0, 0, 48, 0, 0, 0}
+	want = binary.LittleEndian.AppendUint64(want, 1)
+	want = append(want, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1)
+	want = binary.LittleEndian.AppendUint64(want, 1)
+	want = binary.LittleEndian.AppendUint64(want, 5)
+	want = binary.LittleEndian.AppendUint64(want, 7)
+	if !bytes.Equal(payload, want) {
+		t.Errorf("COM_BINLOG_DUMP_GTID 内容错误:\n%v\n%v", payload, want)
+	}
+}
+
+func queryBody(query string) []byte {
+	// thread id(4) + exec time(4) + schema length(1) + error code(2) + status vars length(2) + schema + 0 + query
+	body := make([]byte, 13)
+	body[8] = 2
+	body = append(body, 'd', 'b', 0)
+	return append(body, query...)
+}
+
+func TestDecodeDecimal(t *testing.T) {
+	cases := []struct {
+		data             []byte
+		precision, scale int
+		want             string
+	}{
+		{[]byte{0x80, 0x00, 0x00, 0x0c, 0x22}, 10, 2, "12.34"},
+		{[]byte{0x7f, 0xff, 0xff, 0xf3, 0xdd}, 10, 2, "-12.34"},
+		{[]byte{0x80, 0x00, 0x00, 0x00, 0x05}, 10, 2, "0.05"},
+		// DECIMAL(20,0): 2 个 9 位整组 + 2 位
+		{[]byte{0x81, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, 20, 0, "1000000000000000000"},
+	}
+	for _, c := range cases {
+		if size := decimalSize(c.precision, c.scale); size != len(c.data) {
+			t.Errorf("DECIMAL(%d,%d) 长度应为 %d，实际 %d", c.precision, c.scale, len(c.data), size)
+			continue
+		}
+		if got := decodeDecimal(c.data, c.precision, c.scale); got != c.want {
+			t.Errorf("DECIMAL(%d,%d) 解码为 %s，期望 %s", c.precision, c.scale, got, c.want)
+		}
+	}
+}
+
+func TestScramblePassword(t *testing.T) {
+	scramble := []byte("01234567890123456789")
+	native, err := scramblePassword(pluginNative, "secret", scramble)
+	if err != nil || len(native) != 20 {
+		t.Fatalf("mysql_native_password 结果错误: %v, %v", native, err)
+	}
+	sha2, err := scramblePassword(pluginCachingSHA2, "secret", scramble)
+	if err != nil || len(sha2) != 32 {
+		t.Fatalf("caching_sha2_password 结果错误: %v, %v", sha2, err)
+	}
+	if empty, _ := scramblePassword(pluginNative, "", scramble); empty != nil {
+		t.Errorf("空密码应返回空的认证数据")
+	}
+}
@@ -0,0 +1,133 @@
+package binlog
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// gtidInterval 一段连续的事务编号 [start, end]
+type gtidInterval struct {
+	start, end int64
+}
+
+// gtidSet 已执行的 GTID 集合：源库 server_uuid → 按编号排好、互不重叠的区间
+type gtidSet map[string][]gtidInterval
+
+// parseGTIDSet 解析 @@gtid_executed 格式的集合，例如 "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5:7,..."。
+// 不支持 MySQL 8.3 带标签的 GTID
+func parseGTIDSet(s string) (gtidSet, error) {
+	set := make(gtidSet)
+	s = strings.Join(strings.Fields(s), "")
+	if s == "" {
+		return set, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		fields := strings.Split(part, ":")
+		sid := strings.ToLower(fields[0])
+		if _, err := sidBytes(sid); err != nil || len(fields) < 2 {
+			return nil, fmt.Errorf("非法的 GTID 集合 %q", part)
+		}
+		for _, field := range fields[1:] {
+			bounds := strings.SplitN(field, "-", 2)
+			start, err := strconv.ParseInt(bounds[0], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("非法的 GTID 集合 %q（不支持带标签的 GTID）", part)
+			}
+			end := start
+			if len(bounds) == 2 {
+				if end, err = strconv.ParseInt(bounds[1], 10, 64); err != nil {
+					return nil, fmt.Errorf("非法的 GTID 集合 %q", part)
+				}
+			}
+			if start < 1 || end < start {
+				return nil, fmt.Errorf("非法的 GTID 区间 %q", field)
+			}
+			set.addInterval(sid, gtidInterval{start, end})
+		}
+	}
+	return set, nil
+}
+
+// add 加入一个已提交的事务
+func (s gtidSet) add(sid string, gno int64) {
+	s.addInterval(sid, gtidInterval{gno, gno})
+}
+
+func (s gtidSet) addInterval(sid string, in gtidInterval) {
+	intervals := append(s[sid], in)
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i].start < intervals[j].start })
+	merged := intervals[:1]
+	for _, next := range intervals[1:] {
+		last := &merged[len(merged)-1]
+		if next.start <= last.end+1 {
+			last.end = max(last.end, next.end)
+			continue
+		}
+		merged = append(merged, next)
+	}
+	s[sid] = merged
+}
+
+// String 按 server_uuid 排序输出，与 @@gtid_executed 的格式相同
+func (s gtidSet) String() string {
+	sids := make([]string, 0, len(s))
+	for sid := range s {
+		sids = append(sids, sid)
+	}
+	sort.Strings(sids)
+
+	parts := make([]string, len(sids))
+	for i, sid := range sids {
+		var b strings.Builder
+		b.WriteString(sid)
+		for _, in := range s[sid] {
+			if in.start == in.end {
+				fmt.Fprintf(&b, ":%d", in.start)
+			} else {
+				fmt.Fprintf(&b, ":%d-%d", in.start, in.end)
+			}
+		}
+		parts[i] = b.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// encode COM_BINLOG_DUMP_GTID 中的集合：n_sids(8) + 每个 sid: uuid(16) + n_intervals(8) + 每个区间: start(8) + end+1(8)
+func (s gtidSet) encode() []byte {
+	sids := make([]string, 0, len(s))
+	for sid := range s {
+		sids = append(sids, sid)
+	}
+	sort.Strings(sids)
+
+	data := binary.LittleEndian.AppendUint64(nil, uint64(len(sids)))
+	for _, sid := range sids {
+		uuid, _ := sidBytes(sid)
+		data = append(data, uuid...)
+		data = binary.LittleEndian.AppendUint64(data, uint64(len(s[sid])))
+		for _, in := range s[sid] {
+			data = binary.LittleEndian.AppendUint64(data, uint64(in.start))
+			data = binary.LittleEndian.AppendUint64(data, uint64(in.end+1))
+		}
+	}
+	return data
+}
+
+// sidBytes 把 server_uuid 转为 16 字节
+func sidBytes(sid string) ([]byte, error) {
+	b, err := hex.DecodeString(strings.ReplaceAll(sid, "-", ""))
+	if err != nil || len(b) != 16 || len(sid) != 36 {
+		return nil, fmt.Errorf("非法的 server_uuid %q", sid)
+	}
+	return b, nil
+}
+
+// formatSID 把 GTID 事件中的 16 字节 server_uuid 转为字符串
+func formatSID(b []byte) string {
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
@@ -0,0 +1,226 @@
+package binlog
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Config 复制连接配置，账号需要 REPLICATION SLAVE 和 REPLICATION CLIENT 权限
+type Config struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	// ServerID 在复制拓扑中必须唯一，不能和源库或其他从库重复
+	ServerID uint32
+	// HeartbeatPeriod 源库在空闲时发送心跳的间隔，读超时为其 3 倍
+	HeartbeatPeriod time.Duration
+}
+
+// Streamer 按顺序返回 binlog 事件
+type Streamer interface {
+	// GetEvent 阻塞直到拿到下一个需要处理的事件
+	GetEvent(ctx context.Context) (*Event, error)
+	Close() error
+}
+
+type eventResult struct {
+	event *Event
+	err   error
+}
+
+type streamer struct {
+	conn   *conn
+	events chan eventResult
+	done   chan struct{}
+	once   sync.Once
+}
+
+// errUnknownSystemVariable MySQL 5.5 没有 binlog_checksum 变量
+const errUnknownSystemVariable = 1193
+
+// Dial 建立复制连接，并从 pos 开始 dump binlog；pos.GTIDSet 不为空时按 GTID 续传，
+// 源库跳过集合中已执行的事务，pos 的文件名和偏移量不再使用
+func Dial(ctx context.Context, cfg Config, pos Position) (Streamer, error) {
+	heartbeat := cfg.HeartbeatPeriod
+	if heartbeat <= 0 {
+		heartbeat = 30 * time.Second
+	}
+	var gtids gtidSet
+	if pos.GTIDSet != "" {
+		var err error
+		if gtids, err = parseGTIDSet(pos.GTIDSet); err != nil {
+			return nil, err
+		}
+	}
+
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	c, err := dial(addr, cfg.User, cfg.Password, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按源库的 binlog_checksum 接收事件：源库开启 CRC32 时每个事件都带校验和，由 parser 校验后去掉。
+	// 不声明时源库会拒绝发送带校验和的 binlog
+	checksum := "SET @master_binlog_checksum = @@global.binlog_checksum"
+	var serverErr *ServerError
+	if err := c.exec(checksum); err != nil && !(errors.As(err, &serverErr) && serverErr.Code == errUnknownSystemVariable) {
+		c.Close()
+		return nil, fmt.Errorf("初始化复制连接失败(%s): %w", checksum, err)
+	}
+	period := fmt.Sprintf("SET @master_heartbeat_period = %d", heartbeat.Nanoseconds())
+	if err := c.exec(period); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("初始化复制连接失败(%s): %w", period, err)
+	}
+
+	if err := c.registerSlave(cfg.ServerID); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("注册从库失败: %w", err)
+	}
+	if gtids != nil {
+		if err := c.writeCommand(comBinlogDumpGTID, binlogDumpGTIDPayload(cfg.ServerID, gtids)); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("发送 COM_BINLOG_DUMP_GTID 失败: %w", err)
+		}
+	} else if err := c.binlogDump(cfg.ServerID, pos); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("发送 COM_BINLOG_DUMP 失败: %w", err)
+	}
+	c.timeout = 3 * heartbeat
+
+	s := &streamer{
+		conn:   c,
+		events: make(chan eventResult, 128),
+		done:   make(chan struct{}),
+	}
+	p := newParser(pos.File)
+	p.gtids = gtids
+	go s.run(p)
+
+	// ctx 取消后关闭连接，阻塞中的读取会随之返回
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Close()
+		case <-s.done:
+		}
+	}()
+
+	return s, nil
+}
+
+func (s *streamer) run(p *parser) {
+	defer close(s.events)
+
+	for {
+		data, err := s.conn.readPacket()
+		if err != nil {
+			s.send(eventResult{err: fmt.Errorf("读取 binlog 失败: %w", err)})
+			return
+		}
+
+		switch data[0] {
+		case 0x00:
+		case 0xff:
+			s.send(eventResult{err: parseServerError(data)})
+			return
+		case 0xfe:
+			s.send(eventResult{err: fmt.Errorf("源库结束了 binlog 流")})
+			return
+		default:
+			s.send(eventResult{err: fmt.Errorf("未知的 binlog 包: 0x%02x", data[0])})
+			return
+		}
+
+		event, err := p.parse(data[1:])
+		if err != nil {
+			s.send(eventResult{err: err})
+			return
+		}
+		if event != nil && !s.send(eventResult{event: event}) {
+			return
+		}
+	}
+}
+
+func (s *streamer) send(r eventResult) bool {
+	select {
+	case s.events <- r:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+func (s *streamer) GetEvent(ctx context.Context) (*Event, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r, ok := <-s.events:
+		if !ok {
+			return nil, fmt.Errorf("binlog 连接已关闭")
+		}
+		return r.event, r.err
+	}
+}
+
+func (s *streamer) Close() error {
+	var err error
+	s.once.Do(func() {
+		close(s.done)
+		err = s.conn.Close()
+	})
+	return err
+}
+
+func (c *conn) registerSlave(serverID uint32) error {
+	// server_id(4) + hostname + user + password (都为空) + port(2) + rank(4) + master_id(4)
+	payload := make([]byte, 0, 18)
+	payload = binary.LittleEndian.AppendUint32(payload, serverID)
+	payload = append(payload, 0, 0, 0)
+	payload = binary.LittleEndian.AppendUint16(payload, 0)
+	payload = binary.LittleEndian.AppendUint32(payload, 0)
+	payload = binary.LittleEndian.AppendUint32(payload, 0)
+
+	if err := c.writeCommand(comRegisterSlave, payload); err != nil {
+		return err
+	}
+	data, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if data[0] == 0xff {
+		return parseServerError(data)
+	}
+	return nil
+}
+
+func (c *conn) binlogDump(serverID uint32, pos Position) error {
+	// binlog_pos(4) + flags(2) + server_id(4) + binlog_filename
+	payload := make([]byte, 0, 10+len(pos.File))
+	payload = binary.LittleEndian.AppendUint32(payload, pos.Pos)
+	payload = binary.LittleEndian.AppendUint16(payload, 0)
+	payload = binary.LittleEndian.AppendUint32(payload, serverID)
+	payload = append(payload, pos.File...)
+	return c.writeCommand(comBinlogDump, payload)
+}
+
+// binlogDumpGTIDPayload COM_BINLOG_DUMP_GTID: flags(2) + server_id(4) + binlog_name_info_size(4) + binlog_name +
+// binlog_pos(8) + data_size(4) + GTID 集合。文件名为空、偏移量为 4，源库从第一个不在集合中的事务开始发送
+func binlogDumpGTIDPayload(serverID uint32, gtids gtidSet) []byte {
+	data := gtids.encode()
+	payload := make([]byte, 0, 22+len(data))
+	payload = binary.LittleEndian.AppendUint16(payload, binlogThroughGTID)
+	payload = binary.LittleEndian.AppendUint32(payload, serverID)
+	payload = binary.LittleEndian.AppendUint32(payload, 0)
+	payload = binary.LittleEndian.AppendUint64(payload, 4)
+	payload = binary.LittleEndian.AppendUint32(payload, uint32(len(data)))
+	return append(payload, data...)
+}
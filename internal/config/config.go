@@ -2,46 +2,150 @@ package config
 
 import (
 	"fmt"
+	"github.com/robfig/cron/v3"
 	"github.com/spf13/viper"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 )
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Sync     SyncConfig     `mapstructure:"sync"`
+	Server   ServerConfig   `mapstructure:"server" json:"server"`
+	Database DatabaseConfig `mapstructure:"database" json:"database"`
+	Sync     SyncConfig     `mapstructure:"sync" json:"sync"`
 }
 
 type ServerConfig struct {
-	Port int    `mapstructure:"port"`
-	Host string `mapstructure:"host"`
+	Port            int    `mapstructure:"port" json:"port"`
+	Host            string `mapstructure:"host" json:"host"`
+	ShutdownTimeout int    `mapstructure:"shutdown_timeout" json:"shutdown_timeout"` // 收到退出信号后等待进行中批次的最长时间（秒）
 }
 
 type DatabaseConfig struct {
-	Source DBConnection `mapstructure:"source"`
-	Target DBConnection `mapstructure:"target"`
+	Source  DBConnection   `mapstructure:"source" json:"source"`
+	Sources []SourceConfig `mapstructure:"sources" json:"sources,omitempty"` // 多个源库汇总到同一个目标库，配置后不再使用 source
+	Target  DBConnection   `mapstructure:"target" json:"target"`
+	Targets []TargetConfig `mapstructure:"targets" json:"targets,omitempty"` // 多个目标库，配置后不再使用 target
+}
+
+// SourceConfig 多源库汇总时的一个源库，名称写入目标表的 sync.discriminator 字段
+type SourceConfig struct {
+	Name         string `mapstructure:"name" json:"name"`
+	DBConnection `mapstructure:",squash"`
+}
+
+// TargetConfig 多目标库时的一个目标库。同一张表在各目标库按同一时间调度，起点相同的读取每页只查询一次源库；
+// 是否需要同步的校验查询不共用，目标库越多源库的查询越多
+type TargetConfig struct {
+	Name         string `mapstructure:"name" json:"name"`
+	DBConnection `mapstructure:",squash"`
+	Tables       []string `mapstructure:"tables" json:"tables,omitempty"` // 同步到该目标库的源表（table_pairs 中的 source），为空时同步全部表
 }
 
 type DBConnection struct {
-	Host     string `mapstructure:"host"`
-	Port     int    `mapstructure:"port"`
-	User     string `mapstructure:"user"`
-	Password string `mapstructure:"password"`
-	Database string `mapstructure:"database"`
+	Host     string `mapstructure:"host" json:"host"`
+	Port     int    `mapstructure:"port" json:"port"`
+	User     string `mapstructure:"user" json:"user"`
+	Password string `mapstructure:"password" json:"password"`
+	Database string `mapstructure:"database" json:"database"`
 }
 
 type SyncConfig struct {
-	BatchSize  int         `mapstructure:"batch_size"`
-	Interval   int         `mapstructure:"interval"`
-	SyncMode   string      `mapstructure:"sync_mode"`
-	TablePairs []TablePair `mapstructure:"table_pairs"`
+	BatchSize      int              `mapstructure:"batch_size" json:"batch_size"`
+	Interval       int              `mapstructure:"interval" json:"interval"`               // 未单独配置调度的表使用的同步间隔（秒）
+	MaxConcurrency int              `mapstructure:"max_concurrency" json:"max_concurrency"` // 同时同步的表数上限
+	ChunkSize      int              `mapstructure:"chunk_size" json:"chunk_size"`           // check_method 为 chunk_checksum 时每块的行数
+	SyncMode       string           `mapstructure:"sync_mode" json:"sync_mode"`
+	Binlog         BinlogConfig     `mapstructure:"binlog" json:"binlog"`
+	Checkpoint     CheckpointConfig `mapstructure:"checkpoint" json:"checkpoint"`
+	Discriminator  string           `mapstructure:"discriminator" json:"discriminator,omitempty"` // 多个源库时目标表中记录来源的字段，加入目标表主键
+	MaskSalt       string           `mapstructure:"mask_salt" json:"mask_salt"`                   // hash、fake 脱敏使用的密钥，所有表共用，同一个值在不同表中脱敏结果相同
+	TablePairs     []TablePair      `mapstructure:"table_pairs" json:"table_pairs"`
+	Discovery      TableDiscovery   `mapstructure:"discovery" json:"discovery"` // 按模式自动发现 table_pairs 之外的源表
+	// ChunkVerifyInterval chunk_checksum 每隔多久对所有块完整校验一次（秒），其余各轮只校验行数或 update_field 最大值变化了的块；0 表示每轮都完整校验
+	ChunkVerifyInterval int `mapstructure:"chunk_verify_interval" json:"chunk_verify_interval"`
+	// ForeignKeyOrder 按外键依赖排序同步：父表先写入、子表先删除，写入时保持外键检查
+	ForeignKeyOrder bool           `mapstructure:"foreign_key_order" json:"foreign_key_order,omitempty"`
+	Throttle        ThrottleConfig `mapstructure:"throttle" json:"throttle"` // 读取源库的限速
+}
+
+// ThrottleConfig 读取源库的限速，避免全量同步压垮与业务共用的源库。多个目标库共用一个源库时一起计算
+type ThrottleConfig struct {
+	RowsPerSecond     int `mapstructure:"rows_per_second" json:"rows_per_second,omitempty"`         // 所有表合计每秒从源库读取的行数上限，0 不限制
+	MaxThreadsRunning int `mapstructure:"max_threads_running" json:"max_threads_running,omitempty"` // 源库 Threads_running 超过时暂停读取，0 不检查
+	MaxReplicaLag     int `mapstructure:"max_replica_lag" json:"max_replica_lag,omitempty"`         // 源库是从库且复制延迟超过该秒数时暂停读取，0 不检查
+	CheckInterval     int `mapstructure:"check_interval" json:"check_interval"`                     // 检查源库负载的间隔（秒）
+}
+
+// TableDiscovery 按表名模式从源库发现要同步的表，发现的表使用默认的同步设置
+type TableDiscovery struct {
+	Tables   []string `mapstructure:"tables" json:"tables,omitempty"` // 表名模式：node_* 通配，/^log_\d+$/ 正则，! 开头为排除
+	Target   string   `mapstructure:"target" json:"target,omitempty"` // 目标表名模板，{table} 替换为源表名，为空时与源表同名
+	Interval int      `mapstructure:"interval" json:"interval"`       // 重新发现的间隔（秒）
+	// CreateIfMissing 发现的表目标表不存在时按源表创建，见 TablePair.CreateIfMissing
+	CreateIfMissing bool `mapstructure:"create_if_missing" json:"create_if_missing,omitempty"`
+}
+
+// BinlogConfig sync_mode 为 binlog 时的复制参数
+type BinlogConfig struct {
+	ServerID        uint32 `mapstructure:"server_id" json:"server_id"`               // 复制拓扑中唯一的 server_id
+	HeartbeatPeriod int    `mapstructure:"heartbeat_period" json:"heartbeat_period"` // 心跳间隔（秒）
+	FlushInterval   int    `mapstructure:"flush_interval" json:"flush_interval"`     // 最长多久写一次目标库并保存位点（秒）
+}
+
+// CheckpointConfig 同步检查点的保存位置
+type CheckpointConfig struct {
+	Store string `mapstructure:"store" json:"store"` // table: 目标库的 _sync_checkpoint 表；file: 本地文件
+	File  string `mapstructure:"file" json:"file"`   // store 为 file 时的文件路径
 }
 
 type TablePair struct {
-	Source      string `mapstructure:"source"`
-	Target      string `mapstructure:"target"`
-	CheckMethod string `mapstructure:"check_method"`
-	UpdateField string `mapstructure:"update_field"`
+	Source      string              `mapstructure:"source" json:"source"`
+	Target      string              `mapstructure:"target" json:"target"`
+	CheckMethod string              `mapstructure:"check_method" json:"check_method"`
+	UpdateField string              `mapstructure:"update_field" json:"update_field"`
+	Interval    int                 `mapstructure:"interval" json:"interval"` // 该表的同步间隔（秒），为 0 时使用 sync.interval
+	Cron        string              `mapstructure:"cron" json:"cron"`         // 该表的 cron 调度，与 interval 二选一
+	Columns     ColumnMapping       `mapstructure:"columns" json:"columns"`
+	Filter      string              `mapstructure:"filter" json:"filter,omitempty"` // 只同步满足条件的行，源表字段上的 SQL 条件
+	Mask        map[string]MaskRule `mapstructure:"mask" json:"mask,omitempty"`     // 源列名: 写入目标表前的脱敏规则
+	// Bidirectional 目标表的修改也写回源表，两边的修改都按 update_field 识别
+	Bidirectional bool   `mapstructure:"bidirectional" json:"bidirectional,omitempty"`
+	Conflict      string `mapstructure:"conflict" json:"conflict,omitempty"` // 两边都修改了同一行时: source_wins（默认）/ target_wins / newest / manual
+	// SchemaPolicy 目标表结构与源表不一致时: additive（默认）只添加缺失的字段、索引和主键 / all 全部修复 / alert 只告警
+	SchemaPolicy string `mapstructure:"schema_policy" json:"schema_policy,omitempty"`
+	// CreateIfMissing 目标表不存在时按源表的建表语句创建，Engine、Charset 覆盖源表的存储引擎和默认字符集
+	CreateIfMissing bool   `mapstructure:"create_if_missing" json:"create_if_missing,omitempty"`
+	Engine          string `mapstructure:"engine" json:"engine,omitempty"`
+	Charset         string `mapstructure:"charset" json:"charset,omitempty"`
+	// RowsPerSecond 该表每秒从源库读取的行数上限，0 不限制，同时受 sync.throttle.rows_per_second 限制
+	RowsPerSecond int `mapstructure:"rows_per_second" json:"rows_per_second,omitempty"`
+}
+
+// MaskRule 一个字段的脱敏规则
+type MaskRule struct {
+	Type       string `mapstructure:"type" json:"type"`                         // hash / redact / partial / fake / null
+	Length     int    `mapstructure:"length" json:"length,omitempty"`           // hash: 保留结果的前几位，0 表示完整的 64 位
+	Value      string `mapstructure:"value" json:"value,omitempty"`             // redact: 替换成的值，默认 ***
+	KeepPrefix int    `mapstructure:"keep_prefix" json:"keep_prefix,omitempty"` // partial: 保留开头的字符数
+	KeepSuffix int    `mapstructure:"keep_suffix" json:"keep_suffix,omitempty"` // partial: 保留末尾的字符数
+	Kind       string `mapstructure:"kind" json:"kind,omitempty"`               // fake: 生成的数据类型 name / email / phone
+}
+
+// ColumnMapping 表对的列映射。viper 会把 map 的键转成小写，列名按不区分大小写匹配
+type ColumnMapping struct {
+	Rename  map[string]string `mapstructure:"rename" json:"rename,omitempty"`   // 源列名: 目标列名
+	Exclude []string          `mapstructure:"exclude" json:"exclude,omitempty"` // 不同步的源列，例如密钥、大字段
+	Set     map[string]string `mapstructure:"set" json:"set,omitempty"`         // 只在目标表中的列: 在源库上计算的 SQL 表达式，常量要加引号
+}
+
+// cronParser 支持 5 段标准表达式、可选的秒字段以及 @every 5m、@hourly 等写法
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// ParseCron 解析表的 cron 调度表达式
+func ParseCron(spec string) (cron.Schedule, error) {
+	return cronParser.Parse(spec)
 }
 
 func LoadConfig(configPath string) (*Config, error) {
@@ -80,18 +184,40 @@ func LoadConfig(configPath string) (*Config, error) {
 func setDefaults(v *viper.Viper) {
 	v.SetDefault("server.port", 28081)
 	v.SetDefault("server.host", "0.0.0.0")
+	v.SetDefault("server.shutdown_timeout", 25)
 	v.SetDefault("sync.batch_size", 100)
 	v.SetDefault("sync.interval", 60)
+	v.SetDefault("sync.max_concurrency", 4)
+	v.SetDefault("sync.chunk_size", 1000)
+	v.SetDefault("sync.chunk_verify_interval", 86400)
+	v.SetDefault("sync.sync_mode", "incremental")
+	v.SetDefault("sync.binlog.server_id", 28081)
+	v.SetDefault("sync.binlog.heartbeat_period", 30)
+	v.SetDefault("sync.binlog.flush_interval", 1)
+	v.SetDefault("sync.checkpoint.store", "table")
+	v.SetDefault("sync.discovery.interval", 300)
+	v.SetDefault("sync.throttle.check_interval", 5)
+	v.SetDefault("sync.checkpoint.file", "sync_checkpoint.json")
 }
 
 func validateConfig(cfg *Config) error {
 	// 验证必要的配置项
-	if cfg.Database.Source.Password == "" {
+	if len(cfg.Database.Sources) == 0 && cfg.Database.Source.Password == "" {
 		return fmt.Errorf("source database password is required")
 	}
-	if cfg.Database.Target.Password == "" {
+	if len(cfg.Database.Targets) == 0 && cfg.Database.Target.Password == "" {
 		return fmt.Errorf("target database password is required")
 	}
+	if err := validateTargets(cfg); err != nil {
+		return err
+	}
+	if err := validateSources(cfg); err != nil {
+		return err
+	}
+
+	if cfg.Server.ShutdownTimeout <= 0 {
+		return fmt.Errorf("server shutdown_timeout must be greater than 0")
+	}
 
 	// 验证同步配置
 	if cfg.Sync.BatchSize <= 0 {
@@ -100,6 +226,46 @@ func validateConfig(cfg *Config) error {
 	if cfg.Sync.Interval <= 0 {
 		return fmt.Errorf("sync interval must be greater than 0")
 	}
+	if cfg.Sync.MaxConcurrency <= 0 {
+		return fmt.Errorf("max_concurrency must be greater than 0")
+	}
+	if cfg.Sync.ChunkSize <= 0 {
+		return fmt.Errorf("chunk_size must be greater than 0")
+	}
+	if cfg.Sync.ChunkVerifyInterval < 0 {
+		return fmt.Errorf("chunk_verify_interval must not be negative")
+	}
+	switch cfg.Sync.SyncMode {
+	case "full", "incremental":
+	case "binlog":
+		if cfg.Sync.Binlog.ServerID == 0 {
+			return fmt.Errorf("binlog server_id must be greater than 0")
+		}
+		if cfg.Sync.Binlog.FlushInterval <= 0 {
+			return fmt.Errorf("binlog flush_interval must be greater than 0")
+		}
+	default:
+		return fmt.Errorf("invalid sync_mode: %s", cfg.Sync.SyncMode)
+	}
+	switch cfg.Sync.Checkpoint.Store {
+	case "table":
+	case "file":
+		if cfg.Sync.Checkpoint.File == "" {
+			return fmt.Errorf("checkpoint file is required when checkpoint store is file")
+		}
+	default:
+		return fmt.Errorf("invalid checkpoint store: %s", cfg.Sync.Checkpoint.Store)
+	}
+
+	if err := validateDiscovery(cfg.Sync.Discovery); err != nil {
+		return err
+	}
+	if cfg.Sync.ForeignKeyOrder && cfg.Sync.SyncMode == "binlog" {
+		return fmt.Errorf("foreign_key_order is not supported in binlog mode")
+	}
+	if err := validateThrottle(cfg.Sync.Throttle); err != nil {
+		return err
+	}
 
 	// 添加表配置验证
 	for _, pair := range cfg.Sync.TablePairs {
@@ -111,9 +277,51 @@ func validateConfig(cfg *Config) error {
 			return fmt.Errorf("update_field is required when check_method is update_time")
 		}
 
+		if pair.Interval < 0 {
+			return fmt.Errorf("interval of table %s must not be negative", pair.Source)
+		}
+		if pair.Cron != "" {
+			if pair.Interval > 0 {
+				return fmt.Errorf("table %s: interval and cron are mutually exclusive", pair.Source)
+			}
+			if _, err := ParseCron(pair.Cron); err != nil {
+				return fmt.Errorf("invalid cron of table %s: %w", pair.Source, err)
+			}
+		}
+
+		// 按外键顺序同步时所有表按 sync.interval 一起调度
+		if cfg.Sync.ForeignKeyOrder && (pair.Interval > 0 || pair.Cron != "") {
+			return fmt.Errorf("table %s: interval and cron are not supported with foreign_key_order", pair.Source)
+		}
+
+		if err := validateColumnMapping(pair); err != nil {
+			return err
+		}
+		if err := validateFilter(pair.Filter); err != nil {
+			return fmt.Errorf("invalid filter of table %s: %w", pair.Source, err)
+		}
+		if err := validateMask(pair, cfg.Sync.MaskSalt); err != nil {
+			return err
+		}
+		if err := validateBidirectional(cfg, pair); err != nil {
+			return err
+		}
+		switch pair.SchemaPolicy {
+		case "", "additive", "all", "alert":
+		default:
+			return fmt.Errorf("invalid schema_policy of table %s: %s", pair.Source, pair.SchemaPolicy)
+		}
+		if err := validateCreateIfMissing(pair); err != nil {
+			return err
+		}
+		if pair.RowsPerSecond < 0 {
+			return fmt.Errorf("rows_per_second of table %s must not be negative", pair.Source)
+		}
+
 		if pair.CheckMethod != "checksum" &&
 			pair.CheckMethod != "count" &&
-			pair.CheckMethod != "update_time" {
+			pair.CheckMethod != "update_time" &&
+			pair.CheckMethod != "chunk_checksum" {
 			return fmt.Errorf("invalid check_method: %s", pair.CheckMethod)
 		}
 	}
@@ -121,6 +329,404 @@ func validateConfig(cfg *Config) error {
 	return nil
 }
 
+// validateTargets 检查多目标库配置：名称唯一，分配的表都在 table_pairs 中
+func validateTargets(cfg *Config) error {
+	sources := make(map[string]bool, len(cfg.Sync.TablePairs))
+	for _, pair := range cfg.Sync.TablePairs {
+		sources[pair.Source] = true
+	}
+
+	names := make(map[string]bool, len(cfg.Database.Targets))
+	for _, target := range cfg.Database.Targets {
+		if target.Name == "" {
+			return fmt.Errorf("target name must not be empty")
+		}
+		if names[target.Name] {
+			return fmt.Errorf("duplicate target name: %s", target.Name)
+		}
+		names[target.Name] = true
+
+		if target.Password == "" {
+			return fmt.Errorf("password of target %s is required", target.Name)
+		}
+		for _, table := range target.Tables {
+			if !sources[table] {
+				return fmt.Errorf("table %s of target %s is not in table_pairs", table, target.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// validateSources 检查多源库配置：名称唯一，必须配置 discriminator，不能同时配置多个目标库
+func validateSources(cfg *Config) error {
+	if len(cfg.Database.Sources) == 0 {
+		return nil
+	}
+	if len(cfg.Database.Targets) > 0 {
+		return fmt.Errorf("sources and targets must not be configured together")
+	}
+	if cfg.Sync.Discriminator == "" {
+		return fmt.Errorf("discriminator is required when sources are configured")
+	}
+
+	names := make(map[string]bool, len(cfg.Database.Sources))
+	for _, source := range cfg.Database.Sources {
+		if source.Name == "" {
+			return fmt.Errorf("source name must not be empty")
+		}
+		if names[source.Name] {
+			return fmt.Errorf("duplicate source name: %s", source.Name)
+		}
+		names[source.Name] = true
+		if source.Password == "" {
+			return fmt.Errorf("password of source %s is required", source.Name)
+		}
+	}
+
+	for _, pair := range cfg.Sync.TablePairs {
+		if _, ok := pair.Columns.Set[strings.ToLower(cfg.Sync.Discriminator)]; ok {
+			return fmt.Errorf("table %s: discriminator %s must not be a set column", pair.Source, cfg.Sync.Discriminator)
+		}
+	}
+	return nil
+}
+
+// ForSource 返回只读取源库 name 的配置：source 换成该源库，sources 只保留该源库（SourceName 返回其名称），
+// 检查点文件按源库区分
+func (c *Config) ForSource(name string) (*Config, error) {
+	for _, source := range c.Database.Sources {
+		if source.Name != name {
+			continue
+		}
+
+		cfg := *c
+		cfg.Database.Source = source.DBConnection
+		cfg.Database.Sources = []SourceConfig{source}
+		cfg.Sync.Checkpoint.File = suffixFile(c.Sync.Checkpoint.File, name)
+		return &cfg, nil
+	}
+	return nil, fmt.Errorf("源库 %s 不存在", name)
+}
+
+// SourceName 配置了 sources 且只有一个源库时返回它的名称（ForSource 返回的配置），否则为空
+func (c *Config) SourceName() string {
+	if len(c.Database.Sources) == 1 {
+		return c.Database.Sources[0].Name
+	}
+	return ""
+}
+
+// suffixFile 在文件扩展名前加上名称，例如 sync_checkpoint.json → sync_checkpoint.backup.json
+func suffixFile(path, name string) string {
+	if path == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + name + ext
+}
+
+// ForTarget 返回只同步到目标库 name 的配置：target 换成该目标库，table_pairs 只保留分配给它的表，
+// 检查点文件和 binlog server_id 按目标库区分，避免多个目标库互相覆盖
+func (c *Config) ForTarget(name string) (*Config, error) {
+	for i, target := range c.Database.Targets {
+		if target.Name != name {
+			continue
+		}
+
+		cfg := *c
+		cfg.Database.Target = target.DBConnection
+		cfg.Database.Targets = nil
+		cfg.Sync.Binlog.ServerID = c.Sync.Binlog.ServerID + uint32(i)
+		cfg.Sync.Checkpoint.File = suffixFile(c.Sync.Checkpoint.File, name)
+		if len(target.Tables) > 0 {
+			// 分配了表的目标库只同步这些表，不参与自动发现
+			cfg.Sync.Discovery.Tables = nil
+			cfg.Sync.TablePairs = nil
+			for _, pair := range c.Sync.TablePairs {
+				if slices.Contains(target.Tables, pair.Source) {
+					cfg.Sync.TablePairs = append(cfg.Sync.TablePairs, pair)
+				}
+			}
+		}
+		return &cfg, nil
+	}
+	return nil, fmt.Errorf("目标库 %s 不存在", name)
+}
+
+// validateColumnMapping 检查列映射自身是否矛盾，列是否存在要到读取表结构时才能检查
+func validateColumnMapping(pair TablePair) error {
+	mapping := pair.Columns
+	excluded := make(map[string]bool, len(mapping.Exclude))
+	for _, col := range mapping.Exclude {
+		excluded[strings.ToLower(col)] = true
+	}
+	if pair.UpdateField != "" && excluded[strings.ToLower(pair.UpdateField)] {
+		return fmt.Errorf("table %s: update_field %s must not be excluded", pair.Source, pair.UpdateField)
+	}
+
+	targets := make(map[string]string)
+	for from, to := range mapping.Rename {
+		if to == "" {
+			return fmt.Errorf("table %s: rename target of column %s must not be empty", pair.Source, from)
+		}
+		if excluded[strings.ToLower(from)] {
+			return fmt.Errorf("table %s: column %s is both renamed and excluded", pair.Source, from)
+		}
+		if other, ok := targets[strings.ToLower(to)]; ok {
+			return fmt.Errorf("table %s: columns %s and %s are both renamed to %s", pair.Source, other, from, to)
+		}
+		targets[strings.ToLower(to)] = from
+	}
+	for col, expr := range mapping.Set {
+		if expr == "" {
+			return fmt.Errorf("table %s: set expression of column %s must not be empty", pair.Source, col)
+		}
+		if from, ok := targets[strings.ToLower(col)]; ok {
+			return fmt.Errorf("table %s: column %s is both set and renamed from %s", pair.Source, col, from)
+		}
+	}
+	return nil
+}
+
+// validateMask 检查脱敏规则，主键字段能否脱敏要到读取表结构时才能检查
+func validateMask(pair TablePair, salt string) error {
+	excluded := make(map[string]bool, len(pair.Columns.Exclude))
+	for _, col := range pair.Columns.Exclude {
+		excluded[strings.ToLower(col)] = true
+	}
+	for col, rule := range pair.Mask {
+		if excluded[strings.ToLower(col)] {
+			return fmt.Errorf("table %s: column %s is both masked and excluded", pair.Source, col)
+		}
+		if strings.EqualFold(col, pair.UpdateField) {
+			return fmt.Errorf("table %s: update_field %s must not be masked", pair.Source, col)
+		}
+
+		switch rule.Type {
+		case "hash", "fake":
+			if salt == "" {
+				return fmt.Errorf("table %s: mask_salt is required by %s mask of column %s", pair.Source, rule.Type, col)
+			}
+			if rule.Type == "hash" && (rule.Length < 0 || rule.Length > 64) {
+				return fmt.Errorf("table %s: hash length of column %s must be between 0 and 64", pair.Source, col)
+			}
+			if rule.Type == "fake" && rule.Kind != "name" && rule.Kind != "email" && rule.Kind != "phone" {
+				return fmt.Errorf("table %s: invalid fake kind of column %s: %s", pair.Source, col, rule.Kind)
+			}
+		case "partial":
+			if rule.KeepPrefix < 0 || rule.KeepSuffix < 0 {
+				return fmt.Errorf("table %s: keep_prefix and keep_suffix of column %s must not be negative", pair.Source, col)
+			}
+		case "redact", "null":
+		default:
+			return fmt.Errorf("table %s: invalid mask type of column %s: %s", pair.Source, col, rule.Type)
+		}
+	}
+	return nil
+}
+
+// TableMatcher 按 discovery.tables 的模式匹配源表名：匹配任一包含模式、且不匹配任何排除模式的表
+type TableMatcher struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// NewTableMatcher 解析表名模式。! 开头为排除；/.../ 为正则，其他按通配符处理，* 匹配任意个字符，? 匹配一个字符
+func NewTableMatcher(patterns []string) (*TableMatcher, error) {
+	m := &TableMatcher{}
+	for _, pattern := range patterns {
+		exclude := strings.HasPrefix(pattern, "!")
+		expr := strings.TrimPrefix(pattern, "!")
+
+		var source string
+		if len(expr) >= 2 && strings.HasPrefix(expr, "/") && strings.HasSuffix(expr, "/") {
+			source = expr[1 : len(expr)-1]
+		} else if expr != "" {
+			source = "^" + strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(expr)) + "$"
+		} else {
+			return nil, fmt.Errorf("empty table pattern: %q", pattern)
+		}
+		re, err := regexp.Compile(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid table pattern %q: %w", pattern, err)
+		}
+
+		if exclude {
+			m.exclude = append(m.exclude, re)
+		} else {
+			m.include = append(m.include, re)
+		}
+	}
+	return m, nil
+}
+
+// Match 表是否需要同步
+func (m *TableMatcher) Match(table string) bool {
+	for _, re := range m.exclude {
+		if re.MatchString(table) {
+			return false
+		}
+	}
+	for _, re := range m.include {
+		if re.MatchString(table) {
+			return true
+		}
+	}
+	return false
+}
+
+// TargetName 按 discovery.target 模板得到源表对应的目标表名
+func (d TableDiscovery) TargetName(table string) string {
+	if d.Target == "" {
+		return table
+	}
+	return strings.ReplaceAll(d.Target, "{table}", table)
+}
+
+// validateDiscovery 检查自动发现的模式：至少有一个包含模式，模板需要带 {table}，否则多张表会写入同一个目标表
+func validateDiscovery(discovery TableDiscovery) error {
+	if len(discovery.Tables) == 0 {
+		return nil
+	}
+	matcher, err := NewTableMatcher(discovery.Tables)
+	if err != nil {
+		return fmt.Errorf("discovery: %w", err)
+	}
+	if len(matcher.include) == 0 {
+		return fmt.Errorf("discovery: at least one include pattern is required")
+	}
+	if discovery.Target != "" && !strings.Contains(discovery.Target, "{table}") {
+		return fmt.Errorf("discovery: target template must contain {table}")
+	}
+	if discovery.Interval <= 0 {
+		return fmt.Errorf("discovery interval must be greater than 0")
+	}
+	return nil
+}
+
+// validateThrottle 检查源库限速：上限和阈值不能为负数，需要检查负载时检查间隔大于 0
+func validateThrottle(throttle ThrottleConfig) error {
+	if throttle.RowsPerSecond < 0 || throttle.MaxThreadsRunning < 0 || throttle.MaxReplicaLag < 0 {
+		return fmt.Errorf("throttle rows_per_second, max_threads_running and max_replica_lag must not be negative")
+	}
+	if (throttle.MaxThreadsRunning > 0 || throttle.MaxReplicaLag > 0) && throttle.CheckInterval <= 0 {
+		return fmt.Errorf("throttle check_interval must be greater than 0")
+	}
+	return nil
+}
+
+// tableOption 建表时覆盖的存储引擎、字符集只能是标识符，原样拼进 CREATE TABLE
+var tableOption = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// validateCreateIfMissing 检查自动建表的配置：目标表按源表的结构创建，不支持列映射
+func validateCreateIfMissing(pair TablePair) error {
+	if !pair.CreateIfMissing {
+		if pair.Engine != "" || pair.Charset != "" {
+			return fmt.Errorf("table %s: engine and charset require create_if_missing", pair.Source)
+		}
+		return nil
+	}
+	mapping := pair.Columns
+	if len(mapping.Rename) > 0 || len(mapping.Exclude) > 0 || len(mapping.Set) > 0 {
+		return fmt.Errorf("table %s: create_if_missing is not supported with column mapping", pair.Source)
+	}
+	if pair.Engine != "" && !tableOption.MatchString(pair.Engine) {
+		return fmt.Errorf("table %s: invalid engine: %s", pair.Source, pair.Engine)
+	}
+	if pair.Charset != "" && !tableOption.MatchString(pair.Charset) {
+		return fmt.Errorf("table %s: invalid charset: %s", pair.Source, pair.Charset)
+	}
+	return nil
+}
+
+// validateBidirectional 检查双向同步的表对：写回源表需要两边的行一一对应，不支持列映射、脱敏和 filter
+func validateBidirectional(cfg *Config, pair TablePair) error {
+	if !pair.Bidirectional {
+		if pair.Conflict != "" {
+			return fmt.Errorf("table %s: conflict requires bidirectional", pair.Source)
+		}
+		return nil
+	}
+
+	switch pair.Conflict {
+	case "", "source_wins", "target_wins", "newest", "manual":
+	default:
+		return fmt.Errorf("table %s: invalid conflict policy: %s", pair.Source, pair.Conflict)
+	}
+	if pair.UpdateField == "" {
+		return fmt.Errorf("table %s: update_field is required by bidirectional sync", pair.Source)
+	}
+	if cfg.Sync.SyncMode == "binlog" {
+		return fmt.Errorf("table %s: bidirectional sync is not supported in binlog mode", pair.Source)
+	}
+	if len(cfg.Database.Sources) > 0 || len(cfg.Database.Targets) > 0 {
+		return fmt.Errorf("table %s: bidirectional sync is not supported with multiple sources or targets", pair.Source)
+	}
+	if len(pair.Columns.Rename) > 0 || len(pair.Columns.Exclude) > 0 || len(pair.Columns.Set) > 0 {
+		return fmt.Errorf("table %s: bidirectional sync does not support column mapping", pair.Source)
+	}
+	if len(pair.Mask) > 0 {
+		return fmt.Errorf("table %s: bidirectional sync does not support masking", pair.Source)
+	}
+	if pair.Filter != "" {
+		return fmt.Errorf("table %s: bidirectional sync does not support filter", pair.Source)
+	}
+	return nil
+}
+
+// validateFilter 检查 filter 能否作为一个完整的条件放进括号里：引号和括号成对，不含语句分隔符和注释。
+// 字段是否存在要到查询源表时才能检查
+func validateFilter(filter string) error {
+	if filter == "" {
+		return nil
+	}
+	if strings.TrimSpace(filter) == "" {
+		return fmt.Errorf("filter must not be blank")
+	}
+
+	depth := 0
+	var quote byte
+	for i := 0; i < len(filter); i++ {
+		c := filter[i]
+		if quote != 0 {
+			switch {
+			case c == '\\' && quote != '`':
+				i++
+			case c == quote:
+				quote = 0
+			}
+			continue
+		}
+
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth < 0 {
+				return fmt.Errorf("unbalanced parenthesis at offset %d", i)
+			}
+		case ';':
+			return fmt.Errorf("statement separator is not allowed")
+		case '#':
+			return fmt.Errorf("comments are not allowed")
+		case '-', '/':
+			if strings.HasPrefix(filter[i:], "--") || strings.HasPrefix(filter[i:], "/*") {
+				return fmt.Errorf("comments are not allowed")
+			}
+		}
+	}
+	if quote != 0 {
+		return fmt.Errorf("unterminated quoted string")
+	}
+	if depth != 0 {
+		return fmt.Errorf("unbalanced parenthesis")
+	}
+	return nil
+}
+
 // GetDSN 返回数据库连接字符串
 func (d *DBConnection) GetDSN() string {
 	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True",
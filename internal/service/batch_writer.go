@@ -0,0 +1,208 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxPlaceholders 单条预处理语句最多 65535 个参数
+	maxPlaceholders = 65535
+	// packetReserve 给语句头部和协议开销预留的字节数
+	packetReserve = 4 * 1024
+	// defaultMaxAllowedPacket 读取 max_allowed_packet 失败时使用 MySQL 的默认值
+	defaultMaxAllowedPacket = 64 * 1024 * 1024
+)
+
+// batchWriter 把一批记录写成多行 INSERT ... ON DUPLICATE KEY UPDATE，
+// 列顺序固定为目标表的字段顺序，单条语句的大小受 max_allowed_packet 限制
+type batchWriter struct {
+	table            string
+	tableColumns     []string // 目标表字段，按 ORDINAL_POSITION 排序
+	maxAllowedPacket int
+}
+
+// newBatchWriter 读取目标表字段顺序和 max_allowed_packet，创建写入器
+func (s *SyncService) newBatchWriter(targetTable string) (*batchWriter, error) {
+	return s.newBatchWriterOn(s.targetDB, targetTable)
+}
+
+// newBatchWriterOn 创建写入 db 中 table 的写入器，双向同步写回源表时使用
+func (s *SyncService) newBatchWriterOn(db *gorm.DB, table string) (*batchWriter, error) {
+	details, err := s.getColumnDetails(db, table)
+	if err != nil {
+		return nil, fmt.Errorf("获取表 %s 的字段失败: %w", table, err)
+	}
+
+	columns := make([]string, len(details))
+	for i, col := range details {
+		columns[i] = col.ColumnName
+	}
+
+	var maxAllowedPacket int
+	if err := db.Raw("SELECT @@max_allowed_packet").Scan(&maxAllowedPacket).Error; err != nil || maxAllowedPacket <= 0 {
+		log.Printf("警告: 无法读取 max_allowed_packet，使用默认值 %d: %v", defaultMaxAllowedPacket, err)
+		maxAllowedPacket = defaultMaxAllowedPacket
+	}
+
+	return &batchWriter{table: table, tableColumns: columns, maxAllowedPacket: maxAllowedPacket}, nil
+}
+
+// columnsOf 返回记录中需要写入的列：先按目标表字段顺序，目标表中不存在的列排在最后（写入时由 MySQL 报错）
+func (w *batchWriter) columnsOf(record map[string]interface{}) []string {
+	columns := make([]string, 0, len(record))
+	known := make(map[string]bool, len(w.tableColumns))
+	for _, col := range w.tableColumns {
+		known[col] = true
+		if _, ok := record[col]; ok {
+			columns = append(columns, col)
+		}
+	}
+
+	var unknown []string
+	for col := range record {
+		if !known[col] {
+			unknown = append(unknown, col)
+		}
+	}
+	sort.Strings(unknown)
+	return append(columns, unknown...)
+}
+
+// write 在 tx 中按语句大小拆分写入全部记录
+func (w *batchWriter) write(tx *gorm.DB, records []map[string]interface{}) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	columns := w.columnsOf(records[0])
+	header := w.statementHeader(columns)
+	rowsPerStatement := maxPlaceholders / len(columns)
+	budget := w.maxAllowedPacket - packetReserve - len(header)
+
+	start, size := 0, 0
+	for i, record := range records {
+		rowSize := estimateRowSize(record, columns)
+		if i > start && (i-start >= rowsPerStatement || size+rowSize > budget) {
+			if err := w.writeChunk(tx, columns, records[start:i]); err != nil {
+				return err
+			}
+			start, size = i, 0
+		}
+		size += rowSize
+	}
+	return w.writeChunk(tx, columns, records[start:])
+}
+
+// writeChunk 执行一条多行语句；失败时把这一段一分为二分别重试，
+// 已写入的部分不再重复写，最终定位到写不进去的那一行
+func (w *batchWriter) writeChunk(tx *gorm.DB, columns []string, records []map[string]interface{}) error {
+	const (
+		retryCount    = 3
+		baseDelay     = 100 * time.Millisecond
+		maxRetryDelay = 2 * time.Second
+	)
+
+	err := w.exec(tx, columns, records)
+	if err == nil {
+		return nil
+	}
+	if isDeadlock(err) {
+		// 死锁时 MySQL 已回滚整个事务，只能由上层重新执行整批
+		return err
+	}
+
+	if len(records) > 1 {
+		log.Printf("写入表 %s 的 %d 条记录失败，拆分后重试: %v", w.table, len(records), err)
+		mid := len(records) / 2
+		if err := w.writeChunk(tx, columns, records[:mid]); err != nil {
+			return err
+		}
+		return w.writeChunk(tx, columns, records[mid:])
+	}
+
+	// 单行仍然失败：使用指数退避重试，排除锁等待超时之类的临时错误
+	for attempt := 1; attempt < retryCount; attempt++ {
+		delay := time.Duration(float64(baseDelay) * math.Pow(2, float64(attempt-1)))
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+		log.Printf("同步记录失败，第 %d 次重试，等待 %v: %v", attempt, delay, err)
+		if err := sleepContext(tx.Statement.Context, delay); err != nil {
+			return err
+		}
+
+		if err = w.exec(tx, columns, records); err == nil || isDeadlock(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("更新记录失败: %w, 记录: %v", err, records[0])
+}
+
+func (w *batchWriter) exec(tx *gorm.DB, columns []string, records []map[string]interface{}) error {
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	rows := make([]string, len(records))
+	values := make([]interface{}, 0, len(records)*len(columns))
+	for i, record := range records {
+		rows[i] = row
+		for _, col := range columns {
+			values = append(values, record[col])
+		}
+	}
+
+	sql := w.statementHeader(columns) + strings.Join(rows, ", ") + w.statementTail(columns)
+	return tx.Exec(sql, values...).Error
+}
+
+// literalStatement 一行记录的完整写入语句，参数换成字面量，dry-run 输出本应执行的 SQL 时使用
+func (w *batchWriter) literalStatement(record map[string]interface{}) string {
+	columns := w.columnsOf(record)
+	values := make([]string, len(columns))
+	for i, col := range columns {
+		values[i] = sqlLiteral(record[col])
+	}
+	return w.statementHeader(columns) + "(" + strings.Join(values, ", ") + ")" + w.statementTail(columns) + ";"
+}
+
+func (w *batchWriter) statementHeader(columns []string) string {
+	return fmt.Sprintf("INSERT INTO `%s` (%s) VALUES ", w.table, quoteColumns(columns))
+}
+
+func (w *batchWriter) statementTail(columns []string) string {
+	updates := make([]string, len(columns))
+	for i, col := range columns {
+		updates[i] = fmt.Sprintf("`%s` = VALUES(`%s`)", col, col)
+	}
+	return " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+}
+
+// estimateRowSize 估算一行参数在协议包中占用的字节数
+func estimateRowSize(record map[string]interface{}, columns []string) int {
+	size := 0
+	for _, col := range columns {
+		switch v := record[col].(type) {
+		case nil:
+			size += 1
+		case string:
+			size += len(v) + 9
+		case []byte:
+			size += len(v) + 9
+		default:
+			size += 16
+		}
+	}
+	return size
+}
+
+func isDeadlock(err error) bool {
+	var mysqlErr *mysqldriver.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1213
+}
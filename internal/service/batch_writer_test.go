@@ -0,0 +1,64 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestBatchWriterColumnsOf(t *testing.T) {
+	writer := &batchWriter{table: "user", tableColumns: []string{"id", "name", "age"}}
+	got := writer.columnsOf(map[string]interface{}{"zz": 1, "age": 2, "id": 3, "aa": 4})
+	if want := []string{"id", "age", "aa", "zz"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("列顺序错误: %v", got)
+	}
+}
+
+func TestBatchWriterSplitsByPacketSize(t *testing.T) {
+	db, mock := newMockDB(t)
+
+	// 每行约 109 字节，预算只够放两行
+	writer := &batchWriter{table: "user", tableColumns: []string{"id", "name"}, maxAllowedPacket: packetReserve + 300}
+	records := make([]map[string]interface{}, 3)
+	for i := range records {
+		records[i] = map[string]interface{}{"id": int64(i + 1), "name": string(make([]byte, 84))}
+	}
+
+	mock.ExpectExec("INSERT INTO `user` \\(`id`, `name`\\) VALUES \\(\\?, \\?\\), \\(\\?, \\?\\) ON DUPLICATE KEY UPDATE `id` = VALUES\\(`id`\\), `name` = VALUES\\(`name`\\)").
+		WithArgs(int64(1), sqlmock.AnyArg(), int64(2), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO `user` \\(`id`, `name`\\) VALUES \\(\\?, \\?\\) ON DUPLICATE KEY UPDATE").
+		WithArgs(int64(3), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := writer.write(db, records); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("未满足的数据库期望: %v", err)
+	}
+}
+
+func TestBatchWriterRetriesBySplitting(t *testing.T) {
+	db, mock := newMockDB(t)
+
+	writer := &batchWriter{table: "user", tableColumns: []string{"id"}, maxAllowedPacket: defaultMaxAllowedPacket}
+	records := []map[string]interface{}{{"id": int64(1)}, {"id": int64(2)}, {"id": int64(3)}, {"id": int64(4)}}
+
+	// 整批失败后拆成两半，前一半写入成功后不再重写
+	mock.ExpectExec("INSERT INTO `user`").WithArgs(int64(1), int64(2), int64(3), int64(4)).
+		WillReturnError(errors.New("Lock wait timeout exceeded"))
+	mock.ExpectExec("INSERT INTO `user`").WithArgs(int64(1), int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO `user`").WithArgs(int64(3), int64(4)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	if err := writer.write(db, records); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("未满足的数据库期望: %v", err)
+	}
+}
@@ -0,0 +1,435 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// conflictTable 双向同步 conflict 为 manual 时记录冲突行的表，建在目标库
+const conflictTable = "_sync_conflict"
+
+// 双向同步中两边都修改了同一行时的处理方式
+const (
+	conflictSourceWins = "source_wins" // 源表的行覆盖目标表
+	conflictTargetWins = "target_wins" // 目标表的行覆盖源表
+	conflictNewest     = "newest"      // update_field 较新的一边覆盖另一边，相同时源表优先
+	conflictManual     = "manual"      // 两边都不改，记录到 _sync_conflict 等人工处理
+)
+
+// bidirectionalMarks 双向同步两边各自的水位，保存在检查点中
+type bidirectionalMarks struct {
+	Source bidirectionalMark `json:"source"`
+	Target bidirectionalMark `json:"target"`
+}
+
+// bidirectionalMark 一边的水位。两边数据库的时钟可能不一致，每边只用自己的行推进自己的水位；
+// 下一轮读取 update_field 不早于 UpdateTime 的行，Seen 记录其中已经处理过的行（主键 → 处理时的更新时间），
+// 包括水位上读到的行和写入这一边的行，这些行更新时间没变时不按修改处理
+type bidirectionalMark struct {
+	UpdateTime time.Time            `json:"update_time"`
+	Seen       map[string]time.Time `json:"seen,omitempty"`
+}
+
+// bidirectionalSide 双向同步的一边
+type bidirectionalSide struct {
+	name   string // 日志中的名称
+	db     *gorm.DB
+	table  string
+	writer *batchWriter      // 写入这一边的写入器，第一次写入时创建
+	since  bidirectionalMark // 上一轮的水位，UpdateTime 为零值表示第一轮，所有的行都按修改过处理；本轮写入这一边的行也记入 Seen
+	next   bidirectionalMark // 本轮推进后的水位
+}
+
+// bidirectionalSync 一轮双向同步：先把源表的修改写入目标表，再把目标表的修改写回源表。
+// 写入另一边时 update_field 原样写入并记入那一边的 Seen，下一轮读到时不按修改处理，不会把刚同步过去的修改再同步回来
+type bidirectionalSync struct {
+	service     *SyncService
+	task        *SyncTask
+	primaryKey  []string
+	columns     []string // 两边比较和写入的列，即源表的全部列
+	updateField string
+	policy      string
+	source      *bidirectionalSide
+	target      *bidirectionalSide
+	conflicts   int
+}
+
+// rowConflict 两边都修改过且不一致的一行
+type rowConflict struct {
+	key    []interface{}
+	source map[string]interface{}
+	target map[string]interface{}
+}
+
+// syncBidirectional 双向同步一张表，两边都按 update_field 识别上一轮之后修改过的行。
+// 删除不会同步，需要删除的行请使用软删除字段
+func (s *SyncService) syncBidirectional(task *SyncTask, columns []string) error {
+	tablePair := s.getTableConfig(task.SourceTable)
+	primaryKey, err := s.getPrimaryKey(s.sourceDB, task.SourceTable)
+	if err != nil {
+		return &SyncError{Phase: PhaseCheck, Err: err}
+	}
+
+	updateField := ""
+	for _, col := range columns {
+		if strings.EqualFold(col, tablePair.UpdateField) {
+			updateField = col
+		}
+	}
+	if updateField == "" {
+		return &SyncError{Phase: PhaseCheck, Err: fmt.Errorf("表 %s 的 update_field %s 在源表中不存在", task.SourceTable, tablePair.UpdateField)}
+	}
+
+	policy := tablePair.Conflict
+	if policy == "" {
+		policy = conflictSourceWins
+	}
+	checkpoint := task.checkpoint()
+	marks := bidirectionalMarks{Source: bidirectionalMark{UpdateTime: checkpoint.UpdateTime}, Target: bidirectionalMark{UpdateTime: checkpoint.UpdateTime}}
+	if checkpoint.Bidirectional != nil {
+		marks = *checkpoint.Bidirectional
+	}
+	b := &bidirectionalSync{
+		service:     s,
+		task:        task,
+		primaryKey:  primaryKey,
+		columns:     columns,
+		updateField: updateField,
+		policy:      policy,
+		source:      newBidirectionalSide("源表", s.sourceDB, task.SourceTable, marks.Source),
+		target:      newBidirectionalSide("目标表", s.targetDB, task.TargetTable, marks.Target),
+	}
+
+	if err := b.exchange(b.source, b.target); err != nil {
+		return &SyncError{Phase: PhaseCopy, Err: err}
+	}
+	if err := b.exchange(b.target, b.source); err != nil {
+		return &SyncError{Phase: PhaseCopy, Err: err}
+	}
+	if s.stopping() {
+		// 本轮没有做完，水位不前进，下一轮重新比较；已经一致的行会被跳过
+		return nil
+	}
+
+	task.mutex.Lock()
+	task.Checkpoint.UpdateTime = b.source.next.UpdateTime
+	task.Checkpoint.Bidirectional = &bidirectionalMarks{Source: b.source.next, Target: b.target.next}
+	task.mutex.Unlock()
+	if b.conflicts > 0 {
+		log.Printf("表 %s 本轮有 %d 行两边都已修改，按 %s 处理", task.SourceTable, b.conflicts, policy)
+	}
+	return nil
+}
+
+func newBidirectionalSide(name string, db *gorm.DB, table string, since bidirectionalMark) *bidirectionalSide {
+	// 检查点中的 Seen 可能还被其他地方引用，本轮写入的行记在副本中
+	seen := make(map[string]time.Time, len(since.Seen))
+	for key, updated := range since.Seen {
+		seen[key] = updated
+	}
+	since.Seen = seen
+	return &bidirectionalSide{
+		name:  name,
+		db:    db,
+		table: table,
+		since: since,
+		next:  bidirectionalMark{UpdateTime: since.UpdateTime, Seen: make(map[string]time.Time)},
+	}
+}
+
+// exchange 读取 from 中上一轮之后修改过的行，与 to 中的同一行比较：两边已经一致的跳过，
+// to 中的行不存在或没有修改时写入 to，两边都修改过时按冲突处理
+func (b *bidirectionalSync) exchange(from, to *bidirectionalSide) error {
+	s := b.service
+	var where string
+	var whereArgs []interface{}
+	if !from.since.UpdateTime.IsZero() {
+		// 水位上可能还有上一轮之后才写入的行，包含水位本身，已经处理过的行按 Seen 跳过
+		where = fmt.Sprintf("`%s` >= ?", b.updateField)
+		whereArgs = []interface{}{from.since.UpdateTime}
+	}
+
+	cursor := newKeysetCursor(from.table, b.primaryKey, b.task.BatchSize)
+	cursor.columns = b.columns
+	for {
+		if s.stopping() {
+			return nil
+		}
+
+		records, err := cursor.next(from.db, where, whereArgs...)
+		if err != nil {
+			return fmt.Errorf("读取%s修改的行失败: %w", from.name, err)
+		}
+		if len(records) == 0 {
+			return nil
+		}
+		if from.db == s.sourceDB {
+			s.throttleRead(b.task, len(records))
+		}
+
+		others, err := b.rowsByKey(to, records)
+		if err != nil {
+			return err
+		}
+
+		var toWrite, backWrite []map[string]interface{}
+		var conflicts []rowConflict
+		for _, record := range records {
+			key := keyOf(record, b.primaryKey)
+			changed, err := b.changed(from, record)
+			if err != nil {
+				return err
+			}
+			if err := b.see(from, record, changed); err != nil {
+				return err
+			}
+			if !changed {
+				// 已经处理过的行，另一边如果修改过，在读取另一边时处理
+				continue
+			}
+
+			other, ok := others[formatKey(key)]
+			if ok && len(changedColumns(record, other, b.columns)) == 0 {
+				continue
+			}
+			if !ok {
+				toWrite = append(toWrite, record)
+				continue
+			}
+			otherChanged, err := b.changed(to, other)
+			if err != nil {
+				return err
+			}
+			if !otherChanged {
+				toWrite = append(toWrite, record)
+				continue
+			}
+			if from == b.target {
+				// 两边都修改过的行在读取源表修改时已经处理
+				continue
+			}
+
+			b.conflicts++
+			winner, err := b.resolve(record, other)
+			if err != nil {
+				return err
+			}
+			switch winner {
+			case conflictSourceWins:
+				toWrite = append(toWrite, record)
+			case conflictTargetWins:
+				backWrite = append(backWrite, other)
+			default:
+				conflicts = append(conflicts, rowConflict{key: key, source: record, target: other})
+			}
+		}
+
+		if err := b.write(to, toWrite); err != nil {
+			return err
+		}
+		if err := b.write(from, backWrite); err != nil {
+			return err
+		}
+		if err := s.recordConflicts(b.task, conflicts); err != nil {
+			return err
+		}
+	}
+}
+
+// rowsByKey 按主键读取另一边的同一批行，key 为 formatKey 的结果
+func (b *bidirectionalSync) rowsByKey(side *bidirectionalSide, records []map[string]interface{}) (map[string]map[string]interface{}, error) {
+	keys := make([][]interface{}, len(records))
+	for i, record := range records {
+		keys[i] = keyOf(record, b.primaryKey)
+	}
+	condition, args := buildKeyCondition(b.primaryKey, keys)
+
+	var rows []map[string]interface{}
+	if err := side.db.Table(side.table).Select(quoteColumns(b.columns)).Where(condition, args...).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("读取%s的对应行失败: %w", side.name, err)
+	}
+	byKey := make(map[string]map[string]interface{}, len(rows))
+	for _, row := range rows {
+		byKey[formatKey(keyOf(row, b.primaryKey))] = row
+	}
+	return byKey, nil
+}
+
+// changed side 中的行是否在上一轮之后修改过：更新时间不早于上一轮的水位，并且不是已经处理过的行；
+// 第一轮除了本轮写入的行，所有的行都按修改过处理
+func (b *bidirectionalSync) changed(side *bidirectionalSide, record map[string]interface{}) (bool, error) {
+	updated, err := b.updateTime(record)
+	if err != nil {
+		return false, err
+	}
+	if !side.since.UpdateTime.IsZero() && updated.Before(side.since.UpdateTime) {
+		return false, nil
+	}
+	key, err := encodeCheckpointKey(keyOf(record, b.primaryKey))
+	if err != nil {
+		return false, err
+	}
+	seen, ok := side.since.Seen[string(key)]
+	return !ok || !seen.Equal(updated), nil
+}
+
+// see 记录 side 中读到或写入的一行。修改过的行推进本轮的水位；所有不早于水位的行记入 Seen，
+// 水位前进后早于水位的行下一轮不会再读到，从 Seen 中去掉
+func (b *bidirectionalSync) see(side *bidirectionalSide, record map[string]interface{}, advance bool) error {
+	updated, err := b.updateTime(record)
+	if err != nil {
+		return err
+	}
+	key, err := encodeCheckpointKey(keyOf(record, b.primaryKey))
+	if err != nil {
+		return err
+	}
+	next := &side.next
+	if advance && updated.After(next.UpdateTime) {
+		next.UpdateTime = updated
+		for k, t := range next.Seen {
+			if t.Before(updated) {
+				delete(next.Seen, k)
+			}
+		}
+	}
+	if !updated.Before(next.UpdateTime) {
+		next.Seen[string(key)] = updated
+	}
+	return nil
+}
+
+// updateTime 读取行的 update_field，NULL 返回零值
+func (b *bidirectionalSync) updateTime(record map[string]interface{}) (time.Time, error) {
+	switch v := record[b.updateField].(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return v, nil
+	default:
+		return time.Time{}, fmt.Errorf("表 %s 的 update_field %s 不是时间类型: %T", b.task.SourceTable, b.updateField, v)
+	}
+}
+
+// resolve 按 conflict 决定两边都修改过的行以哪一边为准，manual 时返回 conflictManual
+func (b *bidirectionalSync) resolve(source, target map[string]interface{}) (string, error) {
+	if b.policy != conflictNewest {
+		return b.policy, nil
+	}
+	sourceTime, err := b.updateTime(source)
+	if err != nil {
+		return "", err
+	}
+	targetTime, err := b.updateTime(target)
+	if err != nil {
+		return "", err
+	}
+	if targetTime.After(sourceTime) {
+		return conflictTargetWins, nil
+	}
+	return conflictSourceWins, nil
+}
+
+// write 把行写入 side，update_field 随行原样写入
+func (b *bidirectionalSync) write(side *bidirectionalSide, records []map[string]interface{}) error {
+	if len(records) == 0 {
+		return nil
+	}
+	s := b.service
+	if side.writer == nil {
+		writer, err := s.newBatchWriterOn(side.db, side.table)
+		if err != nil {
+			return err
+		}
+		side.writer = writer
+	}
+	if err := s.writeBatch(side.db, side.writer, records, nil); err != nil {
+		return fmt.Errorf("写入%s失败: %w", side.name, err)
+	}
+	// 写入的行带着另一边的更新时间，记为已处理，之后读到时不按这一边的修改处理，也不推进这一边的水位
+	for _, record := range records {
+		key, err := encodeCheckpointKey(keyOf(record, b.primaryKey))
+		if err != nil {
+			return err
+		}
+		updated, err := b.updateTime(record)
+		if err != nil {
+			return err
+		}
+		side.since.Seen[string(key)] = updated
+		if err := b.see(side, record, false); err != nil {
+			return err
+		}
+	}
+	s.notifyRowsUpserted(b.task, len(records))
+	return nil
+}
+
+// recordConflicts 把冲突行记录到目标库的 _sync_conflict 表，同一行只保留最近一次检测到的两边的值。
+// 人工修改任意一边后该行的更新时间前进，下一轮按普通修改同步
+func (s *SyncService) recordConflicts(task *SyncTask, conflicts []rowConflict) error {
+	if len(conflicts) == 0 {
+		return nil
+	}
+	if s.dryRun != nil {
+		s.dryRun.report.Conflicts += int64(len(conflicts))
+		return nil
+	}
+
+	err := s.targetDB.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` ("+
+		"source_table VARCHAR(191) NOT NULL, "+
+		"row_key VARCHAR(512) NOT NULL, "+
+		"target_table VARCHAR(191) NOT NULL, "+
+		"source_row LONGTEXT NULL, "+
+		"target_row LONGTEXT NULL, "+
+		"detected_at DATETIME NOT NULL, "+
+		"PRIMARY KEY (source_table, row_key))", conflictTable)).Error
+	if err != nil {
+		return fmt.Errorf("创建冲突表失败: %w", err)
+	}
+
+	now := time.Now()
+	for _, conflict := range conflicts {
+		key, err := encodeCheckpointKey(conflict.key)
+		if err != nil {
+			return err
+		}
+		source, err := rowJSON(conflict.source)
+		if err != nil {
+			return err
+		}
+		target, err := rowJSON(conflict.target)
+		if err != nil {
+			return err
+		}
+
+		err = s.targetDB.Exec(fmt.Sprintf("INSERT INTO `%s` "+
+			"(source_table, row_key, target_table, source_row, target_row, detected_at) VALUES (?, ?, ?, ?, ?, ?) "+
+			"ON DUPLICATE KEY UPDATE target_table = VALUES(target_table), source_row = VALUES(source_row), "+
+			"target_row = VALUES(target_row), detected_at = VALUES(detected_at)", conflictTable),
+			task.SourceTable, string(key), task.TargetTable, source, target, now).Error
+		if err != nil {
+			return fmt.Errorf("记录表 %s 主键 %v 的冲突失败: %w", task.SourceTable, conflict.key, err)
+		}
+		log.Printf("警告: 表 %s 主键 %v 两边都已修改，已记录到 %s 等待人工处理", task.SourceTable, conflict.key, conflictTable)
+	}
+	return nil
+}
+
+// rowJSON 把一行编码为 JSON，[]byte 和时间按 MySQL 的文本形式
+func rowJSON(record map[string]interface{}) (string, error) {
+	row := make(map[string]interface{}, len(record))
+	for col, v := range record {
+		row[col] = normalizeKey([]interface{}{v})[0]
+	}
+	data, err := json.Marshal(row)
+	if err != nil {
+		return "", fmt.Errorf("编码冲突行失败: %w", err)
+	}
+	return string(data), nil
+}
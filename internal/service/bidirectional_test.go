@@ -0,0 +1,195 @@
+package service
+
+import (
+	"database/sql/driver"
+	"sync/internal/config"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSyncBidirectional(t *testing.T) {
+	sourceDB, sourceMock := newMockDB(t)
+	targetDB, targetMock := newMockDB(t)
+
+	cfg := &config.Config{}
+	cfg.Sync.TablePairs = []config.TablePair{{Source: "user", Target: "user_backup", UpdateField: "updated_at", Bidirectional: true, Conflict: "manual"}}
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	before, t1, t2, t3 := since.Add(-time.Hour), since.Add(time.Minute), since.Add(2*time.Minute), since.Add(3*time.Minute)
+	task := &SyncTask{SourceTable: "user", TargetTable: "user_backup", BatchSize: 10, Checkpoint: Checkpoint{UpdateTime: since}}
+	s := &SyncService{sourceDB: sourceDB, targetDB: targetDB, config: cfg, tasks: map[string]*SyncTask{"user": task}}
+	userRows := func() *sqlmock.Rows { return sqlmock.NewRows([]string{"id", "name", "updated_at"}) }
+	userColumns := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE"}).
+			AddRow("id", "bigint").AddRow("name", "varchar(64)").AddRow("updated_at", "datetime")
+	}
+
+	sourceMock.ExpectQuery("INFORMATION_SCHEMA.STATISTICS").WithArgs("user").
+		WillReturnRows(primaryKeyRows("PRIMARY", "id"))
+
+	// 源表修改了 1、2、3：目标表 1 没改，写入目标表；2 两边都改了，记录冲突；3 两边已经一致
+	sourceMock.ExpectQuery("SELECT `id`, `name`, `updated_at` FROM `user` WHERE `updated_at` >= \\? ORDER BY `id` LIMIT \\?").
+		WithArgs(since, 10).
+		WillReturnRows(userRows().AddRow(1, "alice", t1).AddRow(2, "bob", t1).AddRow(3, "carol", t1))
+	targetMock.ExpectQuery("SELECT `id`, `name`, `updated_at` FROM `user_backup` WHERE `id` IN \\(\\?, \\?, \\?\\)").
+		WithArgs(int64(1), int64(2), int64(3)).
+		WillReturnRows(userRows().AddRow(1, "alice_old", before).AddRow(2, "bobby", t2).AddRow(3, "carol", t1))
+	targetMock.ExpectQuery("INFORMATION_SCHEMA.COLUMNS").WithArgs("user_backup").WillReturnRows(userColumns())
+	targetMock.ExpectQuery("SELECT @@max_allowed_packet").
+		WillReturnRows(sqlmock.NewRows([]string{"@@max_allowed_packet"}).AddRow(4194304))
+	targetMock.ExpectBegin()
+	targetMock.ExpectExec("SET FOREIGN_KEY_CHECKS = 0").WillReturnResult(sqlmock.NewResult(0, 0))
+	targetMock.ExpectExec("INSERT INTO `user_backup` \\(`id`, `name`, `updated_at`\\) VALUES \\(\\?, \\?, \\?\\) ON DUPLICATE KEY UPDATE").
+		WithArgs(int64(1), "alice", t1).WillReturnResult(sqlmock.NewResult(0, 2))
+	targetMock.ExpectCommit()
+	targetMock.ExpectExec("CREATE TABLE IF NOT EXISTS `_sync_conflict`").WillReturnResult(sqlmock.NewResult(0, 0))
+	targetMock.ExpectExec("INSERT INTO `_sync_conflict`").
+		WithArgs("user", "[2]", "user_backup", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// 目标表修改了 1、2、4：1 是刚同步过去的行，2 已按冲突处理，4 只在目标表修改过，写回源表
+	targetMock.ExpectQuery("SELECT `id`, `name`, `updated_at` FROM `user_backup` WHERE `updated_at` >= \\? ORDER BY `id` LIMIT \\?").
+		WithArgs(since, 10).
+		WillReturnRows(userRows().AddRow(1, "alice", t1).AddRow(2, "bobby", t2).AddRow(4, "dave", t3))
+	sourceMock.ExpectQuery("SELECT `id`, `name`, `updated_at` FROM `user` WHERE `id` IN \\(\\?, \\?, \\?\\)").
+		WithArgs(int64(1), int64(2), int64(4)).
+		WillReturnRows(userRows().AddRow(1, "alice", t1).AddRow(2, "bob", t1).AddRow(4, "dan", before))
+	sourceMock.ExpectQuery("INFORMATION_SCHEMA.COLUMNS").WithArgs("user").WillReturnRows(userColumns())
+	sourceMock.ExpectQuery("SELECT @@max_allowed_packet").
+		WillReturnRows(sqlmock.NewRows([]string{"@@max_allowed_packet"}).AddRow(4194304))
+	sourceMock.ExpectBegin()
+	sourceMock.ExpectExec("SET FOREIGN_KEY_CHECKS = 0").WillReturnResult(sqlmock.NewResult(0, 0))
+	sourceMock.ExpectExec("INSERT INTO `user` \\(`id`, `name`, `updated_at`\\) VALUES \\(\\?, \\?, \\?\\) ON DUPLICATE KEY UPDATE").
+		WithArgs(int64(4), "dave", t3).WillReturnResult(sqlmock.NewResult(0, 2))
+	sourceMock.ExpectCommit()
+
+	if err := s.syncBidirectional(task, []string{"id", "name", "updated_at"}); err != nil {
+		t.Fatalf("双向同步失败: %v", err)
+	}
+	// 两边的水位各自前进到这一边修改过的行的最大更新时间，写入的行不推进水位
+	marks := task.Checkpoint.Bidirectional
+	if marks == nil || !marks.Source.UpdateTime.Equal(t1) || !marks.Target.UpdateTime.Equal(t3) {
+		t.Fatalf("水位错误: %+v", marks)
+	}
+	if !task.Checkpoint.UpdateTime.Equal(t1) {
+		t.Errorf("检查点的更新时间应为源表的水位: %v", task.Checkpoint.UpdateTime)
+	}
+	if len(marks.Source.Seen) != 4 || !marks.Source.Seen["[4]"].Equal(t3) || len(marks.Target.Seen) != 1 {
+		t.Errorf("水位上已处理的行错误: %+v", marks)
+	}
+
+	if err := sourceMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("源库期望未满足: %v", err)
+	}
+	if err := targetMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("目标库期望未满足: %v", err)
+	}
+}
+
+func TestSyncBidirectionalEqualTimestamps(t *testing.T) {
+	sourceDB, sourceMock := newMockDB(t)
+	targetDB, targetMock := newMockDB(t)
+
+	cfg := &config.Config{}
+	cfg.Sync.TablePairs = []config.TablePair{{Source: "user", Target: "user_backup", UpdateField: "updated_at", Bidirectional: true}}
+	// 源库的时钟比目标库快一小时，两边的水位各自独立
+	sourceMark := time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC)
+	targetMark := sourceMark.Add(-time.Hour)
+	task := &SyncTask{SourceTable: "user", TargetTable: "user_backup", BatchSize: 10, Checkpoint: Checkpoint{
+		UpdateTime: sourceMark,
+		Bidirectional: &bidirectionalMarks{
+			Source: bidirectionalMark{UpdateTime: sourceMark, Seen: map[string]time.Time{"[1]": sourceMark}},
+			Target: bidirectionalMark{UpdateTime: targetMark, Seen: map[string]time.Time{"[2]": targetMark}},
+		},
+	}}
+	s := &SyncService{sourceDB: sourceDB, targetDB: targetDB, config: cfg, tasks: map[string]*SyncTask{"user": task}}
+	userRows := func() *sqlmock.Rows { return sqlmock.NewRows([]string{"id", "name", "updated_at"}) }
+	userColumns := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE"}).
+			AddRow("id", "bigint").AddRow("name", "varchar(64)").AddRow("updated_at", "datetime")
+	}
+	expectWrite := func(mock sqlmock.Sqlmock, table string, args ...driver.Value) {
+		mock.ExpectQuery("INFORMATION_SCHEMA.COLUMNS").WithArgs(table).WillReturnRows(userColumns())
+		mock.ExpectQuery("SELECT @@max_allowed_packet").
+			WillReturnRows(sqlmock.NewRows([]string{"@@max_allowed_packet"}).AddRow(4194304))
+		mock.ExpectBegin()
+		mock.ExpectExec("SET FOREIGN_KEY_CHECKS = 0").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO `" + table + "`").WithArgs(args...).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+
+	sourceMock.ExpectQuery("INFORMATION_SCHEMA.STATISTICS").WithArgs("user").
+		WillReturnRows(primaryKeyRows("PRIMARY", "id"))
+
+	// 源表水位上的 1 上一轮已经处理过，跳过；5 在上一轮读取之后才写入，更新时间和水位相同，照常同步
+	sourceMock.ExpectQuery("SELECT `id`, `name`, `updated_at` FROM `user` WHERE `updated_at` >= \\? ORDER BY `id` LIMIT \\?").
+		WithArgs(sourceMark, 10).
+		WillReturnRows(userRows().AddRow(1, "alice", sourceMark).AddRow(5, "eve", sourceMark))
+	targetMock.ExpectQuery("SELECT `id`, `name`, `updated_at` FROM `user_backup` WHERE `id` IN \\(\\?, \\?\\)").
+		WithArgs(int64(1), int64(5)).
+		WillReturnRows(userRows().AddRow(1, "alice", targetMark.Add(-time.Minute)))
+	expectWrite(targetMock, "user_backup", int64(5), "eve", sourceMark)
+
+	// 目标表：2 已经处理过；5 是刚写入的行，带着源库时钟的更新时间，不推进目标表的水位；6 和水位相同，是新的修改
+	targetMock.ExpectQuery("SELECT `id`, `name`, `updated_at` FROM `user_backup` WHERE `updated_at` >= \\? ORDER BY `id` LIMIT \\?").
+		WithArgs(targetMark, 10).
+		WillReturnRows(userRows().AddRow(2, "bob", targetMark).AddRow(5, "eve", sourceMark).AddRow(6, "frank", targetMark))
+	sourceMock.ExpectQuery("SELECT `id`, `name`, `updated_at` FROM `user` WHERE `id` IN \\(\\?, \\?, \\?\\)").
+		WithArgs(int64(2), int64(5), int64(6)).
+		WillReturnRows(userRows().AddRow(2, "bob", targetMark).AddRow(5, "eve", sourceMark))
+	expectWrite(sourceMock, "user", int64(6), "frank", targetMark)
+
+	if err := s.syncBidirectional(task, []string{"id", "name", "updated_at"}); err != nil {
+		t.Fatalf("双向同步失败: %v", err)
+	}
+
+	marks := task.Checkpoint.Bidirectional
+	if !marks.Source.UpdateTime.Equal(sourceMark) || !marks.Target.UpdateTime.Equal(targetMark) {
+		t.Errorf("水位不应被另一边时钟的更新时间推进: %+v", marks)
+	}
+	// 写回源表的 6 早于源表的水位，下一轮不会再读到
+	if len(marks.Source.Seen) != 2 || !marks.Source.Seen["[5]"].Equal(sourceMark) {
+		t.Errorf("源表水位上已处理的行错误: %v", marks.Source.Seen)
+	}
+	if len(marks.Target.Seen) != 3 || !marks.Target.Seen["[5]"].Equal(sourceMark) || !marks.Target.Seen["[6]"].Equal(targetMark) {
+		t.Errorf("目标表水位上已处理的行错误: %v", marks.Target.Seen)
+	}
+
+	if err := sourceMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("源库期望未满足: %v", err)
+	}
+	if err := targetMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("目标库期望未满足: %v", err)
+	}
+}
+
+func TestResolveConflict(t *testing.T) {
+	older, newer := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	b := &bidirectionalSync{task: &SyncTask{SourceTable: "user"}, updateField: "updated_at"}
+
+	tests := []struct {
+		policy         string
+		source, target time.Time
+		want           string
+	}{
+		{conflictSourceWins, older, newer, conflictSourceWins},
+		{conflictTargetWins, newer, older, conflictTargetWins},
+		{conflictNewest, older, newer, conflictTargetWins},
+		{conflictNewest, newer, older, conflictSourceWins},
+		{conflictNewest, older, older, conflictSourceWins},
+		{conflictManual, older, newer, conflictManual},
+	}
+	for _, tt := range tests {
+		b.policy = tt.policy
+		got, err := b.resolve(map[string]interface{}{"updated_at": tt.source}, map[string]interface{}{"updated_at": tt.target})
+		if err != nil || got != tt.want {
+			t.Errorf("%s: 源表 %v、目标表 %v 应以 %s 为准，实际 %s %v", tt.policy, tt.source, tt.target, tt.want, got, err)
+		}
+	}
+
+	b.policy = conflictNewest
+	if _, err := b.resolve(map[string]interface{}{"updated_at": "2024-01-01"}, map[string]interface{}{"updated_at": newer}); err == nil {
+		t.Errorf("update_field 不是时间类型时应返回错误")
+	}
+}
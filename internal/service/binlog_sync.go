@@ -0,0 +1,558 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync/internal/binlog"
+	"time"
+)
+
+// binlogPositionTable 保存 binlog 位点的表（建在目标库）
+const binlogPositionTable = "_sync_binlog_position"
+
+// binlogTableInfo 把 binlog 行镜像的列下标映射到列名和主键
+type binlogTableInfo struct {
+	columns    []ColumnDetail
+	primaryKey []string
+	keyIndexes []int // 主键列在行镜像中的下标
+	mapping    *columnMap
+	targetKey  []string // 主键在目标表中的列名
+}
+
+// pendingKey 一个主键最后一次变更的结果：删除或者需要回源重读
+type pendingKey struct {
+	values []interface{}
+	delete bool
+}
+
+// pendingTable 一张表待写入的变更
+type pendingTable struct {
+	primaryKey []string
+	targetKey  []string
+	mapping    *columnMap
+	keys       map[string]pendingKey
+}
+
+// binlogApplier 汇总已提交事务中的行变更，按表批量写入目标库
+type binlogApplier struct {
+	service *SyncService
+	tables  map[string]*binlogTableInfo
+	writers map[string]*batchWriter  // key: targetTable
+	pending map[string]*pendingTable // key: sourceTable
+	rows    int
+}
+
+// startBinlogSync 读取源库 binlog，把行变更实时应用到目标库，断线后从已保存的位点重连
+func (s *SyncService) startBinlogSync(ctx context.Context) error {
+	if err := s.ensureBinlogPositionTable(); err != nil {
+		return err
+	}
+
+	const retryDelay = 5 * time.Second
+	for {
+		err := s.runBinlogSync(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.Printf("binlog 同步中断，%v 后从上次保存的位点重连: %v", retryDelay, err)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+func (s *SyncService) runBinlogSync(ctx context.Context) error {
+	pos, found, err := s.loadBinlogPosition()
+	if err != nil {
+		return err
+	}
+	if !found {
+		// 首次启动：先记下当前位点再做一次全量同步，之后从该位点追 binlog，
+		// 全量期间发生的变更会被重放一次，写入是幂等的
+		if pos, err = s.currentBinlogPosition(); err != nil {
+			return err
+		}
+		log.Printf("未找到已保存的 binlog 位点，从 %s 开始，先执行一次全量同步", pos)
+
+		s.syncAll()
+		if s.stopping() {
+			// 全量同步被退出信号打断，不保存位点，下次启动重新做
+			return ctx.Err()
+		}
+		for _, task := range s.tasks {
+			task.mutex.RLock()
+			failed := task.Status == "error"
+			task.mutex.RUnlock()
+			if failed {
+				return fmt.Errorf("表 %s 初始全量同步失败", task.SourceTable)
+			}
+		}
+
+		if err := s.saveBinlogPosition(pos); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("开始从 %s 读取 binlog", pos)
+	streamer, err := s.dialBinlog(ctx, pos)
+	if err != nil {
+		return fmt.Errorf("建立 binlog 连接失败: %w", err)
+	}
+	defer streamer.Close()
+
+	applier := &binlogApplier{
+		service: s,
+		tables:  make(map[string]*binlogTableInfo),
+		writers: make(map[string]*batchWriter),
+		pending: make(map[string]*pendingTable),
+	}
+
+	flushInterval := time.Duration(s.config.Sync.Binlog.FlushInterval) * time.Second
+	lastFlush := time.Now()
+	atCommit := true // 只有在事务边界才能保存位点
+
+	flush := func() error {
+		if err := applier.flush(); err != nil {
+			return err
+		}
+		lastFlush = time.Now()
+		return s.saveBinlogPosition(pos)
+	}
+
+	for {
+		waitCtx, cancel := context.WithTimeout(ctx, flushInterval)
+		event, err := streamer.GetEvent(waitCtx)
+		cancel()
+
+		if err != nil {
+			if ctx.Err() != nil {
+				// 收到退出信号：已提交事务的变更写入并保存位点后再退出
+				if atCommit && applier.rows > 0 {
+					if err := flush(); err != nil {
+						return err
+					}
+				}
+				return ctx.Err()
+			}
+			if errors.Is(err, context.DeadlineExceeded) {
+				// 源库空闲时也要把已提交的变更及时写入
+				if atCommit && applier.rows > 0 {
+					if err := flush(); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			return err
+		}
+
+		switch {
+		case event.Rows != nil:
+			atCommit = false
+			if err := applier.add(event.Rows); err != nil {
+				return err
+			}
+
+		case event.Commit:
+			atCommit = true
+			pos = event.Position
+			if applier.rows >= s.config.Sync.BatchSize || time.Since(lastFlush) >= flushInterval {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+
+		case event.Query != "":
+			// DDL 自带隐式提交，表结构可能已变化，清空列信息和写入器缓存
+			atCommit = true
+			pos = event.Position
+			if err := flush(); err != nil {
+				return err
+			}
+			applier.tables = make(map[string]*binlogTableInfo)
+			applier.writers = make(map[string]*batchWriter)
+		}
+	}
+}
+
+// add 记录一个行事件中涉及的主键，同一主键只保留最后一次变更
+func (a *binlogApplier) add(event *binlog.RowsEvent) error {
+	s := a.service
+	if event.Schema != s.config.Database.Source.Database || len(event.Changes) == 0 {
+		return nil
+	}
+	s.mutex.RLock()
+	_, ok := s.tasks[event.Table]
+	s.mutex.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	info, err := a.tableInfo(event.Table, event)
+	if err != nil {
+		return err
+	}
+
+	pending := a.pending[event.Table]
+	if pending == nil {
+		pending = &pendingTable{primaryKey: info.primaryKey, targetKey: info.targetKey, mapping: info.mapping, keys: make(map[string]pendingKey)}
+		a.pending[event.Table] = pending
+	}
+	record := func(values []interface{}, delete bool) {
+		pending.keys[formatKey(values)] = pendingKey{values: values, delete: delete}
+		a.rows++
+	}
+
+	for _, change := range event.Changes {
+		switch event.Action {
+		case binlog.Insert:
+			values, ok := info.keyValues(change.After, change.AfterPresent)
+			if !ok {
+				return fmt.Errorf("表 %s 的 binlog 行镜像中缺少主键列", event.Table)
+			}
+			record(values, false)
+
+		case binlog.Delete:
+			values, ok := info.keyValues(change.Before, change.BeforePresent)
+			if !ok {
+				return fmt.Errorf("表 %s 的 binlog 行镜像中缺少主键列", event.Table)
+			}
+			record(values, true)
+
+		case binlog.Update:
+			before, ok := info.keyValues(change.Before, change.BeforePresent)
+			if !ok {
+				return fmt.Errorf("表 %s 的 binlog 行镜像中缺少主键列", event.Table)
+			}
+			// binlog_row_image=MINIMAL 时 after 镜像只包含被修改的列
+			after, ok := info.keyValues(change.After, change.AfterPresent)
+			if ok && formatKey(after) != formatKey(before) {
+				record(before, true)
+				record(after, false)
+			} else {
+				record(before, false)
+			}
+		}
+	}
+	return nil
+}
+
+// tableInfo 获取并缓存源表的列顺序和主键，列数和 binlog 不一致时重新加载一次
+func (a *binlogApplier) tableInfo(table string, event *binlog.RowsEvent) (*binlogTableInfo, error) {
+	columnCount := len(event.Changes[0].Before)
+	if columnCount == 0 {
+		columnCount = len(event.Changes[0].After)
+	}
+
+	if info, ok := a.tables[table]; ok && len(info.columns) == columnCount {
+		return info, nil
+	}
+
+	s := a.service
+	columns, err := s.getColumnDetails(s.sourceDB, table)
+	if err != nil {
+		return nil, fmt.Errorf("获取源表 %s 字段失败: %w", table, err)
+	}
+	if len(columns) != columnCount {
+		return nil, fmt.Errorf("源表 %s 当前有 %d 列，binlog 行镜像有 %d 列", table, len(columns), columnCount)
+	}
+	primaryKey, err := s.getPrimaryKey(s.sourceDB, table)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.ColumnName
+	}
+	mapping, err := s.columnMapFor(table, names)
+	if err != nil {
+		return nil, err
+	}
+	targetKey, err := mapping.targetKey(table, primaryKey)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &binlogTableInfo{columns: columns, primaryKey: primaryKey, mapping: mapping, targetKey: targetKey}
+	for _, name := range primaryKey {
+		for i, col := range columns {
+			if col.ColumnName == name {
+				info.keyIndexes = append(info.keyIndexes, i)
+				break
+			}
+		}
+	}
+	a.tables[table] = info
+	return info, nil
+}
+
+// keyValues 从行镜像中取出主键值
+func (t *binlogTableInfo) keyValues(row binlog.Row, present []bool) ([]interface{}, bool) {
+	if len(t.keyIndexes) != len(t.primaryKey) {
+		return nil, false
+	}
+	values := make([]interface{}, 0, len(t.keyIndexes))
+	for _, idx := range t.keyIndexes {
+		if idx >= len(row) || !present[idx] {
+			return nil, false
+		}
+		values = append(values, normalizeUnsigned(row[idx], t.columns[idx].ColumnType))
+	}
+	return values, true
+}
+
+// normalizeUnsigned 源库没有开启 binlog 列符号元数据时，无符号整数会被当作有符号数解码
+func normalizeUnsigned(v interface{}, columnType string) interface{} {
+	n, ok := v.(int64)
+	if !ok || n >= 0 || !strings.Contains(columnType, "unsigned") {
+		return v
+	}
+
+	switch {
+	case strings.HasPrefix(columnType, "tinyint"):
+		return uint64(n + 1<<8)
+	case strings.HasPrefix(columnType, "smallint"):
+		return uint64(n + 1<<16)
+	case strings.HasPrefix(columnType, "mediumint"):
+		return uint64(n + 1<<24)
+	case strings.HasPrefix(columnType, "int"):
+		return uint64(n + 1<<32)
+	default:
+		return uint64(n)
+	}
+}
+
+func formatKey(values []interface{}) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprintf("%v", v)
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// flush 把汇总的变更写入目标库：新增/修改的行按主键回源重读后 upsert，删除的行按主键删除
+func (a *binlogApplier) flush() error {
+	s := a.service
+	for table, pending := range a.pending {
+		s.mutex.RLock()
+		task := s.tasks[table]
+		s.mutex.RUnlock()
+
+		s.notifyStart(task)
+		if err := a.applyTable(task, pending); err != nil {
+			s.notifyError(task, PhaseCopy, err)
+			return err
+		}
+
+		task.mutex.Lock()
+		task.Status = "completed"
+		task.mutex.Unlock()
+		s.notifyComplete(task)
+	}
+
+	a.pending = make(map[string]*pendingTable)
+	a.rows = 0
+	return nil
+}
+
+func (a *binlogApplier) applyTable(task *SyncTask, pending *pendingTable) error {
+	s := a.service
+	primaryKey := pending.primaryKey
+	var upserts, deletes [][]interface{}
+	for _, k := range pending.keys {
+		if k.delete {
+			deletes = append(deletes, k.values)
+		} else {
+			upserts = append(upserts, k.values)
+		}
+	}
+
+	batchSize := task.BatchSize
+	for start := 0; start < len(upserts); start += batchSize {
+		end := min(start+batchSize, len(upserts))
+		condition, args := buildKeyCondition(primaryKey, upserts[start:end])
+
+		// 回源读取当前值；已被后续事务删除的行读不到，交给之后的删除事件处理；
+		// 不满足 filter 的行不写入，目标表中已有的旧版本保留
+		var records []map[string]interface{}
+		if err := s.filteredSource(s.sourceDB, task.SourceTable).Select(pending.mapping.selects()).Where(condition, args...).Find(&records).Error; err != nil {
+			return fmt.Errorf("读取源表变更记录失败: %w", err)
+		}
+		writer, err := a.writer(task.TargetTable)
+		if err != nil {
+			return err
+		}
+		if err := s.syncBatchData(writer, pending.mapping.apply(records), nil); err != nil {
+			return err
+		}
+		s.notifyRowsUpserted(task, len(records))
+	}
+
+	if len(deletes) > 0 {
+		deleted, err := s.deleteTargetKeys(task, pending.targetKey, deletes)
+		if err != nil {
+			return err
+		}
+		s.notifyRowsDeleted(task, deleted)
+	}
+
+	return nil
+}
+
+// writer 返回目标表的批量写入器；目标表字段顺序变化后，新增的列会排在最后写入，缓存不会写错数据
+func (a *binlogApplier) writer(targetTable string) (*batchWriter, error) {
+	if writer, ok := a.writers[targetTable]; ok {
+		return writer, nil
+	}
+	writer, err := a.service.newBatchWriter(targetTable)
+	if err != nil {
+		return nil, err
+	}
+	a.writers[targetTable] = writer
+	return writer, nil
+}
+
+// buildKeyCondition 构建 `pk` IN (...) 或 (`a`, `b`) IN ((...), ...) 条件
+func buildKeyCondition(primaryKey []string, keys [][]interface{}) (string, []interface{}) {
+	placeholder := "?"
+	columns := quoteColumns(primaryKey)
+	if len(primaryKey) > 1 {
+		placeholder = "(" + strings.TrimSuffix(strings.Repeat("?, ", len(primaryKey)), ", ") + ")"
+		columns = "(" + columns + ")"
+	}
+
+	placeholders := make([]string, len(keys))
+	args := make([]interface{}, 0, len(keys)*len(primaryKey))
+	for i, key := range keys {
+		placeholders[i] = placeholder
+		args = append(args, key...)
+	}
+
+	return fmt.Sprintf("%s IN (%s)", columns, strings.Join(placeholders, ", ")), args
+}
+
+func (s *SyncService) binlogPositionName() string {
+	if s.source != "" {
+		return s.source
+	}
+	src := s.config.Database.Source
+	return fmt.Sprintf("%s:%d", src.Host, src.Port)
+}
+
+func (s *SyncService) ensureBinlogPositionTable() error {
+	err := s.targetDB.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` ("+
+		"name VARCHAR(191) NOT NULL PRIMARY KEY, "+
+		"binlog_file VARCHAR(255) NOT NULL, "+
+		"binlog_pos BIGINT UNSIGNED NOT NULL, "+
+		"binlog_gtid_set TEXT NULL, "+
+		"updated_at DATETIME NOT NULL)", binlogPositionTable)).Error
+	if err != nil {
+		return fmt.Errorf("创建 binlog 位点表失败: %w", err)
+	}
+
+	// 之前版本建的位点表没有 GTID 集合
+	var count int64
+	err = s.targetDB.Raw(`
+		SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = 'binlog_gtid_set'`, binlogPositionTable).Scan(&count).Error
+	if err != nil {
+		return fmt.Errorf("检查 binlog 位点表结构失败: %w", err)
+	}
+	if count == 0 {
+		err = s.targetDB.Exec(fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN binlog_gtid_set TEXT NULL AFTER binlog_pos", binlogPositionTable)).Error
+		if err != nil {
+			return fmt.Errorf("为 binlog 位点表添加 GTID 字段失败: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *SyncService) loadBinlogPosition() (binlog.Position, bool, error) {
+	var row struct {
+		BinlogFile    string
+		BinlogPos     uint32
+		BinlogGtidSet sql.NullString
+	}
+	result := s.targetDB.Raw(fmt.Sprintf("SELECT binlog_file, binlog_pos, binlog_gtid_set FROM `%s` WHERE name = ?", binlogPositionTable),
+		s.binlogPositionName()).Scan(&row)
+	if result.Error != nil {
+		return binlog.Position{}, false, fmt.Errorf("读取 binlog 位点失败: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return binlog.Position{}, false, nil
+	}
+	return binlog.Position{File: row.BinlogFile, Pos: row.BinlogPos, GTIDSet: row.BinlogGtidSet.String}, true, nil
+}
+
+func (s *SyncService) saveBinlogPosition(pos binlog.Position) error {
+	err := s.targetDB.Exec(fmt.Sprintf("INSERT INTO `%s` (name, binlog_file, binlog_pos, binlog_gtid_set, updated_at) VALUES (?, ?, ?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE binlog_file = VALUES(binlog_file), binlog_pos = VALUES(binlog_pos), "+
+		"binlog_gtid_set = VALUES(binlog_gtid_set), updated_at = VALUES(updated_at)",
+		binlogPositionTable), s.binlogPositionName(), pos.File, pos.Pos, pos.GTIDSet, time.Now()).Error
+	if err != nil {
+		return fmt.Errorf("保存 binlog 位点失败: %w", err)
+	}
+	return nil
+}
+
+// currentBinlogPosition 查询源库当前的 binlog 位点，并确认源库使用 ROW 格式。
+// 源库 gtid_mode 为 ON 时同时记下已执行的 GTID 集合，之后按 GTID 续传
+func (s *SyncService) currentBinlogPosition() (binlog.Position, error) {
+	var format string
+	if err := s.sourceDB.Raw("SELECT @@global.binlog_format").Scan(&format).Error; err != nil {
+		return binlog.Position{}, fmt.Errorf("查询 binlog_format 失败: %w", err)
+	}
+	if !strings.EqualFold(format, "ROW") {
+		return binlog.Position{}, fmt.Errorf("源库 binlog_format 为 %s，binlog 模式要求 ROW", format)
+	}
+
+	rows, err := s.sourceDB.Raw("SHOW MASTER STATUS").Rows()
+	if err != nil {
+		return binlog.Position{}, fmt.Errorf("查询源库 binlog 位点失败: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return binlog.Position{}, err
+	}
+	if !rows.Next() {
+		return binlog.Position{}, errors.New("源库未开启 binlog")
+	}
+
+	var pos binlog.Position
+	var gtidSet sql.NullString
+	dest := make([]interface{}, len(columns))
+	for i, column := range columns {
+		if strings.EqualFold(column, "Executed_Gtid_Set") {
+			dest[i] = &gtidSet
+		} else {
+			dest[i] = new(interface{})
+		}
+	}
+	dest[0], dest[1] = &pos.File, &pos.Pos
+	if err := rows.Scan(dest...); err != nil {
+		return binlog.Position{}, fmt.Errorf("解析源库 binlog 位点失败: %w", err)
+	}
+	rows.Close()
+
+	// gtid_mode 为 OFF 时源库拒绝按 GTID dump；MySQL 5.5 没有这个变量，查不到行
+	var mode struct {
+		Value string
+	}
+	if err := s.sourceDB.Raw("SHOW GLOBAL VARIABLES LIKE 'gtid_mode'").Scan(&mode).Error; err != nil {
+		return binlog.Position{}, fmt.Errorf("查询 gtid_mode 失败: %w", err)
+	}
+	if strings.EqualFold(mode.Value, "ON") {
+		pos.GTIDSet = strings.Join(strings.Fields(gtidSet.String), "")
+	}
+	return pos, nil
+}
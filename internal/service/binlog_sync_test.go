@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync/internal/binlog"
+	"sync/internal/config"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeStreamer 进程内的 binlog 替身，按顺序返回预先构造的事件
+type fakeStreamer struct {
+	events []*binlog.Event
+}
+
+var errStreamEnd = errors.New("binlog 替身事件已耗尽")
+
+func (f *fakeStreamer) GetEvent(ctx context.Context) (*binlog.Event, error) {
+	if len(f.events) == 0 {
+		return nil, errStreamEnd
+	}
+	event := f.events[0]
+	f.events = f.events[1:]
+	return event, nil
+}
+
+func (f *fakeStreamer) Close() error { return nil }
+
+func newMockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("创建模拟数据库失败: %v", err)
+	}
+	t.Cleanup(func() { mockDB.Close() })
+
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      mockDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	return db, mock
+}
+
+func TestRunBinlogSync(t *testing.T) {
+	sourceDB, sourceMock := newMockDB(t)
+	targetDB, targetMock := newMockDB(t)
+
+	cfg := &config.Config{}
+	cfg.Database.Source = config.DBConnection{Host: "mysql", Port: 3306, Database: "haios_db"}
+	cfg.Sync.BatchSize = 1
+	cfg.Sync.SyncMode = "binlog"
+	cfg.Sync.Binlog.FlushInterval = 1
+
+	file := "mysql-bin.000003"
+	uuid := "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	streamer := &fakeStreamer{events: []*binlog.Event{
+		{Position: binlog.Position{File: file, Pos: 200}, Rows: &binlog.RowsEvent{
+			Schema: "haios_db", Table: "user", Action: binlog.Insert,
+			Changes: []binlog.RowChange{{After: binlog.Row{int64(1), "alice"}, AfterPresent: []bool{true, true}}},
+		}},
+		// 其他库、未配置的表应被忽略
+		{Position: binlog.Position{File: file, Pos: 250}, Rows: &binlog.RowsEvent{
+			Schema: "other_db", Table: "user", Action: binlog.Delete,
+			Changes: []binlog.RowChange{{Before: binlog.Row{int64(9), "x"}, BeforePresent: []bool{true, true}}},
+		}},
+		{Position: binlog.Position{File: file, Pos: 300, GTIDSet: uuid + ":1-6"}, Commit: true},
+		{Position: binlog.Position{File: file, Pos: 400}, Rows: &binlog.RowsEvent{
+			Schema: "haios_db", Table: "user", Action: binlog.Delete,
+			Changes: []binlog.RowChange{{Before: binlog.Row{int64(2), "bob"}, BeforePresent: []bool{true, true}}},
+		}},
+		{Position: binlog.Position{File: file, Pos: 500, GTIDSet: uuid + ":1-7"}, Commit: true},
+	}}
+
+	s := &SyncService{
+		sourceDB: sourceDB,
+		targetDB: targetDB,
+		config:   cfg,
+		tasks:    map[string]*SyncTask{"user": {SourceTable: "user", TargetTable: "user_backup", BatchSize: 1}},
+		dialBinlog: func(ctx context.Context, pos binlog.Position) (binlog.Streamer, error) {
+			if pos.File != file || pos.Pos != 100 || pos.GTIDSet != uuid+":1-5" {
+				t.Errorf("应从已保存的位点开始，实际为 %s", pos)
+			}
+			return streamer, nil
+		},
+	}
+
+	targetMock.ExpectQuery("SELECT binlog_file, binlog_pos, binlog_gtid_set FROM `_sync_binlog_position`").
+		WillReturnRows(sqlmock.NewRows([]string{"binlog_file", "binlog_pos", "binlog_gtid_set"}).AddRow(file, 100, uuid+":1-5"))
+
+	sourceMock.ExpectQuery("INFORMATION_SCHEMA.COLUMNS").WithArgs("user").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE"}).
+			AddRow("id", "bigint").AddRow("name", "varchar(64)"))
+	sourceMock.ExpectQuery("INFORMATION_SCHEMA.STATISTICS").WithArgs("user").
+		WillReturnRows(primaryKeyRows("PRIMARY", "id"))
+
+	// 第一个事务：回源读取 id=1 后写入目标表，再保存位点
+	sourceMock.ExpectQuery("SELECT `id`, `name` FROM `user` WHERE `id` IN \\(\\?\\)").WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "alice"))
+	targetMock.ExpectQuery("INFORMATION_SCHEMA.COLUMNS").WithArgs("user_backup").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE"}).
+			AddRow("id", "bigint").AddRow("name", "varchar(64)"))
+	targetMock.ExpectQuery("SELECT @@max_allowed_packet").
+		WillReturnRows(sqlmock.NewRows([]string{"@@max_allowed_packet"}).AddRow(4194304))
+	targetMock.ExpectBegin()
+	targetMock.ExpectExec("SET FOREIGN_KEY_CHECKS = 0").WillReturnResult(sqlmock.NewResult(0, 0))
+	targetMock.ExpectExec("INSERT INTO `user_backup` \\(`id`, `name`\\) VALUES \\(\\?, \\?\\) ON DUPLICATE KEY UPDATE").
+		WithArgs(int64(1), "alice").WillReturnResult(sqlmock.NewResult(1, 1))
+	targetMock.ExpectCommit()
+	targetMock.ExpectExec("INSERT INTO `_sync_binlog_position`").
+		WithArgs("mysql:3306", file, uint32(300), uuid+":1-6", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// 第二个事务：删除 id=2
+	targetMock.ExpectBegin()
+	targetMock.ExpectExec("SET FOREIGN_KEY_CHECKS = 0").WillReturnResult(sqlmock.NewResult(0, 0))
+	targetMock.ExpectExec("DELETE FROM `user_backup` WHERE `id` IN \\(\\?\\)").WithArgs(int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	targetMock.ExpectCommit()
+	targetMock.ExpectExec("INSERT INTO `_sync_binlog_position`").
+		WithArgs("mysql:3306", file, uint32(500), uuid+":1-7", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := s.runBinlogSync(context.Background()); !errors.Is(err, errStreamEnd) {
+		t.Fatalf("期望在替身事件耗尽时返回，实际: %v", err)
+	}
+
+	if err := sourceMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("源库期望未满足: %v", err)
+	}
+	if err := targetMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("目标库期望未满足: %v", err)
+	}
+}
+
+func TestBuildKeyCondition(t *testing.T) {
+	condition, args := buildKeyCondition([]string{"id"}, [][]interface{}{{1}, {2}})
+	if condition != "`id` IN (?, ?)" || len(args) != 2 {
+		t.Errorf("单列主键条件错误: %s %v", condition, args)
+	}
+
+	condition, args = buildKeyCondition([]string{"user_id", "group_id"}, [][]interface{}{{1, 2}, {3, 4}})
+	if condition != "(`user_id`, `group_id`) IN ((?, ?), (?, ?))" || len(args) != 4 {
+		t.Errorf("联合主键条件错误: %s %v", condition, args)
+	}
+}
@@ -0,0 +1,377 @@
+package service
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/internal/config"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const checkpointTable = "_sync_checkpoint"
+
+// Checkpoint 单个表的同步进度，保存在目标库的 _sync_checkpoint 表或本地文件中，重启后从这里继续
+type Checkpoint struct {
+	SourceTable string `json:"source_table"`
+	TargetTable string `json:"target_table"`
+	// UpdateTime、PrimaryKey 为已提交的水位：update_time 增量同步时是最后写入行的 (更新时间, 主键)，
+	// 其他方式只记录本轮已写到的主键，一轮跑完后清空，下一轮从头开始
+	UpdateTime    time.Time     `json:"update_time"`
+	PrimaryKey    []interface{} `json:"primary_key,omitempty"`
+	LastSuccessAt time.Time     `json:"last_success_at"`
+	LastError     string        `json:"last_error,omitempty"`
+	LastErrorAt   time.Time     `json:"last_error_at"`
+	// Bidirectional 双向同步两边各自的水位，UpdateTime 同源表一边的水位；其他方式为空
+	Bidirectional *bidirectionalMarks `json:"bidirectional,omitempty"`
+}
+
+// checkpointStore 检查点存储
+type checkpointStore interface {
+	load() (map[string]*Checkpoint, error) // key: sourceTable
+	// save 保存检查点，tx 不为空时随目标库事务一起提交
+	save(tx *gorm.DB, cp *Checkpoint) error
+	// transactional 检查点能否和数据写在同一个目标库事务中
+	transactional() bool
+}
+
+// newCheckpointStore source 为源库名称，多个源库汇总到同一个目标库时各自使用 _sync_checkpoint_{source} 表
+func newCheckpointStore(cfg config.CheckpointConfig, targetDB *gorm.DB, source string) checkpointStore {
+	if cfg.Store == "file" {
+		return &fileCheckpointStore{path: cfg.File}
+	}
+	store := &tableCheckpointStore{db: targetDB}
+	if source != "" {
+		store.table = checkpointTable + "_" + source
+	}
+	return store
+}
+
+// loadCheckpoints 读取所有表的检查点，目标表已改名的检查点作废
+func (s *SyncService) loadCheckpoints() error {
+	tasks := make([]*SyncTask, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		tasks = append(tasks, task)
+	}
+	return s.restoreCheckpoints(tasks)
+}
+
+// restoreCheckpoints 读取检查点并恢复给定的表
+func (s *SyncService) restoreCheckpoints(tasks []*SyncTask) error {
+	if s.checkpoints == nil || len(tasks) == 0 {
+		return nil
+	}
+
+	checkpoints, err := s.checkpoints.load()
+	if err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		cp, ok := checkpoints[task.SourceTable]
+		if !ok || cp.TargetTable != task.TargetTable {
+			continue
+		}
+
+		task.mutex.Lock()
+		task.Checkpoint = *cp
+		if !cp.LastSuccessAt.IsZero() {
+			task.LastSyncTime = cp.LastSuccessAt.Unix()
+		}
+		task.mutex.Unlock()
+		if cp.PrimaryKey != nil {
+			log.Printf("表 %s 将从检查点继续同步: 更新时间 %v, 主键 %v", task.SourceTable, cp.UpdateTime, cp.PrimaryKey)
+		}
+	}
+	return nil
+}
+
+func (s *SyncService) saveCheckpoint(tx *gorm.DB, cp *Checkpoint) error {
+	if s.checkpoints == nil {
+		return nil
+	}
+	if err := s.checkpoints.save(tx, cp); err != nil {
+		return fmt.Errorf("保存表 %s 的检查点失败: %w", cp.SourceTable, err)
+	}
+	return nil
+}
+
+// checkpoint 返回任务检查点的副本
+func (t *SyncTask) checkpoint() Checkpoint {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	cp := t.Checkpoint
+	if cp.PrimaryKey != nil {
+		cp.PrimaryKey = append([]interface{}{}, cp.PrimaryKey...)
+	}
+	return cp
+}
+
+// ----------------------------- 目标库表存储 -----------------------------
+
+type tableCheckpointStore struct {
+	db    *gorm.DB
+	table string // 为空时使用 _sync_checkpoint
+}
+
+func (st *tableCheckpointStore) name() string {
+	if st.table != "" {
+		return st.table
+	}
+	return checkpointTable
+}
+
+func (st *tableCheckpointStore) load() (map[string]*Checkpoint, error) {
+	err := st.db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` ("+
+		"source_table VARCHAR(191) NOT NULL PRIMARY KEY, "+
+		"target_table VARCHAR(191) NOT NULL, "+
+		"update_time DATETIME(6) NULL, "+
+		"primary_key TEXT NULL, "+
+		"bidirectional TEXT NULL, "+
+		"last_success_at DATETIME NULL, "+
+		"last_error TEXT NULL, "+
+		"last_error_at DATETIME NULL, "+
+		"updated_at DATETIME NOT NULL)", st.name())).Error
+	if err != nil {
+		return nil, fmt.Errorf("创建检查点表失败: %w", err)
+	}
+
+	// 之前版本建的检查点表没有双向同步的水位
+	var count int64
+	err = st.db.Raw(`
+		SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = 'bidirectional'`, st.name()).Scan(&count).Error
+	if err != nil {
+		return nil, fmt.Errorf("检查检查点表结构失败: %w", err)
+	}
+	if count == 0 {
+		err = st.db.Exec(fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN bidirectional TEXT NULL AFTER primary_key", st.name())).Error
+		if err != nil {
+			return nil, fmt.Errorf("为检查点表添加双向同步水位字段失败: %w", err)
+		}
+	}
+
+	var rows []struct {
+		SourceTable   string
+		TargetTable   string
+		UpdateTime    sql.NullTime
+		PrimaryKey    sql.NullString
+		Bidirectional sql.NullString
+		LastSuccessAt sql.NullTime
+		LastError     sql.NullString
+		LastErrorAt   sql.NullTime
+	}
+	if err := st.db.Raw(fmt.Sprintf("SELECT source_table, target_table, update_time, primary_key, bidirectional, "+
+		"last_success_at, last_error, last_error_at FROM `%s`", st.name())).Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("读取检查点失败: %w", err)
+	}
+
+	checkpoints := make(map[string]*Checkpoint, len(rows))
+	for _, row := range rows {
+		cp := &Checkpoint{
+			SourceTable:   row.SourceTable,
+			TargetTable:   row.TargetTable,
+			UpdateTime:    row.UpdateTime.Time,
+			LastSuccessAt: row.LastSuccessAt.Time,
+			LastError:     row.LastError.String,
+			LastErrorAt:   row.LastErrorAt.Time,
+		}
+		if row.PrimaryKey.Valid {
+			key, err := decodeCheckpointKey([]byte(row.PrimaryKey.String))
+			if err != nil {
+				return nil, fmt.Errorf("解析表 %s 的检查点主键失败: %w", row.SourceTable, err)
+			}
+			cp.PrimaryKey = key
+		}
+		if row.Bidirectional.Valid {
+			cp.Bidirectional = &bidirectionalMarks{}
+			if err := json.Unmarshal([]byte(row.Bidirectional.String), cp.Bidirectional); err != nil {
+				return nil, fmt.Errorf("解析表 %s 的双向同步水位失败: %w", row.SourceTable, err)
+			}
+		}
+		checkpoints[cp.SourceTable] = cp
+	}
+	return checkpoints, nil
+}
+
+func (st *tableCheckpointStore) save(tx *gorm.DB, cp *Checkpoint) error {
+	db := tx
+	if db == nil {
+		db = st.db
+	}
+
+	var primaryKey interface{}
+	if cp.PrimaryKey != nil {
+		data, err := encodeCheckpointKey(cp.PrimaryKey)
+		if err != nil {
+			return err
+		}
+		primaryKey = string(data)
+	}
+	var bidirectional interface{}
+	if cp.Bidirectional != nil {
+		data, err := json.Marshal(cp.Bidirectional)
+		if err != nil {
+			return fmt.Errorf("编码双向同步水位失败: %w", err)
+		}
+		bidirectional = string(data)
+	}
+	var lastError interface{}
+	if cp.LastError != "" {
+		lastError = cp.LastError
+	}
+
+	return db.Exec(fmt.Sprintf("INSERT INTO `%s` (source_table, target_table, update_time, primary_key, bidirectional, "+
+		"last_success_at, last_error, last_error_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE target_table = VALUES(target_table), update_time = VALUES(update_time), "+
+		"primary_key = VALUES(primary_key), bidirectional = VALUES(bidirectional), last_success_at = VALUES(last_success_at), "+
+		"last_error = VALUES(last_error), last_error_at = VALUES(last_error_at), updated_at = VALUES(updated_at)",
+		st.name()),
+		cp.SourceTable, cp.TargetTable, nullTime(cp.UpdateTime), primaryKey, bidirectional,
+		nullTime(cp.LastSuccessAt), lastError, nullTime(cp.LastErrorAt), time.Now()).Error
+}
+
+func (st *tableCheckpointStore) transactional() bool { return true }
+
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// ----------------------------- 本地文件存储 -----------------------------
+
+// fileCheckpointStore 把所有检查点保存在一个 JSON 文件中，先写临时文件再改名，避免写到一半时进程退出
+type fileCheckpointStore struct {
+	path        string
+	mutex       sync.Mutex
+	checkpoints map[string]*Checkpoint
+}
+
+type checkpointFile struct {
+	Checkpoints map[string]*Checkpoint `json:"checkpoints"`
+}
+
+func (st *fileCheckpointStore) load() (map[string]*Checkpoint, error) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	st.checkpoints = make(map[string]*Checkpoint)
+	data, err := os.ReadFile(st.path)
+	if os.IsNotExist(err) {
+		return st.copyCheckpoints(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取检查点文件失败: %w", err)
+	}
+
+	var file checkpointFile
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("解析检查点文件失败: %w", err)
+	}
+	for table, cp := range file.Checkpoints {
+		cp.PrimaryKey = normalizeDecodedKey(cp.PrimaryKey)
+		st.checkpoints[table] = cp
+	}
+	return st.copyCheckpoints(), nil
+}
+
+func (st *fileCheckpointStore) save(_ *gorm.DB, cp *Checkpoint) error {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	if st.checkpoints == nil {
+		st.checkpoints = make(map[string]*Checkpoint)
+	}
+	saved := *cp
+	saved.PrimaryKey = normalizeKey(cp.PrimaryKey)
+	st.checkpoints[cp.SourceTable] = &saved
+
+	data, err := json.MarshalIndent(checkpointFile{Checkpoints: st.checkpoints}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(st.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	tmp := st.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, st.path)
+}
+
+func (st *fileCheckpointStore) transactional() bool { return false }
+
+func (st *fileCheckpointStore) copyCheckpoints() map[string]*Checkpoint {
+	checkpoints := make(map[string]*Checkpoint, len(st.checkpoints))
+	for table, cp := range st.checkpoints {
+		copied := *cp
+		checkpoints[table] = &copied
+	}
+	return checkpoints
+}
+
+// ----------------------------- 主键编码 -----------------------------
+
+func encodeCheckpointKey(key []interface{}) ([]byte, error) {
+	data, err := json.Marshal(normalizeKey(key))
+	if err != nil {
+		return nil, fmt.Errorf("编码检查点主键失败: %w", err)
+	}
+	return data, nil
+}
+
+func decodeCheckpointKey(data []byte) ([]interface{}, error) {
+	var key []interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&key); err != nil {
+		return nil, err
+	}
+	return normalizeDecodedKey(key), nil
+}
+
+// normalizeKey 把主键值转换成 JSON 能原样还原的形式：[]byte 转字符串，时间转 MySQL 格式的字符串
+func normalizeKey(key []interface{}) []interface{} {
+	if key == nil {
+		return nil
+	}
+	normalized := make([]interface{}, len(key))
+	for i, v := range key {
+		switch x := v.(type) {
+		case []byte:
+			normalized[i] = string(x)
+		case time.Time:
+			normalized[i] = x.Format("2006-01-02 15:04:05.999999")
+		default:
+			normalized[i] = v
+		}
+	}
+	return normalized
+}
+
+// normalizeDecodedKey 整数还原为 int64，避免大整数主键经 float64 丢失精度；其他数字保留字符串，由 MySQL 比较
+func normalizeDecodedKey(key []interface{}) []interface{} {
+	for i, v := range key {
+		if n, ok := v.(json.Number); ok {
+			if i64, err := n.Int64(); err == nil {
+				key[i] = i64
+			} else {
+				key[i] = n.String()
+			}
+		}
+	}
+	return key
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestFileCheckpointStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "checkpoint.json")
+	store := &fileCheckpointStore{path: path}
+
+	if checkpoints, err := store.load(); err != nil || len(checkpoints) != 0 {
+		t.Fatalf("文件不存在时应返回空检查点: %v, %v", checkpoints, err)
+	}
+
+	updateTime := time.Date(2024, 1, 2, 3, 4, 5, 600000000, time.UTC)
+	cp := &Checkpoint{
+		SourceTable: "node_node",
+		TargetTable: "node_node",
+		UpdateTime:  updateTime,
+		PrimaryKey:  []interface{}{int64(9007199254740993), []byte("a")},
+		LastError:   "连接超时",
+	}
+	if err := store.save(nil, cp); err != nil {
+		t.Fatalf("保存检查点失败: %v", err)
+	}
+
+	checkpoints, err := (&fileCheckpointStore{path: path}).load()
+	if err != nil {
+		t.Fatalf("读取检查点失败: %v", err)
+	}
+	got := checkpoints["node_node"]
+	if got == nil || !got.UpdateTime.Equal(updateTime) || got.LastError != "连接超时" {
+		t.Fatalf("检查点内容错误: %+v", got)
+	}
+	// 大整数主键不能经 float64 丢失精度
+	if want := []interface{}{int64(9007199254740993), "a"}; !reflect.DeepEqual(got.PrimaryKey, want) {
+		t.Errorf("主键还原错误: %#v", got.PrimaryKey)
+	}
+}
+
+func TestSyncBatchDataSavesCheckpointInTransaction(t *testing.T) {
+	targetDB, mock := newMockDB(t)
+	s := &SyncService{targetDB: targetDB, checkpoints: &tableCheckpointStore{db: targetDB}}
+	writer := &batchWriter{table: "user_backup", tableColumns: []string{"id", "name"}, maxAllowedPacket: defaultMaxAllowedPacket}
+	checkpoint := &Checkpoint{SourceTable: "user", TargetTable: "user_backup", PrimaryKey: []interface{}{int64(2)}}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SET FOREIGN_KEY_CHECKS = 0").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO `user_backup`").WithArgs(int64(1), "a", int64(2), "b").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO `_sync_checkpoint`").
+		WithArgs("user", "user_backup", nil, "[2]", nil, nil, nil, nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	records := []map[string]interface{}{{"id": int64(1), "name": "a"}, {"id": int64(2), "name": "b"}}
+	if err := s.syncBatchData(writer, records, checkpoint); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("未满足的数据库期望: %v", err)
+	}
+}
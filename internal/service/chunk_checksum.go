@@ -0,0 +1,326 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// chunkState 一个主键范围 (lower, upper]，以及上次校验的结果
+type chunkState struct {
+	lower []interface{} // nil 表示没有下界
+	upper []interface{} // nil 表示没有上界（最后一块，新插入的大主键都落在这里）
+
+	verified     bool     // 上次校验时两边一致
+	source       chunkSum // 上次校验时源表该范围的行数、校验值和 update_field 最大值
+	targetSignal string   // 上次校验时目标表该范围的变化信号
+}
+
+// chunkCache 缓存在 SyncTask 上的分块边界和各块上次校验的结果。之后各轮每块只在两边查行数和 update_field 最大值，
+// 两边都没变、上次又一致的块不再计算校验值，只有目标表变了时沿用缓存的源表校验值；
+// 每隔 chunk_verify_interval 对所有块完整校验一次，发现不改 update_field 的修改。缓存只在内存中，不随检查点保存，重启后第一轮重新划分并完整校验
+type chunkCache struct {
+	columns    string // 参与校验的列和 filter，表结构、列映射或 filter 变化后缓存作废
+	primaryKey []string
+	chunks     []*chunkState
+	verifiedAt time.Time // 上次完整校验所有块的时间
+}
+
+// chunkSum 一个块在一侧的统计结果
+type chunkSum struct {
+	Cnt       int64
+	Crc       uint64
+	MaxUpdate sql.NullString
+}
+
+// signal 行数和 update_field 最大值：插入、删除和更新了 update_field 的修改都会改变它
+func (c chunkSum) signal() string {
+	return fmt.Sprintf("%d|%v|%s", c.Cnt, c.MaxUpdate.Valid, c.MaxUpdate.String)
+}
+
+// chunkSide 一侧计算分块统计所需的表、列和条件
+type chunkSide struct {
+	db          *gorm.DB
+	table       string
+	exprs       []string // 参与校验的列或表达式，已转义
+	primaryKey  []string
+	filter      string // 只统计满足条件的行，为空时不过滤
+	updateField string // 已转义的 update_field，为空时变化信号只有行数
+}
+
+// syncChunks 按主键范围分块比较源表和目标表，只重新同步校验值不同的块。
+// 每块的新增、修改、删除都在块内处理，不需要再清理整张目标表
+func (s *SyncService) syncChunks(task *SyncTask, source *gorm.DB, mapping *columnMap) error {
+	primaryKey, err := s.getPrimaryKey(s.sourceDB, task.SourceTable)
+	if err != nil {
+		return &SyncError{Phase: PhaseCheck, Err: err}
+	}
+	targetKey, err := mapping.targetKey(task.SourceTable, primaryKey)
+	if err != nil {
+		return &SyncError{Phase: PhaseCheck, Err: err}
+	}
+
+	// 两边按相同顺序计算校验值：源表是映射的列和 set 表达式，目标表是对应的目标列，脱敏的列不参与
+	sourceExprs, targetExprs := mapping.checksumExprs()
+	tablePair := s.getTableConfig(task.SourceTable)
+	filter := tablePair.Filter
+	sourceSide := &chunkSide{db: source, table: task.SourceTable, exprs: sourceExprs, primaryKey: primaryKey, filter: filter}
+	targetSide := &chunkSide{db: s.targetDB, table: task.TargetTable, exprs: targetExprs, primaryKey: targetKey, filter: s.targetScope()}
+	if filter != "" {
+		// 目标表中源表仍然存在、只是不满足 filter 的行会保留，目标表一侧也只统计满足条件的行
+		targetFilter, err := mapping.targetFilter(filter)
+		if err != nil {
+			return &SyncError{Phase: PhaseCheck, Err: fmt.Errorf("表 %s 的 filter 无法用于目标表: %w", task.SourceTable, err)}
+		}
+		if targetSide.filter != "" {
+			targetFilter = targetSide.filter + " AND (" + targetFilter + ")"
+		}
+		targetSide.filter = targetFilter
+	}
+	if col, ok := mapping.sourceColumn(tablePair.UpdateField); ok {
+		sourceSide.updateField = fmt.Sprintf("`%s`", col)
+		if mapping.masks[col] == nil {
+			targetSide.updateField = fmt.Sprintf("`%s`", mapping.targetName(col))
+		}
+	}
+
+	columns := strings.Join(sourceExprs, ",") + "|" + strings.Join(targetExprs, ",") + "|" + filter + "|" + tablePair.UpdateField
+	cache := task.chunks
+	if cache == nil || cache.columns != columns || strings.Join(cache.primaryKey, ",") != strings.Join(primaryKey, ",") {
+		chunks, err := s.splitChunks(source, task.SourceTable, primaryKey, filter)
+		if err != nil {
+			return &SyncError{Phase: PhaseCheck, Err: fmt.Errorf("计算分块边界失败: %w", err)}
+		}
+		cache = &chunkCache{columns: columns, primaryKey: primaryKey, chunks: chunks}
+		task.chunks = cache
+		log.Printf("表 %s 分为 %d 块进行校验", task.SourceTable, len(chunks))
+	}
+
+	verifyInterval := time.Duration(s.config.Sync.ChunkVerifyInterval) * time.Second
+	fullVerify := cache.verifiedAt.IsZero() || time.Since(cache.verifiedAt) >= verifyInterval
+	started := time.Now()
+
+	var writer *batchWriter
+	var changed, rechunk bool
+	var skipped int
+	for i, chunk := range cache.chunks {
+		if s.stopping() {
+			return nil
+		}
+
+		sourceChanged := true
+		if !fullVerify && chunk.verified {
+			// 先比较变化信号，两边都没变的块跳过
+			sum, err := sourceSide.sum(chunk, false)
+			if err != nil {
+				return &SyncError{Phase: PhaseCheck, Err: fmt.Errorf("计算源表分块变化信号失败: %w", err)}
+			}
+			targetSum, err := targetSide.sum(chunk, false)
+			if err != nil {
+				return &SyncError{Phase: PhaseCheck, Err: fmt.Errorf("计算目标表分块变化信号失败: %w", err)}
+			}
+			sourceChanged = sum.signal() != chunk.source.signal()
+			if !sourceChanged && targetSum.signal() == chunk.targetSignal {
+				skipped++
+				continue
+			}
+		}
+
+		sum := chunk.source
+		if sourceChanged {
+			var err error
+			if sum, err = sourceSide.sum(chunk, true); err != nil {
+				return &SyncError{Phase: PhaseCheck, Err: fmt.Errorf("计算源表分块校验值失败: %w", err)}
+			}
+			s.throttleRead(task, int(sum.Cnt))
+			if sum.Cnt > int64(2*s.chunkSize()) {
+				// 块内插入了大量数据，下一轮重新划分
+				rechunk = true
+			}
+		}
+		targetSum, err := targetSide.sum(chunk, true)
+		if err != nil {
+			return &SyncError{Phase: PhaseCheck, Err: fmt.Errorf("计算目标表分块校验值失败: %w", err)}
+		}
+		chunk.source, chunk.targetSignal = sum, targetSum.signal()
+		chunk.verified = sum.Cnt == targetSum.Cnt && sum.Crc == targetSum.Crc
+		if chunk.verified {
+			continue
+		}
+
+		log.Printf("表 %s 第 %d 块 (%v, %v] 不一致: 源表 %d 行，目标表 %d 行，重新同步该块",
+			task.SourceTable, i+1, chunk.lower, chunk.upper, sum.Cnt, targetSum.Cnt)
+		if writer == nil {
+			if writer, err = s.newBatchWriter(task.TargetTable); err != nil {
+				return &SyncError{Phase: PhaseCopy, Err: err}
+			}
+		}
+		if err := s.repairChunk(task, source, writer, mapping, primaryKey, targetKey, chunk); err != nil {
+			return &SyncError{Phase: PhaseCopy, Err: err}
+		}
+		// verified 仍为 false，下一轮重新计算校验值确认修复结果
+		changed = true
+	}
+
+	if fullVerify {
+		cache.verifiedAt = started
+	}
+	if rechunk {
+		task.chunks = nil
+	}
+	if !changed {
+		if skipped > 0 {
+			log.Printf("表 %s 所有分块校验一致，其中 %d 块两边都没有变化，跳过校验", task.SourceTable, skipped)
+		} else {
+			log.Printf("表 %s 所有分块校验一致，无需同步", task.SourceTable)
+		}
+	}
+	return nil
+}
+
+func (s *SyncService) chunkSize() int {
+	if s.config.Sync.ChunkSize > 0 {
+		return s.config.Sync.ChunkSize
+	}
+	return 1000
+}
+
+// splitChunks 沿主键索引每隔 chunk_size 行取一个边界，把源表划分为若干主键范围，配置了 filter 时只计满足条件的行
+func (s *SyncService) splitChunks(source *gorm.DB, table string, primaryKey []string, filter string) ([]*chunkState, error) {
+	var chunks []*chunkState
+	var lower []interface{}
+	for {
+		query := source.Table(table).Select(quoteColumns(primaryKey))
+		if filter != "" {
+			query = query.Where("(" + filter + ")")
+		}
+		if lower != nil {
+			condition, args := keysetCondition(primaryKey, lower)
+			query = query.Where(condition, args...)
+		}
+
+		var rows []map[string]interface{}
+		unlock := lockSnapshot(source)
+		err := query.Order(quoteColumns(primaryKey)).Offset(s.chunkSize() - 1).Limit(1).Find(&rows).Error
+		unlock()
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == 0 {
+			// 剩余不足一块的行和之后新插入的行都归入最后一块
+			return append(chunks, &chunkState{lower: lower}), nil
+		}
+
+		upper := keyOf(rows[0], primaryKey)
+		chunks = append(chunks, &chunkState{lower: lower, upper: upper})
+		lower = upper
+	}
+}
+
+// sum 统计主键范围内的行数和 update_field 最大值；withCRC 时再计算 BIT_XOR(CRC32(整行))，与行的顺序无关。
+// CONCAT_WS 会跳过 NULL，所以额外拼上各列的 ISNULL 标记，区分 NULL 和空字符串
+func (c *chunkSide) sum(chunk *chunkState, withCRC bool) (chunkSum, error) {
+	selects := []string{"COUNT(*) AS cnt"}
+	if withCRC {
+		values := make([]string, len(c.exprs))
+		nulls := make([]string, len(c.exprs))
+		for i, expr := range c.exprs {
+			values[i] = expr
+			nulls[i] = fmt.Sprintf("ISNULL(%s)", expr)
+		}
+		rowExpr := fmt.Sprintf("CONCAT_WS('#', %s, CONCAT(%s))", strings.Join(values, ", "), strings.Join(nulls, ", "))
+		selects = append(selects, fmt.Sprintf("COALESCE(BIT_XOR(CRC32(%s)), 0) AS crc", rowExpr))
+	}
+	if c.updateField != "" {
+		selects = append(selects, fmt.Sprintf("MAX(%s) AS max_update", c.updateField))
+	}
+
+	query := c.db.Table(c.table).Select(strings.Join(selects, ", "))
+	if condition, args := keyRangeCondition(c.primaryKey, chunk.lower, chunk.upper); condition != "" {
+		query = query.Where(condition, args...)
+	}
+	if c.filter != "" {
+		query = query.Where("(" + c.filter + ")")
+	}
+
+	var result chunkSum
+	unlock := lockSnapshot(c.db)
+	err := query.Scan(&result).Error
+	unlock()
+	return result, err
+}
+
+// repairChunk 重新同步一个块：源表该范围内的行全部 upsert，目标表该范围内多出的行删除。
+// 配置了 filter 时只 upsert 满足条件的行，目标表中源表仍然存在的行不删除
+func (s *SyncService) repairChunk(task *SyncTask, source *gorm.DB, writer *batchWriter, mapping *columnMap, primaryKey, targetKey []string, chunk *chunkState) error {
+	condition, args := keyRangeCondition(primaryKey, chunk.lower, chunk.upper)
+	filter := s.getTableConfig(task.SourceTable).Filter
+
+	sourceKeys := make(map[string]bool)
+	cursor := newKeysetCursor(task.SourceTable, primaryKey, task.BatchSize)
+	cursor.selects = mapping.selects()
+	cursor.filter = filter
+	cursor.round = task.round
+	for {
+		records, err := cursor.next(source, condition, args...)
+		if err != nil {
+			return fmt.Errorf("读取源表分块失败: %w", err)
+		}
+		if len(records) == 0 {
+			break
+		}
+		for _, record := range records {
+			sourceKeys[formatKey(keyOf(record, primaryKey))] = true
+		}
+		if !cursor.shared {
+			s.throttleRead(task, len(records))
+		}
+		if err := s.syncBatchData(writer, mapping.apply(records), nil); err != nil {
+			return err
+		}
+		s.notifyRowsUpserted(task, len(records))
+	}
+
+	var extra [][]interface{}
+	condition, args = keyRangeCondition(targetKey, chunk.lower, chunk.upper)
+	cursor = newKeysetCursor(task.TargetTable, targetKey, task.BatchSize)
+	cursor.columns = targetKey
+	cursor.filter = s.targetScope()
+	for {
+		records, err := cursor.next(s.targetDB, condition, args...)
+		if err != nil {
+			return fmt.Errorf("读取目标表分块主键失败: %w", err)
+		}
+		if len(records) == 0 {
+			break
+		}
+		for _, record := range records {
+			if key := keyOf(record, targetKey); !sourceKeys[formatKey(key)] {
+				extra = append(extra, key)
+			}
+		}
+	}
+
+	if len(extra) > 0 && filter != "" {
+		var err error
+		if extra, err = s.keysGoneFromSource(source, task.SourceTable, primaryKey, extra, task.BatchSize); err != nil {
+			return err
+		}
+	}
+	if len(extra) > 0 && task.deletes != nil {
+		// 按外键顺序同步时留到删除阶段，子表先删
+		return task.deletes.add(targetKey, extra, task.BatchSize)
+	}
+	if len(extra) > 0 {
+		deleted, err := s.deleteTargetKeys(task, targetKey, extra)
+		if err != nil {
+			return err
+		}
+		s.notifyRowsDeleted(task, deleted)
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"reflect"
+	"sync/internal/config"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestKeyRangeCondition(t *testing.T) {
+	condition, args := keyRangeCondition([]string{"id"}, []interface{}{10}, []interface{}{20})
+	if condition != "((`id` > ?)) AND ((`id` <= ?))" || !reflect.DeepEqual(args, []interface{}{10, 20}) {
+		t.Errorf("单列主键范围条件错误: %s %v", condition, args)
+	}
+
+	condition, args = keyRangeCondition([]string{"user_id", "group_id"}, nil, []interface{}{1, 2})
+	want := "((`user_id` < ?) OR (`user_id` = ? AND `group_id` <= ?))"
+	if condition != want || !reflect.DeepEqual(args, []interface{}{1, 1, 2}) {
+		t.Errorf("联合主键范围条件错误: %s %v", condition, args)
+	}
+
+	if condition, _ := keyRangeCondition([]string{"id"}, nil, nil); condition != "" {
+		t.Errorf("没有边界时应返回空条件: %s", condition)
+	}
+}
+
+func TestSyncChunks(t *testing.T) {
+	sourceDB, sourceMock := newMockDB(t)
+	targetDB, targetMock := newMockDB(t)
+
+	cfg := &config.Config{}
+	cfg.Sync.ChunkSize = 2
+	task := &SyncTask{SourceTable: "user", TargetTable: "user_backup", BatchSize: 10}
+	s := &SyncService{sourceDB: sourceDB, targetDB: targetDB, config: cfg, tasks: map[string]*SyncTask{"user": task}}
+	mapping, err := s.columnMapFor("user", []string{"id", "name"})
+	if err != nil {
+		t.Fatalf("解析列映射失败: %v", err)
+	}
+
+	checksumRows := func(cnt, crc int64) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"cnt", "crc"}).AddRow(cnt, crc)
+	}
+	expectPrimaryKey := func() {
+		sourceMock.ExpectQuery("INFORMATION_SCHEMA.STATISTICS").WithArgs("user").
+			WillReturnRows(primaryKeyRows("PRIMARY", "id"))
+	}
+
+	// 第一轮：计算分块边界 (-∞, 2]、(2, +∞)
+	expectPrimaryKey()
+	sourceMock.ExpectQuery("SELECT `id` FROM `user` ORDER BY `id` LIMIT \\? OFFSET \\?").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	sourceMock.ExpectQuery("SELECT `id` FROM `user` WHERE \\(\\(`id` > \\?\\)\\) ORDER BY `id` LIMIT \\? OFFSET \\?").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	// 第一块两边一致
+	sourceMock.ExpectQuery("BIT_XOR\\(CRC32\\(.+\\)\\).+FROM `user` WHERE \\(\\(`id` <= \\?\\)\\)").
+		WithArgs(int64(2)).WillReturnRows(checksumRows(2, 100))
+	targetMock.ExpectQuery("BIT_XOR\\(CRC32\\(.+\\)\\).+FROM `user_backup` WHERE \\(\\(`id` <= \\?\\)\\)").
+		WithArgs(int64(2)).WillReturnRows(checksumRows(2, 100))
+
+	// 第二块不一致：upsert 源表的 id=3，删除目标表多出的 id=4
+	sourceMock.ExpectQuery("BIT_XOR\\(CRC32\\(.+\\)\\).+FROM `user` WHERE \\(\\(`id` > \\?\\)\\)").
+		WithArgs(int64(2)).WillReturnRows(checksumRows(1, 7))
+	targetMock.ExpectQuery("BIT_XOR\\(CRC32\\(.+\\)\\).+FROM `user_backup` WHERE \\(\\(`id` > \\?\\)\\)").
+		WithArgs(int64(2)).WillReturnRows(checksumRows(2, 9))
+	targetMock.ExpectQuery("INFORMATION_SCHEMA.COLUMNS").WithArgs("user_backup").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE"}).
+			AddRow("id", "bigint").AddRow("name", "varchar(64)"))
+	targetMock.ExpectQuery("SELECT @@max_allowed_packet").
+		WillReturnRows(sqlmock.NewRows([]string{"@@max_allowed_packet"}).AddRow(4194304))
+	sourceMock.ExpectQuery("SELECT `id`, `name` FROM `user` WHERE \\(\\(`id` > \\?\\)\\) ORDER BY `id` LIMIT \\?").
+		WithArgs(int64(2), 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(3, "carol"))
+	targetMock.ExpectBegin()
+	targetMock.ExpectExec("SET FOREIGN_KEY_CHECKS = 0").WillReturnResult(sqlmock.NewResult(0, 0))
+	targetMock.ExpectExec("INSERT INTO `user_backup` \\(`id`, `name`\\) VALUES \\(\\?, \\?\\) ON DUPLICATE KEY UPDATE").
+		WithArgs(int64(3), "carol").WillReturnResult(sqlmock.NewResult(1, 1))
+	targetMock.ExpectCommit()
+	targetMock.ExpectQuery("SELECT `id` FROM `user_backup` WHERE \\(\\(`id` > \\?\\)\\) ORDER BY `id` LIMIT \\?").
+		WithArgs(int64(2), 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3).AddRow(4))
+	targetMock.ExpectBegin()
+	targetMock.ExpectExec("SET FOREIGN_KEY_CHECKS = 0").WillReturnResult(sqlmock.NewResult(0, 0))
+	targetMock.ExpectExec("DELETE FROM `user_backup` WHERE `id` IN \\(\\?\\)").WithArgs(int64(4)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	targetMock.ExpectCommit()
+
+	if err := s.syncChunks(task, s.sourceDB, mapping); err != nil {
+		t.Fatalf("第一轮分块同步失败: %v", err)
+	}
+
+	// 第二轮：使用缓存的边界；源表没变，但目标表第一块被直接修改过，chunk_verify_interval 为 0 时每轮完整校验，仍然要发现并修复
+	expectPrimaryKey()
+	sourceMock.ExpectQuery("BIT_XOR\\(CRC32\\(.+\\)\\).+FROM `user` WHERE \\(\\(`id` <= \\?\\)\\)").
+		WithArgs(int64(2)).WillReturnRows(checksumRows(2, 100))
+	targetMock.ExpectQuery("BIT_XOR\\(CRC32\\(.+\\)\\).+FROM `user_backup` WHERE \\(\\(`id` <= \\?\\)\\)").
+		WithArgs(int64(2)).WillReturnRows(checksumRows(2, 55))
+	targetMock.ExpectQuery("INFORMATION_SCHEMA.COLUMNS").WithArgs("user_backup").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE"}).
+			AddRow("id", "bigint").AddRow("name", "varchar(64)"))
+	targetMock.ExpectQuery("SELECT @@max_allowed_packet").
+		WillReturnRows(sqlmock.NewRows([]string{"@@max_allowed_packet"}).AddRow(4194304))
+	sourceMock.ExpectQuery("SELECT `id`, `name` FROM `user` WHERE \\(\\(`id` <= \\?\\)\\) ORDER BY `id` LIMIT \\?").
+		WithArgs(int64(2), 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "alice").AddRow(2, "bob"))
+	targetMock.ExpectBegin()
+	targetMock.ExpectExec("SET FOREIGN_KEY_CHECKS = 0").WillReturnResult(sqlmock.NewResult(0, 0))
+	targetMock.ExpectExec("INSERT INTO `user_backup` \\(`id`, `name`\\) VALUES \\(\\?, \\?\\), \\(\\?, \\?\\) ON DUPLICATE KEY UPDATE").
+		WithArgs(int64(1), "alice", int64(2), "bob").WillReturnResult(sqlmock.NewResult(0, 2))
+	targetMock.ExpectCommit()
+	targetMock.ExpectQuery("SELECT `id` FROM `user_backup` WHERE \\(\\(`id` <= \\?\\)\\) ORDER BY `id` LIMIT \\?").
+		WithArgs(int64(2), 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	// 第二块两边一致
+	sourceMock.ExpectQuery("BIT_XOR\\(CRC32\\(.+\\)\\).+FROM `user` WHERE \\(\\(`id` > \\?\\)\\)").
+		WithArgs(int64(2)).WillReturnRows(checksumRows(1, 7))
+	targetMock.ExpectQuery("BIT_XOR\\(CRC32\\(.+\\)\\).+FROM `user_backup` WHERE \\(\\(`id` > \\?\\)\\)").
+		WithArgs(int64(2)).WillReturnRows(checksumRows(1, 7))
+
+	if err := s.syncChunks(task, s.sourceDB, mapping); err != nil {
+		t.Fatalf("第二轮分块同步失败: %v", err)
+	}
+
+	if err := sourceMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("源库期望未满足: %v", err)
+	}
+	if err := targetMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("目标库期望未满足: %v", err)
+	}
+}
+
+func TestSyncChunksSkipsUnchanged(t *testing.T) {
+	sourceDB, sourceMock := newMockDB(t)
+	targetDB, targetMock := newMockDB(t)
+
+	cfg := &config.Config{}
+	cfg.Sync.ChunkSize = 2
+	cfg.Sync.ChunkVerifyInterval = 3600
+	cfg.Sync.TablePairs = []config.TablePair{{
+		Source: "user", Target: "user_backup", CheckMethod: "chunk_checksum", UpdateField: "updated_at",
+		Filter: "status = 1", Columns: config.ColumnMapping{Rename: map[string]string{"status": "state"}},
+	}}
+	task := &SyncTask{SourceTable: "user", TargetTable: "user_backup", BatchSize: 10}
+	s := &SyncService{sourceDB: sourceDB, targetDB: targetDB, config: cfg, tasks: map[string]*SyncTask{"user": task}}
+	mapping, err := s.columnMapFor("user", []string{"id", "status", "updated_at"})
+	if err != nil {
+		t.Fatalf("解析列映射失败: %v", err)
+	}
+
+	sumRows := func(cnt, crc int64, maxUpdate string) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"cnt", "crc", "max_update"}).AddRow(cnt, crc, maxUpdate)
+	}
+	signalRows := func(cnt int64, maxUpdate string) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"cnt", "max_update"}).AddRow(cnt, maxUpdate)
+	}
+	expectPrimaryKey := func() {
+		sourceMock.ExpectQuery("INFORMATION_SCHEMA.STATISTICS").WithArgs("user").
+			WillReturnRows(primaryKeyRows("PRIMARY", "id"))
+	}
+	const (
+		first  = "WHERE \\(\\(`id` <= \\?\\)\\)"
+		second = "WHERE \\(\\(`id` > \\?\\)\\)"
+	)
+	// 目标表一侧也只统计满足 filter 的行，改名的字段换成目标列名
+	sourceChecksum := func(chunk string) string {
+		return "BIT_XOR\\(CRC32\\(.+\\)\\).+MAX\\(`updated_at`\\) AS max_update FROM `user` " + chunk + " AND \\(status = 1\\)"
+	}
+	targetChecksum := func(chunk string) string {
+		return "BIT_XOR\\(CRC32\\(.+\\)\\).+MAX\\(`updated_at`\\) AS max_update FROM `user_backup` " + chunk + " AND \\(`state` = 1\\)"
+	}
+	sourceSignal := func(chunk string) string {
+		return "SELECT COUNT\\(\\*\\) AS cnt, MAX\\(`updated_at`\\) AS max_update FROM `user` " + chunk + " AND \\(status = 1\\)"
+	}
+	targetSignal := func(chunk string) string {
+		return "SELECT COUNT\\(\\*\\) AS cnt, MAX\\(`updated_at`\\) AS max_update FROM `user_backup` " + chunk + " AND \\(`state` = 1\\)"
+	}
+
+	// 第一轮：划分边界后完整校验所有块
+	expectPrimaryKey()
+	sourceMock.ExpectQuery("SELECT `id` FROM `user` WHERE \\(status = 1\\) ORDER BY `id` LIMIT \\? OFFSET \\?").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	sourceMock.ExpectQuery("SELECT `id` FROM `user` WHERE \\(status = 1\\) AND \\(\\(`id` > \\?\\)\\) ORDER BY `id` LIMIT \\? OFFSET \\?").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	sourceMock.ExpectQuery(sourceChecksum(first)).WithArgs(int64(2)).WillReturnRows(sumRows(2, 100, "2024-01-01 00:00:00"))
+	targetMock.ExpectQuery(targetChecksum(first)).WithArgs(int64(2)).WillReturnRows(sumRows(2, 100, "2024-01-01 00:00:00"))
+	sourceMock.ExpectQuery(sourceChecksum(second)).WithArgs(int64(2)).WillReturnRows(sumRows(1, 7, "2024-01-02 00:00:00"))
+	targetMock.ExpectQuery(targetChecksum(second)).WithArgs(int64(2)).WillReturnRows(sumRows(1, 7, "2024-01-02 00:00:00"))
+
+	if err := s.syncChunks(task, s.sourceDB, mapping); err != nil {
+		t.Fatalf("第一轮分块同步失败: %v", err)
+	}
+
+	// 第二轮：两边都没有变化的块不再计算校验值。第一块只有目标表变了，沿用缓存的源表校验值；
+	// 第二块源表的 update_field 变了，两边重新计算
+	expectPrimaryKey()
+	sourceMock.ExpectQuery(sourceSignal(first)).WithArgs(int64(2)).WillReturnRows(signalRows(2, "2024-01-01 00:00:00"))
+	targetMock.ExpectQuery(targetSignal(first)).WithArgs(int64(2)).WillReturnRows(signalRows(2, "2024-01-01 00:00:05"))
+	targetMock.ExpectQuery(targetChecksum(first)).WithArgs(int64(2)).WillReturnRows(sumRows(2, 100, "2024-01-01 00:00:05"))
+	sourceMock.ExpectQuery(sourceSignal(second)).WithArgs(int64(2)).WillReturnRows(signalRows(1, "2024-01-03 00:00:00"))
+	targetMock.ExpectQuery(targetSignal(second)).WithArgs(int64(2)).WillReturnRows(signalRows(1, "2024-01-03 00:00:00"))
+	sourceMock.ExpectQuery(sourceChecksum(second)).WithArgs(int64(2)).WillReturnRows(sumRows(1, 8, "2024-01-03 00:00:00"))
+	targetMock.ExpectQuery(targetChecksum(second)).WithArgs(int64(2)).WillReturnRows(sumRows(1, 8, "2024-01-03 00:00:00"))
+
+	if err := s.syncChunks(task, s.sourceDB, mapping); err != nil {
+		t.Fatalf("第二轮分块同步失败: %v", err)
+	}
+
+	// 第三轮：两边都没有变化，只查变化信号
+	expectPrimaryKey()
+	sourceMock.ExpectQuery(sourceSignal(first)).WithArgs(int64(2)).WillReturnRows(signalRows(2, "2024-01-01 00:00:00"))
+	targetMock.ExpectQuery(targetSignal(first)).WithArgs(int64(2)).WillReturnRows(signalRows(2, "2024-01-01 00:00:05"))
+	sourceMock.ExpectQuery(sourceSignal(second)).WithArgs(int64(2)).WillReturnRows(signalRows(1, "2024-01-03 00:00:00"))
+	targetMock.ExpectQuery(targetSignal(second)).WithArgs(int64(2)).WillReturnRows(signalRows(1, "2024-01-03 00:00:00"))
+
+	if err := s.syncChunks(task, s.sourceDB, mapping); err != nil {
+		t.Fatalf("第三轮分块同步失败: %v", err)
+	}
+
+	// 第四轮：到了完整校验的时间，所有块重新计算校验值
+	task.chunks.verifiedAt = time.Now().Add(-2 * time.Hour)
+	expectPrimaryKey()
+	sourceMock.ExpectQuery(sourceChecksum(first)).WithArgs(int64(2)).WillReturnRows(sumRows(2, 100, "2024-01-01 00:00:00"))
+	targetMock.ExpectQuery(targetChecksum(first)).WithArgs(int64(2)).WillReturnRows(sumRows(2, 100, "2024-01-01 00:00:05"))
+	sourceMock.ExpectQuery(sourceChecksum(second)).WithArgs(int64(2)).WillReturnRows(sumRows(1, 8, "2024-01-03 00:00:00"))
+	targetMock.ExpectQuery(targetChecksum(second)).WithArgs(int64(2)).WillReturnRows(sumRows(1, 8, "2024-01-03 00:00:00"))
+
+	if err := s.syncChunks(task, s.sourceDB, mapping); err != nil {
+		t.Fatalf("第四轮分块同步失败: %v", err)
+	}
+
+	if err := sourceMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("源库期望未满足: %v", err)
+	}
+	if err := targetMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("目标库期望未满足: %v", err)
+	}
+}
@@ -0,0 +1,312 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// columnMap 表对的列映射按源表当前的字段解析后的结果：读取哪些源列、写入目标表时用什么列名和值、
+// 只在目标表中的列取什么值。没有配置 columns 和 mask 时读取全部源列，列名和值不变
+type columnMap struct {
+	source   []string            // 读取的源表列，按源表字段顺序，不含排除的列
+	rename   map[string]string   // 源列 → 目标列，只包含改名的列
+	set      []string            // 由表达式取值的目标列，按名称排序
+	setExprs map[string]string   // 目标列 → 在源库上计算的 SQL 表达式
+	masks    map[string]maskFunc // 源列 → 写入目标表前的脱敏函数
+	excluded map[string]bool     // 排除的源列
+}
+
+// columnMapFor 按表对的 columns 和 mask 配置解析源表字段，配置中的列名不区分大小写
+func (s *SyncService) columnMapFor(sourceTable string, sourceColumns []string) (*columnMap, error) {
+	tablePair := s.getTableConfig(sourceTable)
+	mapping := tablePair.Columns
+	m := &columnMap{rename: make(map[string]string), setExprs: make(map[string]string), masks: make(map[string]maskFunc)}
+
+	resolve := func(name string) (string, bool) {
+		for _, col := range sourceColumns {
+			if strings.EqualFold(col, name) {
+				return col, true
+			}
+		}
+		return "", false
+	}
+
+	excluded := make(map[string]bool, len(mapping.Exclude))
+	for _, name := range mapping.Exclude {
+		col, ok := resolve(name)
+		if !ok {
+			return nil, fmt.Errorf("表 %s 的 exclude 中的字段 %s 在源表中不存在", sourceTable, name)
+		}
+		excluded[col] = true
+	}
+	m.excluded = excluded
+	for from, to := range mapping.Rename {
+		col, ok := resolve(from)
+		if !ok {
+			return nil, fmt.Errorf("表 %s 的 rename 中的字段 %s 在源表中不存在", sourceTable, from)
+		}
+		m.rename[col] = to
+	}
+	for name, rule := range tablePair.Mask {
+		col, ok := resolve(name)
+		if !ok {
+			return nil, fmt.Errorf("表 %s 的 mask 中的字段 %s 在源表中不存在", sourceTable, name)
+		}
+		m.masks[col] = newMask(rule, s.config.Sync.MaskSalt)
+	}
+
+	targets := make(map[string]string) // 小写的目标列 → 源列
+	for _, col := range sourceColumns {
+		if excluded[col] {
+			continue
+		}
+		m.source = append(m.source, col)
+		name := strings.ToLower(m.targetName(col))
+		if other, ok := targets[name]; ok {
+			return nil, fmt.Errorf("表 %s 的字段 %s 和 %s 映射到同一个目标字段 %s", sourceTable, other, col, m.targetName(col))
+		}
+		targets[name] = col
+	}
+
+	sets := make(map[string]string, len(mapping.Set)+1)
+	for col, expr := range mapping.Set {
+		sets[col] = expr
+	}
+	// 多个源库汇总时，目标表的 discriminator 字段写入源库名称
+	if column := s.config.Sync.Discriminator; column != "" && s.source != "" {
+		sets[column] = sqlLiteral(s.source)
+	}
+
+	for col, expr := range sets {
+		// 表达式的结果以目标列名作别名读出，不能与读取的源列重名
+		if _, ok := resolve(col); ok {
+			return nil, fmt.Errorf("表 %s 的 set 字段 %s 与源表字段同名，源表已有的字段请使用 rename", sourceTable, col)
+		}
+		if other, ok := targets[strings.ToLower(col)]; ok {
+			return nil, fmt.Errorf("表 %s 的 set 字段 %s 与源表字段 %s 映射到的目标字段冲突", sourceTable, col, other)
+		}
+		m.set = append(m.set, col)
+		m.setExprs[col] = expr
+	}
+	sort.Strings(m.set)
+	return m, nil
+}
+
+// targetName 源列在目标表中的列名
+func (m *columnMap) targetName(col string) string {
+	if name, ok := m.rename[col]; ok {
+		return name
+	}
+	return col
+}
+
+// targetColumns 写入目标表的全部列：映射的源列在前，set 列在后
+func (m *columnMap) targetColumns() []string {
+	columns := make([]string, 0, len(m.source)+len(m.set))
+	for _, col := range m.source {
+		columns = append(columns, m.targetName(col))
+	}
+	return append(columns, m.set...)
+}
+
+// targetExprs 目标表中与 valueExprs 一一对应的列，已转义
+func (m *columnMap) targetExprs() []string {
+	columns := m.targetColumns()
+	exprs := make([]string, len(columns))
+	for i, col := range columns {
+		exprs[i] = fmt.Sprintf("`%s`", col)
+	}
+	return exprs
+}
+
+// targetKey 源表行标识在目标表中的列名，行标识的列没有映射到目标表时返回错误
+func (m *columnMap) targetKey(sourceTable string, primaryKey []string) ([]string, error) {
+	key := make([]string, len(primaryKey))
+	for i, col := range primaryKey {
+		if !slices.Contains(m.source, col) {
+			return nil, fmt.Errorf("表 %s 的主键字段 %s 没有映射到目标表，主键字段不能被排除", sourceTable, col)
+		}
+		if _, ok := m.masks[col]; ok {
+			return nil, fmt.Errorf("表 %s 的主键字段 %s 不能脱敏，目标表需要用原值定位行", sourceTable, col)
+		}
+		key[i] = m.targetName(col)
+	}
+	return key, nil
+}
+
+// valueExprs 在源库上计算各目标列取值的表达式，与 targetColumns 一一对应
+func (m *columnMap) valueExprs() []string {
+	exprs := make([]string, 0, len(m.source)+len(m.set))
+	for _, col := range m.source {
+		exprs = append(exprs, fmt.Sprintf("`%s`", col))
+	}
+	for _, col := range m.set {
+		exprs = append(exprs, "("+m.setExprs[col]+")")
+	}
+	return exprs
+}
+
+// checksumExprs 校验时两边参与比较的列：源表的值表达式和目标表对应的列。
+// 脱敏的列两边的值不同，不参与校验，只改了这些列的行不会被校验发现
+func (m *columnMap) checksumExprs() ([]string, []string) {
+	sourceExprs, targetExprs := m.valueExprs(), m.targetExprs()
+	if len(m.masks) == 0 {
+		return sourceExprs, targetExprs
+	}
+	var source, target []string
+	for i, expr := range sourceExprs {
+		if i < len(m.source) && m.masks[m.source[i]] != nil {
+			continue
+		}
+		source = append(source, expr)
+		target = append(target, targetExprs[i])
+	}
+	return source, target
+}
+
+// selects 读取源表时使用的 SELECT 列表：映射的源列，以及以目标列名作别名的 set 表达式
+func (m *columnMap) selects() string {
+	exprs := m.valueExprs()
+	for i, col := range m.set {
+		idx := len(m.source) + i
+		exprs[idx] = fmt.Sprintf("%s AS `%s`", exprs[idx], col)
+	}
+	return strings.Join(exprs, ", ")
+}
+
+// apply 把读出的源表行转换为目标表的列名并脱敏；没有改名和脱敏时原样返回
+func (m *columnMap) apply(records []map[string]interface{}) []map[string]interface{} {
+	if len(m.rename) == 0 && len(m.masks) == 0 {
+		return records
+	}
+	mapped := make([]map[string]interface{}, len(records))
+	for i, record := range records {
+		row := make(map[string]interface{}, len(record))
+		for col, v := range record {
+			if mask, ok := m.masks[col]; ok {
+				v = mask(v)
+			}
+			row[m.targetName(col)] = v
+		}
+		mapped[i] = row
+	}
+	return mapped
+}
+
+// within 只保留目标表中存在的列，返回新的映射；用于只比较两边共有列的场景
+func (m *columnMap) within(targetTable string, targetColumns []string) *columnMap {
+	exists := make(map[string]bool, len(targetColumns))
+	for _, col := range targetColumns {
+		exists[strings.ToLower(col)] = true
+	}
+
+	narrowed := &columnMap{rename: m.rename, setExprs: m.setExprs, masks: m.masks, excluded: m.excluded}
+	for _, col := range m.source {
+		if exists[strings.ToLower(m.targetName(col))] {
+			narrowed.source = append(narrowed.source, col)
+		} else {
+			log.Printf("警告: 目标表 %s 缺少字段 %s，比较时忽略", targetTable, m.targetName(col))
+		}
+	}
+	for _, col := range m.set {
+		if exists[strings.ToLower(col)] {
+			narrowed.set = append(narrowed.set, col)
+		} else {
+			log.Printf("警告: 目标表 %s 缺少 set 字段 %s，比较时忽略", targetTable, col)
+		}
+	}
+	return narrowed
+}
+
+// sourceColumn 按名称查找读取的源列，不区分大小写
+func (m *columnMap) sourceColumn(name string) (string, bool) {
+	if name == "" {
+		return "", false
+	}
+	for _, col := range m.source {
+		if strings.EqualFold(col, name) {
+			return col, true
+		}
+	}
+	return "", false
+}
+
+// targetFilter 把源表字段上的 filter 改写为目标表上的条件：改名的字段换成目标列名。
+// 引用了排除或脱敏的字段时目标表上没有相同的值，返回错误。字符串常量和函数名不改写
+func (m *columnMap) targetFilter(filter string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(filter); {
+		c := filter[i]
+		switch {
+		case c == '\'' || c == '"':
+			// 字符串常量原样保留
+			j := i + 1
+			for j < len(filter) && filter[j] != c {
+				if filter[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j = min(j+1, len(filter))
+			b.WriteString(filter[i:j])
+			i = j
+		case c == '`' || c == '_' || unicode.IsLetter(rune(c)):
+			var name string
+			j := i + 1
+			if c == '`' {
+				for j < len(filter) && filter[j] != '`' {
+					j++
+				}
+				name = filter[i+1 : j]
+				j = min(j+1, len(filter))
+			} else {
+				for j < len(filter) && (filter[j] == '_' || filter[j] == '$' || unicode.IsLetter(rune(filter[j])) || unicode.IsDigit(rune(filter[j]))) {
+					j++
+				}
+				name = filter[i:j]
+			}
+			rest := strings.TrimLeft(filter[j:], " \t\n")
+			if column, err := m.filterColumn(name); err != nil {
+				return "", err
+			} else if column != "" && !strings.HasPrefix(rest, "(") {
+				b.WriteString(column)
+			} else {
+				b.WriteString(filter[i:j])
+			}
+			i = j
+		case unicode.IsDigit(rune(c)):
+			// 数字（包括 1e5 这类写法）原样保留
+			j := i + 1
+			for j < len(filter) && (filter[j] == '.' || unicode.IsLetter(rune(filter[j])) || unicode.IsDigit(rune(filter[j]))) {
+				j++
+			}
+			b.WriteString(filter[i:j])
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String(), nil
+}
+
+// filterColumn filter 中的一个标识符在目标表上的写法；不是源表字段时返回空字符串
+func (m *columnMap) filterColumn(name string) (string, error) {
+	for col := range m.excluded {
+		if strings.EqualFold(col, name) {
+			return "", fmt.Errorf("filter 引用了排除的字段 %s", col)
+		}
+	}
+	col, ok := m.sourceColumn(name)
+	if !ok {
+		return "", nil
+	}
+	if m.masks[col] != nil {
+		return "", fmt.Errorf("filter 引用了脱敏的字段 %s", col)
+	}
+	return fmt.Sprintf("`%s`", m.targetName(col)), nil
+}
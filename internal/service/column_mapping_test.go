@@ -0,0 +1,128 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"sync/internal/config"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func newMappingTestService(mapping config.ColumnMapping) *SyncService {
+	cfg := &config.Config{}
+	cfg.Sync.TablePairs = []config.TablePair{{Source: "user", Target: "user_backup", CheckMethod: "checksum", Columns: mapping}}
+	return &SyncService{config: cfg}
+}
+
+func TestColumnMapFor(t *testing.T) {
+	// viper 会把 map 的键转成小写
+	s := newMappingTestService(config.ColumnMapping{
+		Rename:  map[string]string{"nickname": "display_name"},
+		Exclude: []string{"password"},
+		Set:     map[string]string{"region": "'gz'"},
+	})
+
+	m, err := s.columnMapFor("user", []string{"id", "NickName", "password"})
+	if err != nil {
+		t.Fatalf("解析列映射失败: %v", err)
+	}
+	if want := []string{"id", "display_name", "region"}; !reflect.DeepEqual(m.targetColumns(), want) {
+		t.Errorf("目标列错误: %v", m.targetColumns())
+	}
+	if want := "`id`, `NickName`, ('gz') AS `region`"; m.selects() != want {
+		t.Errorf("查询列错误: %s", m.selects())
+	}
+
+	records := m.apply([]map[string]interface{}{{"id": int64(1), "NickName": "alice", "region": "gz"}})
+	if want := map[string]interface{}{"id": int64(1), "display_name": "alice", "region": "gz"}; !reflect.DeepEqual(records[0], want) {
+		t.Errorf("转换后的记录错误: %v", records[0])
+	}
+
+	if _, err := m.targetKey("user", []string{"password"}); err == nil {
+		t.Errorf("主键字段被排除时应返回错误")
+	}
+}
+
+func TestColumnMapForErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		mapping config.ColumnMapping
+		want    string
+	}{
+		{"rename 的字段不存在", config.ColumnMapping{Rename: map[string]string{"missing": "x"}}, "在源表中不存在"},
+		{"exclude 的字段不存在", config.ColumnMapping{Exclude: []string{"missing"}}, "在源表中不存在"},
+		{"改名后与其他字段重名", config.ColumnMapping{Rename: map[string]string{"name": "id"}}, "映射到同一个目标字段"},
+		{"set 与源表字段同名", config.ColumnMapping{Set: map[string]string{"name": "'x'"}}, "与源表字段同名"},
+	}
+	for _, c := range cases {
+		s := newMappingTestService(c.mapping)
+		if _, err := s.columnMapFor("user", []string{"id", "name"}); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: 期望包含 %q 的错误，实际: %v", c.name, c.want, err)
+		}
+	}
+}
+
+func TestTargetFilter(t *testing.T) {
+	s := newMappingTestService(config.ColumnMapping{
+		Rename:  map[string]string{"nickname": "display_name", "date": "day"},
+		Exclude: []string{"password"},
+	})
+	m, err := s.columnMapFor("user", []string{"id", "NickName", "date", "password"})
+	if err != nil {
+		t.Fatalf("解析列映射失败: %v", err)
+	}
+
+	// 改名的字段换成目标列名，字符串常量和函数名不变
+	filter, err := m.targetFilter("`nickname` <> 'nickname' AND DATE(date) >= CURDATE() - INTERVAL 1e1 DAY")
+	if err != nil {
+		t.Fatalf("改写 filter 失败: %v", err)
+	}
+	if want := "`display_name` <> 'nickname' AND DATE(`day`) >= CURDATE() - INTERVAL 1e1 DAY"; filter != want {
+		t.Errorf("改写后的 filter 错误:\n期望 %s\n实际 %s", want, filter)
+	}
+
+	if _, err := m.targetFilter("password IS NOT NULL"); err == nil || !strings.Contains(err.Error(), "排除的字段") {
+		t.Errorf("引用排除的字段时应返回错误，实际: %v", err)
+	}
+}
+
+func TestSyncTableSchemaWithMapping(t *testing.T) {
+	sourceDB, sourceMock := newMockDB(t)
+	targetDB, targetMock := newMockDB(t)
+
+	s := newMappingTestService(config.ColumnMapping{
+		Rename:  map[string]string{"nickname": "display_name"},
+		Exclude: []string{"avatar"},
+		Set:     map[string]string{"region": "'gz'"},
+	})
+	s.sourceDB, s.targetDB = sourceDB, targetDB
+	task := &SyncTask{SourceTable: "user", TargetTable: "user_backup"}
+
+	detailColumns := []string{"COLUMN_NAME", "COLUMN_TYPE", "IS_NULLABLE", "COLUMN_DEFAULT", "EXTRA", "COLUMN_COMMENT"}
+	sourceMock.ExpectQuery("INFORMATION_SCHEMA.COLUMNS").WithArgs("user").
+		WillReturnRows(sqlmock.NewRows(detailColumns).
+			AddRow("id", "bigint", "NO", nil, "", "").
+			AddRow("nickname", "varchar(64)", "YES", nil, "", "").
+			AddRow("avatar", "blob", "YES", nil, "", ""))
+	targetMock.ExpectQuery("INFORMATION_SCHEMA.COLUMNS").WithArgs("user_backup").
+		WillReturnRows(sqlmock.NewRows(detailColumns).
+			AddRow("id", "bigint", "NO", nil, "", "").
+			AddRow("region", "varchar(16)", "NO", nil, "", ""))
+	sourceMock.ExpectQuery("INFORMATION_SCHEMA.STATISTICS").WithArgs("user").WillReturnRows(indexRows("PRIMARY", "id"))
+	targetMock.ExpectQuery("INFORMATION_SCHEMA.STATISTICS").WithArgs("user_backup").WillReturnRows(indexRows("PRIMARY", "id"))
+
+	// 改名的字段以目标列名添加，排除的字段不添加
+	targetMock.ExpectExec("ALTER TABLE `user_backup` ADD COLUMN `display_name` varchar\\(64\\) NULL").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := s.syncTableSchema(task); err != nil {
+		t.Fatalf("同步表结构失败: %v", err)
+	}
+	if err := sourceMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("源库期望未满足: %v", err)
+	}
+	if err := targetMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("目标库期望未满足: %v", err)
+	}
+}
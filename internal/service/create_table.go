@@ -0,0 +1,116 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync/internal/config"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// createTableName SHOW CREATE TABLE 开头的表名
+	createTableName = regexp.MustCompile("^CREATE TABLE `[^`]+`")
+	// tableAutoIncrement 表选项中源表当前的自增值，新建的目标表从头开始
+	tableAutoIncrement = regexp.MustCompile(` AUTO_INCREMENT=\d+`)
+	// constraintName 外键的约束名在库内唯一，去掉后由 MySQL 按目标表名生成，源库和目标库是同一个库时也不会冲突
+	constraintName = regexp.MustCompile("CONSTRAINT `[^`]+` FOREIGN KEY")
+	// referencedTable 外键引用的表
+	referencedTable = regexp.MustCompile("REFERENCES `([^`]+)`")
+	tableEngine     = regexp.MustCompile(`ENGINE=\w+`)
+	tableCharset    = regexp.MustCompile(`DEFAULT CHARSET=\w+`)
+	tableCollate    = regexp.MustCompile(` COLLATE=\w+`)
+)
+
+// ensureTargetTable 表对配置了 create_if_missing 且目标表不存在时，按源表的 SHOW CREATE TABLE 在目标库建表，
+// 返回是否新建了目标表。新建的表清空该表的同步进度，本轮做一次全量加载
+func (s *SyncService) ensureTargetTable(task *SyncTask) (bool, error) {
+	tablePair := s.getTableConfig(task.SourceTable)
+	if !tablePair.CreateIfMissing {
+		return false, nil
+	}
+
+	var count int64
+	err := s.targetDB.Raw(`
+		SELECT COUNT(*)
+		FROM INFORMATION_SCHEMA.TABLES
+		WHERE TABLE_SCHEMA = DATABASE()
+		AND TABLE_NAME = ?`, task.TargetTable).Scan(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("检查目标表 %s 是否存在失败: %w", task.TargetTable, err)
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	var name, ddl string
+	if err := s.sourceDB.Raw(fmt.Sprintf("SHOW CREATE TABLE `%s`", task.SourceTable)).Row().Scan(&name, &ddl); err != nil {
+		return false, fmt.Errorf("读取源表 %s 的建表语句失败: %w", task.SourceTable, err)
+	}
+	sql := s.createTargetTableSQL(task.TargetTable, tablePair, ddl)
+
+	log.Printf("目标表 %s 不存在，按源表 %s 的结构创建", task.TargetTable, task.SourceTable)
+	if err := s.execCreateTable(task, sql); err != nil {
+		return false, err
+	}
+
+	task.mutex.Lock()
+	task.Checkpoint.UpdateTime = time.Time{}
+	task.Checkpoint.PrimaryKey = nil
+	task.Checkpoint.Bidirectional = nil
+	task.chunks = nil
+	task.mutex.Unlock()
+	return true, nil
+}
+
+// createTargetTableSQL 把源表的建表语句改为创建目标表：换成目标表名，去掉自增值和外键约束名，
+// 外键引用的表换成它对应的目标表，按配置覆盖存储引擎和默认字符集
+func (s *SyncService) createTargetTableSQL(targetTable string, tablePair *config.TablePair, ddl string) string {
+	sql := createTableName.ReplaceAllLiteralString(ddl, fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s`", targetTable))
+	sql = tableAutoIncrement.ReplaceAllLiteralString(sql, "")
+	sql = constraintName.ReplaceAllLiteralString(sql, "FOREIGN KEY")
+	sql = referencedTable.ReplaceAllStringFunc(sql, func(ref string) string {
+		parent := referencedTable.FindStringSubmatch(ref)[1]
+		return fmt.Sprintf("REFERENCES `%s`", s.getTableConfig(parent).Target)
+	})
+
+	if tablePair.Engine != "" {
+		sql = tableEngine.ReplaceAllLiteralString(sql, "ENGINE="+tablePair.Engine)
+	}
+	if tablePair.Charset != "" {
+		// 原来的排序规则属于源表的字符集，一并去掉，使用新字符集的默认排序规则
+		sql = tableCharset.ReplaceAllLiteralString(sql, "DEFAULT CHARSET="+tablePair.Charset)
+		sql = tableCollate.ReplaceAllLiteralString(sql, "")
+	}
+	return sql
+}
+
+// execCreateTable 在目标库建表并通知观察者；dry-run 时只记录。
+// 有外键时在同一个连接上关闭外键检查，被引用的表可以稍后再创建
+func (s *SyncService) execCreateTable(task *SyncTask, sql string) error {
+	if s.dryRun != nil {
+		s.dryRunDDL(sql)
+		return nil
+	}
+
+	var err error
+	if strings.Contains(sql, "FOREIGN KEY") {
+		err = s.targetDB.Connection(func(conn *gorm.DB) error {
+			if err := conn.Exec("SET FOREIGN_KEY_CHECKS = 0").Error; err != nil {
+				return err
+			}
+			defer conn.Exec("SET FOREIGN_KEY_CHECKS = 1")
+			return conn.Exec(sql).Error
+		})
+	} else {
+		err = s.targetDB.Exec(sql).Error
+	}
+	if err != nil {
+		return fmt.Errorf("创建目标表 %s 失败: %w", task.TargetTable, err)
+	}
+	s.notifyDDL(task, sql)
+	return nil
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"reflect"
+	"regexp"
+	"sync/internal/config"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestEnsureTargetTable(t *testing.T) {
+	sourceDB, sourceMock := newMockDB(t)
+	targetDB, targetMock := newMockDB(t)
+
+	cfg := &config.Config{}
+	cfg.Sync.TablePairs = []config.TablePair{
+		{Source: "node", Target: "node_backup", CreateIfMissing: true, Engine: "InnoDB", Charset: "utf8mb4"},
+		{Source: "node_group", Target: "node_group_backup"},
+	}
+	observer := &ddlObserver{}
+	s := &SyncService{sourceDB: sourceDB, targetDB: targetDB, config: cfg, observers: []SyncObserver{observer}}
+	task := &SyncTask{SourceTable: "node", TargetTable: "node_backup",
+		Checkpoint: Checkpoint{UpdateTime: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), PrimaryKey: []interface{}{int64(9)}}}
+
+	countRows := func(n int) *sqlmock.Rows { return sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(n) }
+	targetMock.ExpectQuery("INFORMATION_SCHEMA.TABLES").WithArgs("node_backup").WillReturnRows(countRows(0))
+	sourceMock.ExpectQuery("SHOW CREATE TABLE `node`").
+		WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("node", "CREATE TABLE `node` (\n"+
+			"  `id` int NOT NULL AUTO_INCREMENT,\n"+
+			"  `group_id` int DEFAULT NULL,\n"+
+			"  `name` varchar(64) COLLATE utf8_bin DEFAULT NULL,\n"+
+			"  PRIMARY KEY (`id`),\n"+
+			"  KEY `fk_group` (`group_id`),\n"+
+			"  CONSTRAINT `fk_group` FOREIGN KEY (`group_id`) REFERENCES `node_group` (`id`)\n"+
+			") ENGINE=MyISAM AUTO_INCREMENT=42 DEFAULT CHARSET=utf8 COLLATE=utf8_general_ci"))
+
+	// 换成目标表名和外键引用的目标表，去掉自增值和约束名，覆盖引擎和字符集；列上的排序规则保留
+	want := "CREATE TABLE IF NOT EXISTS `node_backup` (\n" +
+		"  `id` int NOT NULL AUTO_INCREMENT,\n" +
+		"  `group_id` int DEFAULT NULL,\n" +
+		"  `name` varchar(64) COLLATE utf8_bin DEFAULT NULL,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  KEY `fk_group` (`group_id`),\n" +
+		"  FOREIGN KEY (`group_id`) REFERENCES `node_group_backup` (`id`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	targetMock.ExpectExec("SET FOREIGN_KEY_CHECKS = 0").WillReturnResult(sqlmock.NewResult(0, 0))
+	targetMock.ExpectExec(regexp.QuoteMeta(want)).WillReturnResult(sqlmock.NewResult(0, 0))
+	targetMock.ExpectExec("SET FOREIGN_KEY_CHECKS = 1").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	created, err := s.ensureTargetTable(task)
+	if err != nil || !created {
+		t.Fatalf("目标表不存在时应创建: %v %v", created, err)
+	}
+	if !reflect.DeepEqual(observer.statements, []string{want}) {
+		t.Errorf("通知观察者的 DDL 不符合预期: %v", observer.statements)
+	}
+	if !task.Checkpoint.UpdateTime.IsZero() || task.Checkpoint.PrimaryKey != nil {
+		t.Errorf("新建的表应清空同步进度: %+v", task.Checkpoint)
+	}
+
+	// 目标表已存在时不再建表
+	targetMock.ExpectQuery("INFORMATION_SCHEMA.TABLES").WithArgs("node_backup").WillReturnRows(countRows(1))
+	if created, err := s.ensureTargetTable(task); err != nil || created {
+		t.Errorf("目标表已存在时不应创建: %v %v", created, err)
+	}
+
+	// 没有配置 create_if_missing 的表不检查
+	if created, err := s.ensureTargetTable(&SyncTask{SourceTable: "node_group", TargetTable: "node_group_backup"}); err != nil || created {
+		t.Errorf("没有配置 create_if_missing 时不应创建: %v %v", created, err)
+	}
+
+	if err := sourceMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("源库期望未满足: %v", err)
+	}
+	if err := targetMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("目标库期望未满足: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync/internal/config"
+	"time"
+)
+
+// discoverTables 按 discovery.tables 的模式在源库的 INFORMATION_SCHEMA.TABLES 中查找要同步的表，
+// 为 table_pairs 和之前的发现中都没有的表添加任务，返回新添加的任务。
+// 发现的表使用默认的同步设置：checksum 校验，按全局 sync.interval 调度
+func (s *SyncService) discoverTables() ([]*SyncTask, error) {
+	discovery := s.config.Sync.Discovery
+	if len(discovery.Tables) == 0 {
+		return nil, nil
+	}
+	matcher, err := config.NewTableMatcher(discovery.Tables)
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []string
+	err = s.sourceDB.Raw(`
+		SELECT TABLE_NAME
+		FROM INFORMATION_SCHEMA.TABLES
+		WHERE TABLE_SCHEMA = DATABASE()
+		AND TABLE_TYPE = 'BASE TABLE'
+		ORDER BY TABLE_NAME`).Scan(&tables).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询源库的表失败: %w", err)
+	}
+
+	var added []*SyncTask
+	for _, table := range tables {
+		if ownTable(table) || !matcher.Match(table) {
+			continue
+		}
+		if _, err := s.task(table); err == nil {
+			continue
+		}
+
+		target := discovery.TargetName(table)
+		s.AddSyncTask(table, target)
+		task, _ := s.task(table)
+		added = append(added, task)
+		log.Printf("发现新表 %s，同步到目标表 %s", table, target)
+	}
+	return added, nil
+}
+
+// ownTable 是否是同步服务自己的表，源库和目标库是同一个库时也会被查到。
+// 多个源库汇总时各源库的检查点表为 _sync_checkpoint_{source}，见 newCheckpointStore
+func ownTable(table string) bool {
+	return table == checkpointTable || strings.HasPrefix(table, checkpointTable+"_") ||
+		table == conflictTable || table == binlogPositionTable
+}
+
+// discoveryLoop 按 discovery.interval 重新发现源库的表，新表恢复检查点后启动调度循环，随 ctx 退出
+func (s *SyncService) discoveryLoop(ctx context.Context, start func(task *SyncTask) error) {
+	ticker := time.NewTicker(time.Duration(s.config.Sync.Discovery.Interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		tasks, err := s.discoverTables()
+		if err != nil {
+			log.Printf("重新发现源库的表失败: %v", err)
+			continue
+		}
+		if err := s.restoreCheckpoints(tasks); err != nil {
+			log.Printf("读取新表的检查点失败: %v", err)
+		}
+		for _, task := range tasks {
+			if err := start(task); err != nil {
+				log.Printf("启动表 %s 的同步失败: %v", task.SourceTable, err)
+			}
+		}
+	}
+}
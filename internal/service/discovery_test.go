@@ -0,0 +1,81 @@
+package service
+
+import (
+	"reflect"
+	"sync/internal/config"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestDiscoverTables(t *testing.T) {
+	sourceDB, sourceMock := newMockDB(t)
+
+	cfg := &config.Config{}
+	cfg.Sync.BatchSize = 100
+	cfg.Sync.TablePairs = []config.TablePair{{Source: "node_node", Target: "node_node", CheckMethod: "update_time", UpdateField: "updated_at"}}
+	cfg.Sync.Discovery = config.TableDiscovery{Tables: []string{"node_*", `/^log_\d+$/`, "!*_tmp"}, Target: "{table}_backup"}
+	s := &SyncService{sourceDB: sourceDB, config: cfg, tasks: make(map[string]*SyncTask)}
+	s.AddSyncTask("node_node", "node_node")
+
+	tableRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"TABLE_NAME"}).
+			AddRow("_sync_checkpoint").AddRow("log_202401").AddRow("log_x").
+			AddRow("node_node").AddRow("node_tag").AddRow("node_tag_tmp").AddRow("user")
+	}
+	sourceMock.ExpectQuery("INFORMATION_SCHEMA.TABLES").WillReturnRows(tableRows())
+	sourceMock.ExpectQuery("INFORMATION_SCHEMA.TABLES").WillReturnRows(tableRows())
+
+	added, err := s.discoverTables()
+	if err != nil {
+		t.Fatalf("发现表失败: %v", err)
+	}
+	var got []string
+	for _, task := range added {
+		got = append(got, task.SourceTable+" -> "+task.TargetTable)
+	}
+	// table_pairs 中已有的 node_node 保留自己的配置，排除模式优先
+	want := []string{"log_202401 -> log_202401_backup", "node_tag -> node_tag_backup"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("发现的表不符合预期: %v", got)
+	}
+	if pair := s.getTableConfig("node_tag"); pair.Target != "node_tag_backup" || pair.CheckMethod != "checksum" {
+		t.Errorf("发现的表应使用默认设置: %+v", pair)
+	}
+	if task, _ := s.task("node_node"); task.TargetTable != "node_node" {
+		t.Errorf("table_pairs 中的表不应被模板改名: %s", task.TargetTable)
+	}
+
+	// 再次发现时已有的表不重复添加
+	if added, err := s.discoverTables(); err != nil || len(added) != 0 {
+		t.Errorf("再次发现时不应添加任务: %v %v", added, err)
+	}
+	if err := sourceMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("源库期望未满足: %v", err)
+	}
+}
+
+func TestDiscoverTablesSkipsOwnTables(t *testing.T) {
+	sourceDB, sourceMock := newMockDB(t)
+
+	cfg := &config.Config{}
+	cfg.Sync.BatchSize = 100
+	cfg.Sync.Discovery = config.TableDiscovery{Tables: []string{"*"}, Target: "{table}"}
+	s := &SyncService{sourceDB: sourceDB, config: cfg, tasks: make(map[string]*SyncTask), source: "east"}
+
+	// 多个源库汇总到同一个库时，各源库的检查点表也在源库中
+	sourceMock.ExpectQuery("INFORMATION_SCHEMA.TABLES").WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME"}).
+		AddRow("_sync_binlog_position").AddRow("_sync_checkpoint").AddRow("_sync_checkpoint_east").
+		AddRow("_sync_checkpoint_west").AddRow("_sync_conflict").AddRow("user"))
+
+	added, err := s.discoverTables()
+	if err != nil {
+		t.Fatalf("发现表失败: %v", err)
+	}
+	if len(added) != 1 || added[0].SourceTable != "user" {
+		t.Errorf("同步服务自己的表不应被发现: %v", added)
+	}
+	if err := sourceMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("源库期望未满足: %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// dryRunSamples 报告中每种变更列出的示例主键数
+const dryRunSamples = 5
+
+// DryRunChanges 本应写入一张表的行数和示例主键
+type DryRunChanges struct {
+	Inserts int64
+	Updates int64
+	Deletes int64
+	Samples []string // 示例主键，例如 "insert id=1"，每种变更最多 5 个
+}
+
+func (c *DryRunChanges) empty() bool {
+	return c.Inserts == 0 && c.Updates == 0 && c.Deletes == 0
+}
+
+// add 记录一行变更，count 为该种变更记录后的行数，只保留前几行的主键作为示例
+func (c *DryRunChanges) add(kind string, count int64, primaryKey []string, key []interface{}) {
+	if count <= dryRunSamples {
+		c.Samples = append(c.Samples, kind+" "+RowDiff{PrimaryKey: primaryKey, Key: key}.keyString())
+	}
+}
+
+func (c *DryRunChanges) String() string {
+	return fmt.Sprintf("新增 %d 行，修改 %d 行，删除 %d 行", c.Inserts, c.Updates, c.Deletes)
+}
+
+// DryRunReport 一张表在 dry-run 中本应执行的变更
+type DryRunReport struct {
+	Source      string // 源库名称，只有一个源库时为空
+	Target      string // 目标库名称，只有一个目标库时为空
+	SourceTable string
+	TargetTable string
+	DDL         []string      // 目标表的结构变更
+	Changes     DryRunChanges // 目标表的数据变更
+	WriteBack   DryRunChanges // 双向同步写回源表的数据变更
+	Conflicts   int64         // 双向同步 conflict 为 manual 时本应记录到 _sync_conflict 的行数
+	Err         error         // 流程在该表出错，出错之后的变更没有统计
+}
+
+// Pending 是否有本应执行的变更
+func (r *DryRunReport) Pending() bool {
+	return len(r.DDL) > 0 || !r.Changes.empty() || !r.WriteBack.empty() || r.Conflicts > 0
+}
+
+// title 报告的表对，多个源库或目标库时带上库名称
+func (r *DryRunReport) title() string {
+	switch {
+	case r.Source != "":
+		return fmt.Sprintf("[%s] %s -> %s", r.Source, r.SourceTable, r.TargetTable)
+	case r.Target != "":
+		return fmt.Sprintf("[%s] %s -> %s", r.Target, r.SourceTable, r.TargetTable)
+	}
+	return fmt.Sprintf("%s -> %s", r.SourceTable, r.TargetTable)
+}
+
+func (r DryRunReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: DDL %d 条，%s", r.title(), len(r.DDL), r.Changes.String())
+	for _, ddl := range r.DDL {
+		fmt.Fprintf(&b, "\n  %s", ddl)
+	}
+	if len(r.Changes.Samples) > 0 {
+		fmt.Fprintf(&b, "\n  示例主键: %s", strings.Join(r.Changes.Samples, ", "))
+	}
+	if !r.WriteBack.empty() {
+		fmt.Fprintf(&b, "\n  写回源表: %s，示例主键: %s", r.WriteBack.String(), strings.Join(r.WriteBack.Samples, ", "))
+	}
+	if r.Conflicts > 0 {
+		fmt.Fprintf(&b, "\n  两边都修改的冲突行: %d", r.Conflicts)
+	}
+	if r.Err != nil {
+		fmt.Fprintf(&b, "\n  出错: %v", r.Err)
+	}
+	return b.String()
+}
+
+// dryRun 记录 dry-run 时本应执行的写入。dry-run 逐表顺序执行，report 为正在执行的表
+type dryRun struct {
+	sql         io.Writer // 不为空时写入本应执行的语句
+	err         error     // 写入 sql 的第一个错误
+	report      *DryRunReport
+	primaryKeys map[*batchWriter][]string // 写入的表的主键，按写入器缓存
+}
+
+// schemaPending 目标表是否有没有执行的结构变更；dry-run 之外总是 false
+func (d *dryRun) schemaPending() bool {
+	return d != nil && len(d.report.DDL) > 0
+}
+
+// statement 把本应执行的语句写入 sql
+func (d *dryRun) statement(stmt string) {
+	if d.sql == nil || d.err != nil {
+		return
+	}
+	if _, err := io.WriteString(d.sql, stmt+"\n"); err != nil {
+		d.err = fmt.Errorf("写入 SQL 文件失败: %w", err)
+	}
+}
+
+// DryRun 对每张表按顺序执行一轮完整的同步流程（表结构、是否需要同步、分页读取、清理），但不写入任何数据：
+// 本应执行的 DDL、新增、修改和删除记录在报告中，sql 不为空时把本应执行的语句写入 sql。
+// 检查点既不读取也不保存，所有表按第一次同步计算
+func (s *SyncService) DryRun(sql io.Writer) ([]DryRunReport, error) {
+	s.checkpoints = nil
+	s.dryRun = &dryRun{sql: sql, primaryKeys: make(map[*batchWriter][]string)}
+	if _, err := s.discoverTables(); err != nil {
+		return nil, err
+	}
+
+	tables := make([]string, 0, len(s.tasks))
+	for table := range s.tasks {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	reports := make([]DryRunReport, 0, len(tables))
+	for _, table := range tables {
+		if s.stopping() {
+			return reports, ErrStopping
+		}
+
+		task := s.tasks[table]
+		report := &DryRunReport{Source: s.source, Target: s.target, SourceTable: task.SourceTable, TargetTable: task.TargetTable}
+		s.dryRun.report = report
+		s.dryRun.statement("-- " + report.title())
+
+		s.syncTable(task)
+		task.mutex.RLock()
+		if task.Status == "error" {
+			report.Err = task.Error
+		}
+		task.mutex.RUnlock()
+		reports = append(reports, *report)
+	}
+	return reports, s.dryRun.err
+}
+
+// dryRunDDL 记录本应执行的 DDL
+func (s *SyncService) dryRunDDL(sql string) {
+	log.Printf("dry-run: 不执行 %s", sql)
+	s.dryRun.report.DDL = append(s.dryRun.report.DDL, sql)
+	s.dryRun.statement(sql + ";")
+}
+
+// dryRunNewTable 目标表在 dry-run 中没有真正创建，不再对比结构和数据，源表满足 filter 的行都算作新增
+func (s *SyncService) dryRunNewTable(task *SyncTask) error {
+	var count int64
+	if err := s.filteredSource(s.sourceDB, task.SourceTable).Count(&count).Error; err != nil {
+		return fmt.Errorf("获取源表记录数失败: %w", err)
+	}
+	s.dryRun.report.Changes.Inserts = count
+	log.Printf("dry-run: 目标表 %s 不存在，不写入源表的 %d 条记录", task.TargetTable, count)
+	return nil
+}
+
+// dryRunUpsert 按主键查询写入的表中已有的行，把一批记录分为新增、修改和不变，只记录不写入。
+// 目标表还没有加上的字段视为不同，已有的行算作修改
+func (s *SyncService) dryRunUpsert(db *gorm.DB, writer *batchWriter, records []map[string]interface{}) error {
+	changes := &s.dryRun.report.Changes
+	if db == s.sourceDB {
+		changes = &s.dryRun.report.WriteBack
+	}
+
+	primaryKey, ok := s.dryRun.primaryKeys[writer]
+	if !ok {
+		var err error
+		if primaryKey, err = s.getPrimaryKey(db, writer.table); err != nil {
+			return err
+		}
+		s.dryRun.primaryKeys[writer] = primaryKey
+	}
+
+	known := make(map[string]bool, len(writer.tableColumns))
+	for _, col := range writer.tableColumns {
+		known[col] = true
+	}
+	var columns []string
+	for _, col := range writer.columnsOf(records[0]) {
+		if known[col] {
+			columns = append(columns, col)
+		}
+	}
+
+	keys := make([][]interface{}, len(records))
+	for i, record := range records {
+		keys[i] = keyOf(record, primaryKey)
+	}
+	condition, args := buildKeyCondition(primaryKey, keys)
+	var rows []map[string]interface{}
+	if err := db.Table(writer.table).Select(quoteColumns(columns)).Where(condition, args...).Find(&rows).Error; err != nil {
+		return fmt.Errorf("读取表 %s 已有的行失败: %w", writer.table, err)
+	}
+	existing := make(map[string]map[string]interface{}, len(rows))
+	for _, row := range rows {
+		existing[formatKey(keyOf(row, primaryKey))] = row
+	}
+
+	for i, record := range records {
+		row, ok := existing[formatKey(keys[i])]
+		switch {
+		case !ok:
+			changes.Inserts++
+			changes.add("insert", changes.Inserts, primaryKey, keys[i])
+		case len(columns) < len(record) || len(changedColumns(record, row, columns)) > 0:
+			changes.Updates++
+			changes.add("update", changes.Updates, primaryKey, keys[i])
+		default:
+			continue
+		}
+		s.dryRun.statement(writer.literalStatement(record))
+	}
+	return nil
+}
+
+// dryRunDelete 记录本应从目标表删除的行
+func (s *SyncService) dryRunDelete(task *SyncTask, primaryKey []string, keys [][]interface{}) {
+	changes := &s.dryRun.report.Changes
+	scope := s.targetScope()
+	for _, key := range keys {
+		changes.Deletes++
+		changes.add("delete", changes.Deletes, primaryKey, key)
+
+		where := make([]string, len(primaryKey), len(primaryKey)+1)
+		for i, col := range primaryKey {
+			where[i] = fmt.Sprintf("`%s` = %s", col, sqlLiteral(key[i]))
+		}
+		if scope != "" {
+			where = append(where, scope)
+		}
+		s.dryRun.statement(fmt.Sprintf("DELETE FROM `%s` WHERE %s;", task.TargetTable, strings.Join(where, " AND ")))
+	}
+	log.Printf("dry-run: 不删除目标表 %s 的 %d 条记录", task.TargetTable, len(keys))
+}
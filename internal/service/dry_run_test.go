@@ -0,0 +1,104 @@
+package service
+
+import (
+	"bytes"
+	"strings"
+	"sync/internal/config"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestDryRun(t *testing.T) {
+	sourceDB, sourceMock := newMockDB(t)
+	targetDB, targetMock := newMockDB(t)
+
+	cfg := &config.Config{}
+	cfg.Sync.BatchSize = 10
+	cfg.Sync.TablePairs = []config.TablePair{{Source: "user", Target: "user_backup", CheckMethod: "count"}}
+	s := &SyncService{sourceDB: sourceDB, targetDB: targetDB, config: cfg, tasks: make(map[string]*SyncTask)}
+	s.AddSyncTask("user", "user_backup")
+	columnRows := func(columns ...string) *sqlmock.Rows {
+		rows := sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE", "IS_NULLABLE", "COLUMN_DEFAULT", "EXTRA", "COLUMN_COMMENT"})
+		for _, col := range columns {
+			rows.AddRow(col, "varchar(64)", "YES", nil, "", "")
+		}
+		return rows
+	}
+	columnNames := func(columns ...string) *sqlmock.Rows {
+		rows := sqlmock.NewRows([]string{"COLUMN_NAME"})
+		for _, col := range columns {
+			rows.AddRow(col)
+		}
+		return rows
+	}
+
+	// 目标表缺少 email：只记录 DDL，不再比较两边，按需要全量同步处理
+	sourceMock.ExpectQuery("INFORMATION_SCHEMA.COLUMNS").WithArgs("user").WillReturnRows(columnRows("id", "name", "email"))
+	targetMock.ExpectQuery("INFORMATION_SCHEMA.COLUMNS").WithArgs("user_backup").WillReturnRows(columnRows("id", "name"))
+	sourceMock.ExpectQuery("INFORMATION_SCHEMA.STATISTICS").WithArgs("user").WillReturnRows(indexRows("PRIMARY", "id"))
+	targetMock.ExpectQuery("INFORMATION_SCHEMA.STATISTICS").WithArgs("user_backup").WillReturnRows(indexRows("PRIMARY", "id"))
+	sourceMock.ExpectQuery("INFORMATION_SCHEMA.COLUMNS").WithArgs("user").WillReturnRows(columnNames("id", "name", "email"))
+	sourceMock.ExpectQuery("INFORMATION_SCHEMA.STATISTICS").WithArgs("user").WillReturnRows(primaryKeyRows("PRIMARY", "id"))
+	targetMock.ExpectQuery("INFORMATION_SCHEMA.COLUMNS").WithArgs("user_backup").WillReturnRows(columnRows("id", "name"))
+	targetMock.ExpectQuery("SELECT @@max_allowed_packet").
+		WillReturnRows(sqlmock.NewRows([]string{"@@max_allowed_packet"}).AddRow(4194304))
+
+	// 读取源表，按主键查询目标表已有的行：1 存在（缺少 email 算修改），2 不存在
+	sourceMock.ExpectQuery("SELECT `id`, `name`, `email` FROM `user` ORDER BY `id` LIMIT \\?").WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email"}).AddRow(1, "alice", "a@x.com").AddRow(2, "bob", "b@x.com"))
+	targetMock.ExpectQuery("INFORMATION_SCHEMA.STATISTICS").WithArgs("user_backup").WillReturnRows(primaryKeyRows("PRIMARY", "id"))
+	targetMock.ExpectQuery("SELECT `id`, `name` FROM `user_backup` WHERE `id` IN \\(\\?, \\?\\)").WithArgs(int64(1), int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "alice"))
+
+	// 清理：目标表多出 3
+	sourceMock.ExpectQuery("SELECT `id` FROM `user` ORDER BY `id` LIMIT \\?").WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	targetMock.ExpectQuery("SELECT `id` FROM `user_backup` ORDER BY `id` LIMIT \\?").WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(3))
+
+	var sql bytes.Buffer
+	reports, err := s.DryRun(&sql)
+	if err != nil {
+		t.Fatalf("dry-run 失败: %v", err)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("应有 1 张表的报告: %v", reports)
+	}
+	report := reports[0]
+	if report.Err != nil {
+		t.Fatalf("表 user 出错: %v", report.Err)
+	}
+	if len(report.DDL) != 1 || !strings.Contains(report.DDL[0], "ADD COLUMN `email`") {
+		t.Errorf("DDL 错误: %v", report.DDL)
+	}
+	changes := report.Changes
+	if changes.Inserts != 1 || changes.Updates != 1 || changes.Deletes != 1 {
+		t.Errorf("变更行数错误: %s", changes.String())
+	}
+	if want := "update id=1,insert id=2,delete id=3"; strings.Join(changes.Samples, ",") != want {
+		t.Errorf("示例主键错误: %v", changes.Samples)
+	}
+	if !report.Pending() {
+		t.Errorf("有变更的表应返回 Pending")
+	}
+
+	for _, want := range []string{
+		"-- user -> user_backup\n",
+		"ALTER TABLE `user_backup` ADD COLUMN `email` varchar(64) NULL;\n",
+		"INSERT INTO `user_backup` (`id`, `name`, `email`) VALUES (1, 'alice', 'a@x.com') ON DUPLICATE KEY UPDATE",
+		"DELETE FROM `user_backup` WHERE `id` = 3;\n",
+	} {
+		if !strings.Contains(sql.String(), want) {
+			t.Errorf("SQL 中缺少 %q:\n%s", want, sql.String())
+		}
+	}
+
+	// 没有任何 Exec 预期，写入目标库会使期望不满足
+	if err := sourceMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("源库期望未满足: %v", err)
+	}
+	if err := targetMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("目标库期望未满足: %v", err)
+	}
+}
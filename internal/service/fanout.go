@@ -0,0 +1,210 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+)
+
+const (
+	fanoutMaxPages   = 64               // 一个读取流最多保留的页数，落后更多的目标库脱离读取流，自己读取
+	fanoutJoinWindow = 30 * time.Second // 读取流开启后，同一轮的其他目标库在这段时间内开始读取还能从第一页加入
+)
+
+// fanout 一个源库同步到多个目标库时，让同步同一张源表的目标库共用源表的读取：
+//   - 各目标库共用每张表的调度时间，同一时间开始一轮同步，见 nextRun
+//   - 同时在同步一张表的目标库组成一轮（fanoutRound），一轮中起点、列和条件都相同的读取组成一个读取流，
+//     每页只查询一次源库，依次交给流中的每个目标库写入
+//   - 读取流按最快的目标库的进度读取，不等慢的目标库；落后超过 fanoutMaxPages 页的目标库脱离读取流，
+//     从自己的进度接着直接读源库。起点、列或条件不同（例如按各自的水位增量同步、从各自的检查点继续）的目标库
+//     从一开始就自己读取
+//
+// 判断是否需要同步的校验查询（count、checksum、update_time 的水位）不经过这里，每个目标库各自查询
+type fanout struct {
+	mutex    sync.Mutex
+	ticks    map[string]time.Time    // 源表 → 各目标库共用的下一次调度时间
+	rounds   map[string]*fanoutRound // 源表 → 正在进行的一轮
+	maxPages int
+}
+
+// fanoutRound 同时在同步一张源表的目标库
+type fanoutRound struct {
+	mutex    sync.Mutex
+	active   int                    // 正在同步该表的目标库数
+	streams  map[string]*pageStream // key: 第一页的 SQL
+	maxPages int
+}
+
+// pageStream 一个按主键顺序读取源表的读取流。每页由最先需要它的目标库查询，其他目标库取同一个结果；
+// 所有目标库都取过的页释放
+type pageStream struct {
+	opened  time.Time
+	joined  int // 加入过的目标库数
+	base    int // pages[0] 的页号
+	pages   []*streamPage
+	readers map[*keysetCursor]int // 订阅的游标 → 下一个要取的页号，小于 base 表示已脱离
+}
+
+type streamPage struct {
+	ready   chan struct{} // 查询结束后关闭
+	records []map[string]interface{}
+	err     error
+}
+
+func newFanout() *fanout {
+	return &fanout{ticks: make(map[string]time.Time), rounds: make(map[string]*fanoutRound), maxPages: fanoutMaxPages}
+}
+
+// nextRun 表 table 下一次同步的时间。第一个算到的目标库按 schedule 定下时间，其他目标库在这个时间之前算时沿用，
+// 上一轮结束较晚的目标库错过这个时间后再定下一次
+func (f *fanout) nextRun(table string, schedule cron.Schedule) time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	now := time.Now()
+	at := f.ticks[table]
+	if !at.After(now) {
+		at = schedule.Next(now)
+		f.ticks[table] = at
+	}
+	return at
+}
+
+// enter 一个目标库开始同步表 table，加入正在进行的一轮，没有时开始新的一轮；同步结束后调用 leave
+func (f *fanout) enter(table string) *fanoutRound {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	round := f.rounds[table]
+	if round == nil {
+		round = &fanoutRound{streams: make(map[string]*pageStream), maxPages: f.maxPages}
+		f.rounds[table] = round
+	}
+	round.mutex.Lock()
+	round.active++
+	round.mutex.Unlock()
+	return round
+}
+
+// leave 一个目标库结束本轮同步，最后一个目标库离开时释放本轮的读取流
+func (f *fanout) leave(table string, round *fanoutRound) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	round.mutex.Lock()
+	round.active--
+	last := round.active == 0
+	round.mutex.Unlock()
+	if last && f.rounds[table] == round {
+		delete(f.rounds, table)
+	}
+}
+
+// next 从读取流取游标 c 的下一页，build 构建 c 自己读下一页的查询。c 第一次读取时按第一页的 SQL 加入读取流，
+// 没有可以加入的流时开启一个。ok 为 false 时 c 不在读取流中（只有一个目标库、起点不同、落后太多或共用的页读取失败），
+// 调用方自己读取；shared 为 true 表示这一页是其他目标库查询的。返回的行可能同时交给其他目标库，调用方不能修改
+func (r *fanoutRound) next(c *keysetCursor, db *gorm.DB, build func(tx *gorm.DB) *gorm.DB) (records []map[string]interface{}, shared, ok bool, err error) {
+	r.mutex.Lock()
+	stream := c.stream
+	if stream == nil {
+		if stream = r.join(c, db, build); stream == nil {
+			r.mutex.Unlock()
+			return nil, false, false, nil
+		}
+		c.stream = stream
+	}
+
+	pos := stream.readers[c]
+	if pos < stream.base {
+		// 落后太多，需要的页已经释放
+		delete(stream.readers, c)
+		r.mutex.Unlock()
+		return nil, false, false, nil
+	}
+	var page *streamPage
+	read := pos-stream.base == len(stream.pages)
+	if read {
+		page = &streamPage{ready: make(chan struct{})}
+		stream.pages = append(stream.pages, page)
+	} else {
+		page = stream.pages[pos-stream.base]
+	}
+	stream.readers[c] = pos + 1
+	r.trim(stream)
+	r.mutex.Unlock()
+
+	if read {
+		unlock := lockSnapshot(db)
+		page.err = build(db).Find(&page.records).Error
+		unlock()
+		close(page.ready)
+	} else {
+		<-page.ready
+	}
+	if page.err != nil {
+		// 出错的页不保留，其他目标库脱离读取流，自己重新读取
+		r.mutex.Lock()
+		if i := pos - stream.base; i >= 0 && i < len(stream.pages) && stream.pages[i] == page {
+			stream.pages = stream.pages[:i]
+		}
+		delete(stream.readers, c)
+		r.mutex.Unlock()
+		if read {
+			return nil, false, true, page.err
+		}
+		return nil, false, false, nil
+	}
+	return page.records, !read, true, nil
+}
+
+// join 按 c 第一页的 SQL 找到可以加入的读取流，还没有时开启一个；本轮只有一个目标库或流已经读过了第一页时返回空
+func (r *fanoutRound) join(c *keysetCursor, db *gorm.DB, build func(tx *gorm.DB) *gorm.DB) *pageStream {
+	if r.active < 2 {
+		return nil
+	}
+	key := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		return build(tx).Find(&[]map[string]interface{}{})
+	})
+	if conn, ok := db.Statement.ConnPool.(*snapshotConn); ok {
+		// 不同快照中同样的 SQL 读到的数据可能不同，只在同一个快照的读取之间共享
+		key = fmt.Sprintf("snapshot %d: %s", conn.id, key)
+	}
+
+	stream := r.streams[key]
+	if stream == nil {
+		stream = &pageStream{opened: time.Now(), readers: make(map[*keysetCursor]int)}
+		r.streams[key] = stream
+	} else if !r.joinable(stream) {
+		return nil
+	}
+	stream.joined++
+	stream.readers[c] = 0
+	return stream
+}
+
+// joinable 流的第一页还在，并且本轮还有目标库可能加入
+func (r *fanoutRound) joinable(stream *pageStream) bool {
+	return stream.base == 0 && stream.joined < r.active && time.Since(stream.opened) < fanoutJoinWindow
+}
+
+// trim 释放所有订阅的游标都取过的页；为还没开始读取的目标库保留第一页起的页，最多保留 maxPages 页，
+// 超出时释放最早的页，还没取到这些页的游标脱离读取流
+func (r *fanoutRound) trim(stream *pageStream) {
+	lowest := stream.base + len(stream.pages)
+	for _, pos := range stream.readers {
+		if pos >= stream.base && pos < lowest {
+			lowest = pos
+		}
+	}
+	drop := lowest - stream.base
+	if r.joinable(stream) {
+		drop = 0
+	}
+	drop = max(drop, len(stream.pages)-r.maxPages)
+	if drop <= 0 {
+		return
+	}
+	clear(stream.pages[:drop])
+	stream.pages = stream.pages[drop:]
+	stream.base += drop
+}
@@ -0,0 +1,424 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// fkOrder 按外键依赖排好的同步顺序，sync.foreign_key_order 开启时每轮重新读取
+type fkOrder struct {
+	// levels 每层的表只引用前面各层的表，同一层的表互不依赖、可以并发同步
+	levels [][]*SyncTask
+	// cycles 外键形成的环（包括引用自己的表），每个环按源表名排序
+	cycles [][]string
+	// cyclic 在环上的目标表，环内无法排出先后，写入和删除时仍然关闭外键检查
+	cyclic map[string]bool
+}
+
+// deferredDeletes 按外键顺序同步时推迟到删除阶段执行的删除，写入阶段在所有表上完成后子表先删。
+// 要删除的行在写入阶段读取源表时找出，与写入的数据来自同一个快照；删除阶段只删除这些行，不再读取源表。
+// 内存中最多保留一批（batch_size 行），更多的行写入临时文件，删除阶段按批读回，内存占用与多出的行数无关
+type deferredDeletes struct {
+	ready     bool // 写入阶段已完成，可以执行删除
+	resetKey  bool // 删除完成后 completeTask 的参数
+	targetKey []string
+	keys      [][]interface{} // 目标表多出的行：chunk_checksum 各块中多出的行，或源表主键中已不存在的行
+	spill     *os.File        // 写不下的行，每行一个 JSON 编码的主键
+	spilled   int64
+}
+
+// add 记下目标表多出的行，内存中超过 limit 行时写入临时文件
+func (d *deferredDeletes) add(targetKey []string, keys [][]interface{}, limit int) error {
+	d.targetKey = targetKey
+	d.keys = append(d.keys, keys...)
+	if len(d.keys) <= limit {
+		return nil
+	}
+
+	if d.spill == nil {
+		file, err := os.CreateTemp("", "sync-deletes-*.jsonl")
+		if err != nil {
+			return fmt.Errorf("创建待删除行的临时文件失败: %w", err)
+		}
+		d.spill = file
+	}
+	writer := bufio.NewWriter(d.spill)
+	for _, key := range d.keys {
+		data, err := encodeCheckpointKey(key)
+		if err != nil {
+			return err
+		}
+		writer.Write(data)
+		writer.WriteByte('\n')
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("写入待删除行的临时文件失败: %w", err)
+	}
+	d.spilled += int64(len(d.keys))
+	d.keys = d.keys[:0]
+	return nil
+}
+
+// pending 还没删除的行数
+func (d *deferredDeletes) pending() int64 {
+	return d.spilled + int64(len(d.keys))
+}
+
+// batches 按每批 size 行依次取出所有记下的行，先取临时文件中的行
+func (d *deferredDeletes) batches(size int, fn func(keys [][]interface{}) error) error {
+	if d.spill != nil {
+		if _, err := d.spill.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("读取待删除行的临时文件失败: %w", err)
+		}
+		scanner := bufio.NewScanner(d.spill)
+		scanner.Buffer(nil, 1<<20)
+		batch := make([][]interface{}, 0, size)
+		for scanner.Scan() {
+			key, err := decodeCheckpointKey(scanner.Bytes())
+			if err != nil {
+				return fmt.Errorf("解析待删除行失败: %w", err)
+			}
+			if batch = append(batch, key); len(batch) == size {
+				if err := fn(batch); err != nil {
+					return err
+				}
+				batch = batch[:0]
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("读取待删除行的临时文件失败: %w", err)
+		}
+		if len(batch) > 0 {
+			if err := fn(batch); err != nil {
+				return err
+			}
+		}
+	}
+	if len(d.keys) > 0 {
+		return fn(d.keys)
+	}
+	return nil
+}
+
+// close 删除临时文件
+func (d *deferredDeletes) close() {
+	if d.spill == nil {
+		return
+	}
+	d.spill.Close()
+	os.Remove(d.spill.Name())
+	d.spill = nil
+}
+
+// fkEdgeRow KEY_COLUMN_USAGE 中的一条外键引用
+type fkEdgeRow struct {
+	TableName           string `gorm:"column:TABLE_NAME"`
+	ReferencedTableName string `gorm:"column:REFERENCED_TABLE_NAME"`
+}
+
+// loadFKOrder 从源库和目标库的 INFORMATION_SCHEMA.KEY_COLUMN_USAGE 读取同步的表之间的外键，按依赖分层。
+// 两边的外键取并集：目标表可能还没创建，也可能有源表没有的外键
+func (s *SyncService) loadFKOrder() (*fkOrder, error) {
+	s.mutex.RLock()
+	tasks := make([]*SyncTask, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		tasks = append(tasks, task)
+	}
+	s.mutex.RUnlock()
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].SourceTable < tasks[j].SourceTable })
+
+	bySource := make(map[string]*SyncTask, len(tasks))
+	byTarget := make(map[string]*SyncTask, len(tasks))
+	for _, task := range tasks {
+		bySource[task.SourceTable] = task
+		byTarget[task.TargetTable] = task
+	}
+
+	// parents 子表 → 它引用的父表
+	parents := make(map[*SyncTask]map[*SyncTask]bool)
+	for _, side := range []struct {
+		name   string
+		db     *gorm.DB
+		tables map[string]*SyncTask
+	}{{"源库", s.sourceDB, bySource}, {"目标库", s.targetDB, byTarget}} {
+		edges, err := foreignKeyEdges(side.db)
+		if err != nil {
+			return nil, fmt.Errorf("读取%s的外键失败: %w", side.name, err)
+		}
+		for _, edge := range edges {
+			// 引用未同步的表的外键与同步顺序无关
+			child, parent := side.tables[edge.TableName], side.tables[edge.ReferencedTableName]
+			if child == nil || parent == nil {
+				continue
+			}
+			if parents[child] == nil {
+				parents[child] = make(map[*SyncTask]bool)
+			}
+			parents[child][parent] = true
+		}
+	}
+
+	order := &fkOrder{cyclic: make(map[string]bool)}
+	depths := make(map[*SyncTask]int, len(tasks))
+	for _, component := range stronglyConnected(tasks, parents) {
+		// 组件按父表在前的顺序给出，父表的层数都已确定
+		depth := 0
+		inComponent := make(map[*SyncTask]bool, len(component))
+		for _, task := range component {
+			inComponent[task] = true
+		}
+		for _, task := range component {
+			for parent := range parents[task] {
+				if !inComponent[parent] {
+					depth = max(depth, depths[parent]+1)
+				}
+			}
+		}
+		for _, task := range component {
+			depths[task] = depth
+		}
+		if depth == len(order.levels) {
+			order.levels = append(order.levels, nil)
+		}
+		order.levels[depth] = append(order.levels[depth], component...)
+
+		if len(component) > 1 || parents[component[0]][component[0]] {
+			cycle := make([]string, 0, len(component))
+			for _, task := range component {
+				cycle = append(cycle, task.SourceTable)
+				order.cyclic[task.TargetTable] = true
+			}
+			sort.Strings(cycle)
+			order.cycles = append(order.cycles, cycle)
+		}
+	}
+	for _, level := range order.levels {
+		sort.Slice(level, func(i, j int) bool { return level[i].SourceTable < level[j].SourceTable })
+	}
+	return order, nil
+}
+
+// foreignKeyEdges 查询当前库中引用本库表的外键
+func foreignKeyEdges(db *gorm.DB) ([]fkEdgeRow, error) {
+	var edges []fkEdgeRow
+	err := db.Raw(`
+		SELECT DISTINCT TABLE_NAME, REFERENCED_TABLE_NAME
+		FROM INFORMATION_SCHEMA.KEY_COLUMN_USAGE
+		WHERE TABLE_SCHEMA = DATABASE()
+		AND REFERENCED_TABLE_SCHEMA = DATABASE()
+		AND REFERENCED_TABLE_NAME IS NOT NULL`).Scan(&edges).Error
+	return edges, err
+}
+
+// stronglyConnected 用 Tarjan 算法求强连通分量。边从子表指向父表，
+// 一个分量在它能到达的分量（即它引用的父表）之后给出，结果是父表在前的拓扑顺序
+func stronglyConnected(tasks []*SyncTask, parents map[*SyncTask]map[*SyncTask]bool) [][]*SyncTask {
+	var (
+		index      = make(map[*SyncTask]int, len(tasks))
+		lowLink    = make(map[*SyncTask]int, len(tasks))
+		onStack    = make(map[*SyncTask]bool, len(tasks))
+		stack      []*SyncTask
+		components [][]*SyncTask
+	)
+
+	var visit func(task *SyncTask)
+	visit = func(task *SyncTask) {
+		index[task] = len(index)
+		lowLink[task] = index[task]
+		stack = append(stack, task)
+		onStack[task] = true
+
+		// 按表名遍历父表，同样的外键每轮得到同样的顺序
+		next := make([]*SyncTask, 0, len(parents[task]))
+		for parent := range parents[task] {
+			next = append(next, parent)
+		}
+		sort.Slice(next, func(i, j int) bool { return next[i].SourceTable < next[j].SourceTable })
+		for _, parent := range next {
+			if _, visited := index[parent]; !visited {
+				visit(parent)
+				lowLink[task] = min(lowLink[task], lowLink[parent])
+			} else if onStack[parent] {
+				lowLink[task] = min(lowLink[task], index[parent])
+			}
+		}
+
+		if lowLink[task] == index[task] {
+			var component []*SyncTask
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				component = append(component, top)
+				if top == task {
+					break
+				}
+			}
+			components = append(components, component)
+		}
+	}
+
+	for _, task := range tasks {
+		if _, visited := index[task]; !visited {
+			visit(task)
+		}
+	}
+	return components
+}
+
+// foreignKeyChecks 写入目标表 table 时是否保持外键检查：只有按外键顺序同步且不在环上的表保持，
+// 其他情况下并发写入的父子表先后不定，仍然关闭外键检查
+func (s *SyncService) foreignKeyChecks(table string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.fkOrder != nil && !s.fkOrder.cyclic[table]
+}
+
+// setForeignKeyChecks 在事务的连接上打开或关闭外键检查。会话变量随连接留在连接池中，
+// 之前关闭过检查的连接会被其他表复用，保持检查时也要显式打开
+func setForeignKeyChecks(tx *gorm.DB, on bool) error {
+	if on {
+		return tx.Exec("SET FOREIGN_KEY_CHECKS = 1").Error
+	}
+	return tx.Exec("SET FOREIGN_KEY_CHECKS = 0").Error
+}
+
+// runOrdered 按外键顺序每隔 sync.interval 同步一轮所有表，替代逐表的调度循环，随 ctx 退出
+func (s *SyncService) runOrdered(ctx context.Context) error {
+	var wg sync.WaitGroup
+	if len(s.config.Sync.Discovery.Tables) > 0 {
+		// 发现的表在下一轮重新读取外键时排入顺序
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.discoveryLoop(ctx, func(task *SyncTask) error { return nil })
+		}()
+	}
+
+	ticker := time.NewTicker(time.Duration(s.config.Sync.Interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return nil
+		case <-ticker.C:
+		}
+		s.syncOrdered()
+	}
+}
+
+// syncOrdered 按外键顺序同步一轮：写入阶段父表所在的层先同步，目标表多余的行不删除；
+// 全部写完后删除阶段反过来子表所在的层先删除。父表同步失败时子表照常同步，引用缺失的行由外键检查报错
+func (s *SyncService) syncOrdered() {
+	order, err := s.loadFKOrder()
+	if err != nil {
+		log.Printf("读取外键依赖失败，跳过本轮同步: %v", err)
+		return
+	}
+	for _, cycle := range order.cycles {
+		if len(cycle) == 1 {
+			log.Printf("警告: 表 %s 的外键引用自己，写入时关闭外键检查", cycle[0])
+		} else {
+			log.Printf("警告: 表 %s 之间的外键形成环，无法排出先后，写入时关闭外键检查", strings.Join(cycle, "、"))
+		}
+	}
+	s.mutex.Lock()
+	s.fkOrder = order
+	s.mutex.Unlock()
+
+	started := make([][]*SyncTask, 0, len(order.levels))
+	for _, level := range order.levels {
+		var tasks []*SyncTask
+		for _, task := range level {
+			if s.stopping() || !task.tryStart() {
+				continue
+			}
+			task.deletes = &deferredDeletes{}
+			tasks = append(tasks, task)
+		}
+		s.runLevel(tasks, func(task *SyncTask) {
+			task.mutex.Lock()
+			task.Status = "running"
+			task.mutex.Unlock()
+			s.syncTable(task)
+		})
+		started = append(started, tasks)
+	}
+
+	for i := len(started) - 1; i >= 0; i-- {
+		s.runLevel(started[i], s.applyDeletes)
+	}
+	for _, tasks := range started {
+		for _, task := range tasks {
+			task.deletes.close()
+			task.mutex.Lock()
+			task.deletes = nil
+			task.running = false
+			task.mutex.Unlock()
+		}
+	}
+}
+
+// runLevel 并发执行同一层的表，受 max_concurrency 限制，全部结束后返回
+func (s *SyncService) runLevel(tasks []*SyncTask, run func(task *SyncTask)) {
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		wg.Add(1)
+		s.inflight.Add(1)
+		go func(task *SyncTask) {
+			defer wg.Done()
+			defer s.inflight.Done()
+			if !s.acquireSlot() {
+				return
+			}
+			defer s.releaseSlot()
+			run(task)
+		}(task)
+	}
+	wg.Wait()
+}
+
+// applyDeletes 执行写入阶段推迟的删除，完成后才标记本轮同步成功
+func (s *SyncService) applyDeletes(task *SyncTask) {
+	deletes := task.deletes
+	if !deletes.ready {
+		return
+	}
+	if s.stopping() {
+		s.stopTask(task)
+		return
+	}
+
+	if deletes.pending() > 0 {
+		var deleted int64
+		err := deletes.batches(task.BatchSize, func(keys [][]interface{}) error {
+			n, err := s.deleteTargetKeys(task, deletes.targetKey, keys)
+			deleted += n
+			return err
+		})
+		s.notifyRowsDeleted(task, deleted)
+		if err != nil {
+			s.notifyError(task, PhaseCleanup, fmt.Errorf("删除目标表多余的记录失败: %w", err))
+			return
+		}
+		if deleted > 0 {
+			log.Printf("已从目标表 %s 删除 %d 条源表中不存在的记录", task.TargetTable, deleted)
+		}
+	}
+	if s.stopping() {
+		s.stopTask(task)
+		return
+	}
+	s.completeTask(task, deletes.resetKey)
+}
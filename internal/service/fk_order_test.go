@@ -0,0 +1,158 @@
+package service
+
+import (
+	"database/sql/driver"
+	"os"
+	"reflect"
+	"strings"
+	"sync/internal/config"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestLoadFKOrder(t *testing.T) {
+	sourceDB, sourceMock := newMockDB(t)
+	targetDB, targetMock := newMockDB(t)
+
+	cfg := &config.Config{}
+	cfg.Sync.BatchSize = 100
+	s := &SyncService{sourceDB: sourceDB, targetDB: targetDB, config: cfg, tasks: make(map[string]*SyncTask)}
+	for _, table := range []string{"node_node", "node_resourcegroup", "node_tag", "a", "b", "tree"} {
+		s.AddSyncTask(table, table+"_backup")
+	}
+
+	edgeColumns := []string{"TABLE_NAME", "REFERENCED_TABLE_NAME"}
+	// 引用未同步的 user 表的外键不影响顺序
+	sourceMock.ExpectQuery("INFORMATION_SCHEMA.KEY_COLUMN_USAGE").
+		WillReturnRows(sqlmock.NewRows(edgeColumns).
+			AddRow("node_node", "node_resourcegroup").
+			AddRow("node_node", "user").
+			AddRow("a", "b").AddRow("b", "a").
+			AddRow("tree", "tree"))
+	// 只有目标库有的外键按目标表名对应
+	targetMock.ExpectQuery("INFORMATION_SCHEMA.KEY_COLUMN_USAGE").
+		WillReturnRows(sqlmock.NewRows(edgeColumns).
+			AddRow("node_tag_backup", "node_node_backup"))
+
+	order, err := s.loadFKOrder()
+	if err != nil {
+		t.Fatalf("读取外键顺序失败: %v", err)
+	}
+	var levels [][]string
+	for _, level := range order.levels {
+		var tables []string
+		for _, task := range level {
+			tables = append(tables, task.SourceTable)
+		}
+		levels = append(levels, tables)
+	}
+	want := [][]string{{"a", "b", "node_resourcegroup", "tree"}, {"node_node"}, {"node_tag"}}
+	if !reflect.DeepEqual(levels, want) {
+		t.Errorf("同步顺序不符合预期: %v", levels)
+	}
+	if want := [][]string{{"a", "b"}, {"tree"}}; !reflect.DeepEqual(order.cycles, want) {
+		t.Errorf("外键环不符合预期: %v", order.cycles)
+	}
+
+	// 环上的表仍然关闭外键检查，其他表保持
+	s.fkOrder = order
+	if !s.foreignKeyChecks("node_node_backup") || s.foreignKeyChecks("a_backup") || s.foreignKeyChecks("tree_backup") {
+		t.Errorf("外键检查设置不符合预期: %v", order.cyclic)
+	}
+
+	task, _ := s.task("node_node")
+	targetMock.ExpectBegin()
+	targetMock.ExpectExec("SET FOREIGN_KEY_CHECKS = 1").WillReturnResult(sqlmock.NewResult(0, 0))
+	targetMock.ExpectExec("DELETE FROM `node_node_backup`").WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	targetMock.ExpectCommit()
+	if _, err := s.deleteTargetKeys(task, []string{"id"}, [][]interface{}{{int64(1)}}); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+
+	if err := sourceMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("源库期望未满足: %v", err)
+	}
+	if err := targetMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("目标库期望未满足: %v", err)
+	}
+}
+
+func TestDeferredCleanup(t *testing.T) {
+	sourceDB, sourceMock := newMockDB(t)
+	targetDB, targetMock := newMockDB(t)
+
+	cfg := &config.Config{}
+	s := &SyncService{sourceDB: sourceDB, targetDB: targetDB, config: cfg, tasks: make(map[string]*SyncTask)}
+	task := &SyncTask{SourceTable: "user", TargetTable: "user_backup", BatchSize: 100, deletes: &deferredDeletes{}}
+
+	// 写入阶段只比对主键，找出目标表多出的 2，不删除
+	sourceMock.ExpectQuery("SELECT `id` FROM `user` ORDER BY `id` LIMIT \\?").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(1)).AddRow(int64(3)))
+	targetMock.ExpectQuery("SELECT `id` FROM `user_backup` ORDER BY `id` LIMIT \\?").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(1)).AddRow(int64(2)).AddRow(int64(3)))
+	if deleted, err := s.cleanupTargetTable(task, sourceDB, []string{"id"}, []string{"id"}); err != nil || deleted != 0 {
+		t.Fatalf("写入阶段不应删除: %d %v", deleted, err)
+	}
+	if want := [][]interface{}{{int64(2)}}; !reflect.DeepEqual(task.deletes.keys, want) {
+		t.Fatalf("应记下目标表多出的行: %v", task.deletes.keys)
+	}
+
+	// 删除阶段不再读取源表，只删除写入阶段找出的行
+	task.deletes.ready = true
+	targetMock.ExpectBegin()
+	targetMock.ExpectExec("SET FOREIGN_KEY_CHECKS = 0").WillReturnResult(sqlmock.NewResult(0, 0))
+	targetMock.ExpectExec("DELETE FROM `user_backup` WHERE `id` IN \\(\\?\\)").WithArgs(int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	targetMock.ExpectCommit()
+	s.applyDeletes(task)
+	if task.Status != "completed" {
+		t.Errorf("删除完成后应标记本轮同步成功: %s", task.Status)
+	}
+
+	if err := sourceMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("源库期望未满足: %v", err)
+	}
+	if err := targetMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("目标库期望未满足: %v", err)
+	}
+}
+
+func TestDeferredDeletesSpill(t *testing.T) {
+	targetDB, mock := newMockDB(t)
+	s := &SyncService{targetDB: targetDB, config: &config.Config{}}
+	task := &SyncTask{SourceTable: "user", TargetTable: "user_backup", BatchSize: 2, deletes: &deferredDeletes{}}
+
+	// 内存中超过一批的行写入临时文件，只留下最后不足一批的行
+	for _, keys := range [][][]interface{}{{{int64(1)}, {int64(2)}}, {{int64(3)}}, {{int64(4)}, {int64(5)}}} {
+		if err := task.deletes.add([]string{"id"}, keys, task.BatchSize); err != nil {
+			t.Fatalf("记下待删除行失败: %v", err)
+		}
+	}
+	if len(task.deletes.keys) > task.BatchSize || task.deletes.pending() != 5 {
+		t.Fatalf("待删除行应写入临时文件: 内存中 %d 行，共 %d 行", len(task.deletes.keys), task.deletes.pending())
+	}
+	spill := task.deletes.spill.Name()
+
+	// 删除阶段按批读回
+	task.deletes.ready = true
+	for _, batch := range [][]driver.Value{{int64(1), int64(2)}, {int64(3)}, {int64(4), int64(5)}} {
+		placeholders := strings.TrimSuffix(strings.Repeat("\\?, ", len(batch)), ", ")
+		mock.ExpectBegin()
+		mock.ExpectExec("SET FOREIGN_KEY_CHECKS = 0").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("DELETE FROM `user_backup` WHERE `id` IN \\(" + placeholders + "\\)").WithArgs(batch...).
+			WillReturnResult(sqlmock.NewResult(0, int64(len(batch))))
+		mock.ExpectCommit()
+	}
+	s.applyDeletes(task)
+	if task.Status != "completed" {
+		t.Errorf("删除完成后应标记本轮同步成功: %s", task.Status)
+	}
+
+	task.deletes.close()
+	if _, err := os.Stat(spill); !os.IsNotExist(err) {
+		t.Errorf("本轮结束后应删除临时文件: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("目标库期望未满足: %v", err)
+	}
+}
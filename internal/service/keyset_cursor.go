@@ -0,0 +1,150 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// keysetCursor 按主键顺序分批读取数据，用上一批最后一行的主键作为下一批的起点，
+// 代替 OFFSET/LIMIT 分页：每批都走主键索引，读取期间源表有写入也不会跳行或重复读
+type keysetCursor struct {
+	table      string
+	primaryKey []string
+	batchSize  int
+	columns    []string      // 读取的列，为空时读取全部列
+	selects    string        // 原样使用的 SELECT 列表（列映射时使用），优先于 columns
+	filter     string        // 表对的 filter 条件，只读取满足条件的行
+	round      *fanoutRound  // 不为空时和同一轮的其他目标库共用读取，见 fanout
+	stream     *pageStream   // 加入的读取流
+	solo       bool          // 不在读取流中，直接读取源库
+	shared     bool          // 上一批是其他目标库查询的，不再计入读取限速
+	last       []interface{} // 上一批最后一行的主键，nil 表示从头开始
+	done       bool
+}
+
+func newKeysetCursor(table string, primaryKey []string, batchSize int) *keysetCursor {
+	return &keysetCursor{table: table, primaryKey: primaryKey, batchSize: batchSize}
+}
+
+// next 读取下一批数据，where 为额外的过滤条件（例如增量同步的更新时间），读完后返回空切片
+func (c *keysetCursor) next(db *gorm.DB, where string, args ...interface{}) ([]map[string]interface{}, error) {
+	if c.done {
+		return nil, nil
+	}
+
+	build := func(tx *gorm.DB) *gorm.DB {
+		query := tx.Table(c.table)
+		if where != "" {
+			query = query.Where(where, args...)
+		}
+		if c.filter != "" {
+			query = query.Where("(" + c.filter + ")")
+		}
+		if c.last != nil {
+			condition, keyArgs := keysetCondition(c.primaryKey, c.last)
+			query = query.Where(condition, keyArgs...)
+		}
+
+		if c.selects != "" {
+			query = query.Select(c.selects)
+		} else if len(c.columns) > 0 {
+			query = query.Select(quoteColumns(c.columns))
+		}
+		return query.Order(quoteColumns(c.primaryKey)).Limit(c.batchSize)
+	}
+
+	records, err := c.read(db, build)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) < c.batchSize {
+		c.done = true
+	}
+	if len(records) > 0 {
+		c.last = keyOf(records[len(records)-1], c.primaryKey)
+	}
+	return records, nil
+}
+
+// read 读取一批：在读取流中时从流中取，否则直接查询
+func (c *keysetCursor) read(db *gorm.DB, build func(tx *gorm.DB) *gorm.DB) ([]map[string]interface{}, error) {
+	c.shared = false
+	if c.round != nil && !c.solo {
+		records, shared, ok, err := c.round.next(c, db, build)
+		if ok {
+			c.shared = shared
+			return records, err
+		}
+		c.solo = true
+	}
+
+	var records []map[string]interface{}
+	unlock := lockSnapshot(db)
+	err := build(db).Find(&records).Error
+	unlock()
+	return records, err
+}
+
+// keysetCondition 构建 "主键 > last" 条件，联合主键展开为
+// (a > ?) OR (a = ? AND b > ?) OR ...，保证 MySQL 能使用主键索引做范围扫描
+func keysetCondition(primaryKey []string, last []interface{}) (string, []interface{}) {
+	return keyCompareCondition(primaryKey, last, ">", ">")
+}
+
+// keyRangeCondition 构建主键范围 (lower, upper] 的条件，nil 表示该侧不设边界，两侧都不设时返回空条件
+func keyRangeCondition(primaryKey []string, lower, upper []interface{}) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if lower != nil {
+		condition, lowerArgs := keyCompareCondition(primaryKey, lower, ">", ">")
+		conditions = append(conditions, condition)
+		args = append(args, lowerArgs...)
+	}
+	if upper != nil {
+		condition, upperArgs := keyCompareCondition(primaryKey, upper, "<", "<=")
+		conditions = append(conditions, condition)
+		args = append(args, upperArgs...)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// keyCompareCondition 按字典序比较联合主键，前面的列用 op，最后一列用 lastOp
+func keyCompareCondition(primaryKey []string, values []interface{}, op, lastOp string) (string, []interface{}) {
+	var clauses []string
+	var args []interface{}
+	for i := range primaryKey {
+		parts := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			parts = append(parts, fmt.Sprintf("`%s` = ?", primaryKey[j]))
+			args = append(args, values[j])
+		}
+		cmp := op
+		if i == len(primaryKey)-1 {
+			cmp = lastOp
+		}
+		parts = append(parts, fmt.Sprintf("`%s` %s ?", primaryKey[i], cmp))
+		args = append(args, values[i])
+		clauses = append(clauses, "("+strings.Join(parts, " AND ")+")")
+	}
+	return "(" + strings.Join(clauses, " OR ") + ")", args
+}
+
+// keyOf 取出记录的主键值
+func keyOf(record map[string]interface{}, primaryKey []string) []interface{} {
+	values := make([]interface{}, len(primaryKey))
+	for i, col := range primaryKey {
+		values[i] = record[col]
+	}
+	return values
+}
+
+func quoteColumns(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = fmt.Sprintf("`%s`", col)
+	}
+	return strings.Join(quoted, ", ")
+}
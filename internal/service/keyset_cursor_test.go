@@ -0,0 +1,55 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestKeysetCondition(t *testing.T) {
+	condition, args := keysetCondition([]string{"id"}, []interface{}{10})
+	if condition != "((`id` > ?))" || !reflect.DeepEqual(args, []interface{}{10}) {
+		t.Errorf("单列主键条件错误: %s %v", condition, args)
+	}
+
+	condition, args = keysetCondition([]string{"user_id", "group_id"}, []interface{}{1, 2})
+	want := "((`user_id` > ?) OR (`user_id` = ? AND `group_id` > ?))"
+	if condition != want || !reflect.DeepEqual(args, []interface{}{1, 1, 2}) {
+		t.Errorf("联合主键条件错误: %s %v", condition, args)
+	}
+}
+
+func TestKeysetCursor(t *testing.T) {
+	db, mock := newMockDB(t)
+
+	mock.ExpectQuery("SELECT \\* FROM `node_node` WHERE `updated_at` > \\? ORDER BY `id` LIMIT \\?").
+		WithArgs("2024-01-01", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "a").AddRow(5, "b"))
+	mock.ExpectQuery("SELECT \\* FROM `node_node` WHERE `updated_at` > \\? AND \\(\\(`id` > \\?\\)\\) ORDER BY `id` LIMIT \\?").
+		WithArgs("2024-01-01", int64(5), 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(7, "c"))
+
+	cursor := newKeysetCursor("node_node", []string{"id"}, 2)
+	var total int
+	for {
+		records, err := cursor.next(db, "`updated_at` > ?", "2024-01-01")
+		if err != nil {
+			t.Fatalf("读取失败: %v", err)
+		}
+		if len(records) == 0 {
+			break
+		}
+		total += len(records)
+	}
+
+	if total != 3 {
+		t.Errorf("期望读取 3 条记录，实际 %d", total)
+	}
+	if !reflect.DeepEqual(cursor.last, []interface{}{int64(7)}) {
+		t.Errorf("游标位置错误: %v", cursor.last)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("未满足的数据库期望: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync/internal/config"
+)
+
+// maskFunc 把一个列值替换为脱敏后的值，NULL 保持为 NULL
+type maskFunc func(v interface{}) interface{}
+
+var (
+	fakeSurnames   = []string{"王", "李", "张", "刘", "陈", "杨", "黄", "赵", "吴", "周", "徐", "孙", "马", "朱", "胡", "郭"}
+	fakeGivenNames = []string{"伟", "芳", "娜", "敏", "静", "丽", "强", "磊", "军", "洋", "勇", "艳", "杰", "涛", "明", "超", "秀英", "桂兰", "志强", "建华"}
+)
+
+// newMask 按规则生成脱敏函数。hash 和 fake 由 mask_salt 和原值决定，同一个值在所有表中结果相同，
+// 脱敏后的列仍然可以在目标库中关联
+func newMask(rule config.MaskRule, salt string) maskFunc {
+	digest := func(v interface{}) []byte {
+		mac := hmac.New(sha256.New, []byte(salt))
+		mac.Write([]byte(maskText(v)))
+		return mac.Sum(nil)
+	}
+
+	switch rule.Type {
+	case "hash":
+		return func(v interface{}) interface{} {
+			if v == nil {
+				return nil
+			}
+			sum := hex.EncodeToString(digest(v))
+			if rule.Length > 0 {
+				sum = sum[:rule.Length]
+			}
+			return sum
+		}
+	case "redact":
+		value := rule.Value
+		if value == "" {
+			value = "***"
+		}
+		return func(v interface{}) interface{} {
+			if v == nil {
+				return nil
+			}
+			return value
+		}
+	case "partial":
+		return func(v interface{}) interface{} {
+			if v == nil {
+				return nil
+			}
+			return partialMask(maskText(v), rule.KeepPrefix, rule.KeepSuffix)
+		}
+	case "fake":
+		return func(v interface{}) interface{} {
+			if v == nil {
+				return nil
+			}
+			return fakeValue(rule.Kind, digest(v))
+		}
+	default: // null
+		return func(interface{}) interface{} { return nil }
+	}
+}
+
+// maskText 列值的文本形式，MySQL 驱动读出的字符串列是 []byte
+func maskText(v interface{}) string {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
+
+// partialMask 保留开头和末尾的字符，中间替换为 *；字符数不超过保留数时全部替换
+func partialMask(s string, prefix, suffix int) string {
+	runes := []rune(s)
+	if len(runes) <= prefix+suffix {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[:prefix]) + strings.Repeat("*", len(runes)-prefix-suffix) + string(runes[len(runes)-suffix:])
+}
+
+// fakeValue 由摘要确定性地生成看起来真实的假数据
+func fakeValue(kind string, sum []byte) string {
+	n := binary.BigEndian.Uint64(sum)
+	switch kind {
+	case "name":
+		surname := fakeSurnames[n%uint64(len(fakeSurnames))]
+		given := fakeGivenNames[(n/uint64(len(fakeSurnames)))%uint64(len(fakeGivenNames))]
+		return surname + given
+	case "email":
+		return "user_" + hex.EncodeToString(sum[:5]) + "@example.com"
+	default: // phone
+		return fmt.Sprintf("1%d%09d", 3+n%7, (n/7)%1000000000)
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"reflect"
+	"regexp"
+	"sync/internal/config"
+	"testing"
+)
+
+func TestNewMask(t *testing.T) {
+	const salt = "test-salt"
+	cases := []struct {
+		name  string
+		rule  config.MaskRule
+		value interface{}
+		want  interface{}
+	}{
+		{"redact 默认值", config.MaskRule{Type: "redact"}, "secret", "***"},
+		{"redact 指定值", config.MaskRule{Type: "redact", Value: "[已隐藏]"}, "secret", "[已隐藏]"},
+		{"partial 手机号", config.MaskRule{Type: "partial", KeepPrefix: 3, KeepSuffix: 4}, []byte("13812345678"), "138****5678"},
+		{"partial 中文", config.MaskRule{Type: "partial", KeepPrefix: 1}, "张三丰", "张**"},
+		{"partial 过短", config.MaskRule{Type: "partial", KeepPrefix: 3, KeepSuffix: 4}, "1234", "****"},
+		{"null", config.MaskRule{Type: "null"}, "x", nil},
+		{"NULL 保持不变", config.MaskRule{Type: "hash"}, nil, nil},
+	}
+	for _, c := range cases {
+		if got := newMask(c.rule, salt)(c.value); got != c.want {
+			t.Errorf("%s: 期望 %v，实际 %v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestHashMaskIsConsistent(t *testing.T) {
+	mask := newMask(config.MaskRule{Type: "hash", Length: 12}, "test-salt")
+	got, ok := mask([]byte("alice@example.com")).(string)
+	if !ok || !regexp.MustCompile("^[0-9a-f]{12}$").MatchString(got) {
+		t.Fatalf("hash 结果格式错误: %v", got)
+	}
+	// 两张表中的同一个邮箱脱敏后仍然相等，可以关联
+	if again := mask("alice@example.com"); again != got {
+		t.Errorf("同一个值两次结果不同: %v, %v", got, again)
+	}
+	if other := newMask(config.MaskRule{Type: "hash", Length: 12}, "other-salt")("alice@example.com"); other == got {
+		t.Errorf("换了 mask_salt 结果不应相同")
+	}
+}
+
+func TestFakeMaskIsConsistent(t *testing.T) {
+	patterns := map[string]*regexp.Regexp{
+		"name":  regexp.MustCompile(`^\p{Han}{2,3}$`),
+		"email": regexp.MustCompile(`^user_[0-9a-f]{10}@example\.com$`),
+		"phone": regexp.MustCompile(`^1[3-9]\d{9}$`),
+	}
+	for kind, pattern := range patterns {
+		mask := newMask(config.MaskRule{Type: "fake", Kind: kind}, "salt-a")
+		first := mask([]byte("alice"))
+		if !pattern.MatchString(first.(string)) {
+			t.Errorf("fake %s 格式错误: %v", kind, first)
+		}
+		// 同一个值在不同表中（[]byte 和 string 读出）结果相同
+		if again := mask("alice"); again != first {
+			t.Errorf("fake %s 结果不确定: %v, %v", kind, first, again)
+		}
+	}
+}
+
+func TestColumnMapApplyMasks(t *testing.T) {
+	s := newMappingTestService(config.ColumnMapping{Rename: map[string]string{"phone": "mobile"}})
+	s.config.Sync.MaskSalt = "salt"
+	s.config.Sync.TablePairs[0].Mask = map[string]config.MaskRule{
+		"phone": {Type: "partial", KeepPrefix: 3, KeepSuffix: 4},
+		"email": {Type: "redact"},
+	}
+
+	m, err := s.columnMapFor("user", []string{"id", "phone", "email"})
+	if err != nil {
+		t.Fatalf("解析列映射失败: %v", err)
+	}
+	records := m.apply([]map[string]interface{}{{"id": int64(1), "phone": []byte("13812345678"), "email": nil}})
+	want := map[string]interface{}{"id": int64(1), "mobile": "138****5678", "email": nil}
+	if !reflect.DeepEqual(records[0], want) {
+		t.Errorf("脱敏后的记录错误: %v", records[0])
+	}
+
+	// 脱敏的列不参与校验
+	source, target := m.checksumExprs()
+	if !reflect.DeepEqual(source, []string{"`id`"}) || !reflect.DeepEqual(target, []string{"`id`"}) {
+		t.Errorf("校验列错误: %v %v", source, target)
+	}
+
+	s.config.Sync.TablePairs[0].Mask["id"] = config.MaskRule{Type: "hash"}
+	if m, err = s.columnMapFor("user", []string{"id", "phone", "email"}); err != nil {
+		t.Fatalf("解析列映射失败: %v", err)
+	}
+	if _, err := m.targetKey("user", []string{"id"}); err == nil {
+		t.Errorf("主键字段脱敏时应返回错误")
+	}
+}
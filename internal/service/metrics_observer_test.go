@@ -0,0 +1,55 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsObserver(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	o := NewMetricsObserver(reg)
+	task := &SyncTask{SourceTable: "user", TargetTable: "user_backup"}
+
+	o.OnSyncStart(task)
+	o.OnDDLApplied(task, "ALTER TABLE `user_backup` ADD COLUMN `age` int NULL")
+	o.OnRowsUpserted(task, 100)
+	o.OnRowsUpserted(task, 20)
+	o.OnRowsDeleted(task, 3)
+	o.OnSyncComplete(task)
+
+	o.OnSyncStart(task)
+	o.OnSyncError(task, &SyncError{Phase: PhaseCleanup, Err: errors.New("连接断开")})
+
+	if got := testutil.ToFloat64(o.rowsUpserted.WithLabelValues("user", "user_backup", "", "")); got != 120 {
+		t.Errorf("写入行数为 %v，期望 120", got)
+	}
+	if got := testutil.ToFloat64(o.rowsDeleted.WithLabelValues("user", "user_backup", "", "")); got != 3 {
+		t.Errorf("删除行数为 %v，期望 3", got)
+	}
+	if got := testutil.ToFloat64(o.ddlApplied.WithLabelValues("user", "user_backup", "", "")); got != 1 {
+		t.Errorf("DDL 数为 %v，期望 1", got)
+	}
+	if got := testutil.ToFloat64(o.errors.WithLabelValues("user", "user_backup", "", "", PhaseCleanup)); got != 1 {
+		t.Errorf("cleanup 阶段错误数为 %v，期望 1", got)
+	}
+	if got := testutil.ToFloat64(o.lastSuccess.WithLabelValues("user", "user_backup", "", "")); got <= 0 {
+		t.Errorf("最后成功时间未设置")
+	}
+	if got := testutil.CollectAndCount(o.duration); got != 2 {
+		t.Errorf("耗时直方图应有成功、失败两个序列，实际 %d", got)
+	}
+}
+
+func TestErrorPhase(t *testing.T) {
+	err := fmt.Errorf("外层: %w", &SyncError{Phase: PhaseSchema, Err: errors.New("x")})
+	if ErrorPhase(err) != PhaseSchema {
+		t.Errorf("应能从包装后的错误中取出阶段")
+	}
+	if ErrorPhase(errors.New("x")) != "unknown" {
+		t.Errorf("未标记阶段的错误应返回 unknown")
+	}
+}
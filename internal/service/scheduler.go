@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/internal/config"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// runSchedules 为每张表启动独立的调度循环，慢表不会拖住其他表；配置了 discovery 时定期发现新表并为其启动调度循环。
+// 开启 foreign_key_order 时改为按外键顺序整体调度，见 runOrdered。ctx 取消后等所有循环退出再返回
+func (s *SyncService) runSchedules(ctx context.Context) error {
+	if s.config.Sync.ForeignKeyOrder {
+		return s.runOrdered(ctx)
+	}
+
+	schedules := make(map[*SyncTask]cron.Schedule, len(s.tasks))
+	for _, task := range s.tasks {
+		schedule, err := s.scheduleFor(s.getTableConfig(task.SourceTable))
+		if err != nil {
+			return fmt.Errorf("解析表 %s 的调度失败: %w", task.SourceTable, err)
+		}
+		schedules[task] = schedule
+	}
+
+	var wg sync.WaitGroup
+	for task, schedule := range schedules {
+		wg.Add(1)
+		go func(task *SyncTask, schedule cron.Schedule) {
+			defer wg.Done()
+			s.scheduleLoop(ctx, task, schedule)
+		}(task, schedule)
+	}
+
+	if len(s.config.Sync.Discovery.Tables) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.discoveryLoop(ctx, func(task *SyncTask) error {
+				schedule, err := s.scheduleFor(s.getTableConfig(task.SourceTable))
+				if err != nil {
+					return err
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					s.scheduleLoop(ctx, task, schedule)
+				}()
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// scheduleFor 表配置了 cron 时按 cron 调度，否则按表自己的 interval 或全局 sync.interval 固定间隔调度
+func (s *SyncService) scheduleFor(pair *config.TablePair) (cron.Schedule, error) {
+	if pair.Cron != "" {
+		return config.ParseCron(pair.Cron)
+	}
+	interval := pair.Interval
+	if interval <= 0 {
+		interval = s.config.Sync.Interval
+	}
+	return cron.Every(time.Duration(interval) * time.Second), nil
+}
+
+// scheduleLoop 单表的调度循环。同步在循环内执行，上一轮没结束时到点的调度直接跳过，不会堆积
+func (s *SyncService) scheduleLoop(ctx context.Context, task *SyncTask, schedule cron.Schedule) {
+	for {
+		timer := time.NewTimer(time.Until(s.nextRun(task.SourceTable, schedule)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if !task.tryStart() {
+			task.mutex.RLock()
+			running := task.running
+			task.mutex.RUnlock()
+			if running {
+				log.Printf("表 %s 上一轮同步尚未结束，跳过本次调度", task.SourceTable)
+			}
+			continue
+		}
+		s.runTask(task)
+	}
+}
+
+// nextRun 表 table 下一次同步的时间；多个目标库时各目标库共用，同时开始的一轮才能共用源表读取
+func (s *SyncService) nextRun(table string, schedule cron.Schedule) time.Time {
+	if s.fanout != nil {
+		return s.fanout.nextRun(table, schedule)
+	}
+	return schedule.Next(time.Now())
+}
+
+// acquireSlot 占用一个并发名额，收到退出信号时放弃等待并返回 false
+func (s *SyncService) acquireSlot() bool {
+	if s.slots == nil {
+		return true
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	case <-s.stopCh:
+		return false
+	}
+}
+
+func (s *SyncService) releaseSlot() {
+	if s.slots != nil {
+		<-s.slots
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"sync/internal/config"
+	"testing"
+	"time"
+)
+
+// everySchedule 测试用的毫秒级固定间隔调度
+type everySchedule time.Duration
+
+func (e everySchedule) Next(t time.Time) time.Time { return t.Add(time.Duration(e)) }
+
+// countingObserver 统计开始同步的次数
+type countingObserver struct {
+	LogObserver
+	starts atomic.Int32
+}
+
+func (o *countingObserver) OnSyncStart(task *SyncTask) { o.starts.Add(1) }
+
+func (o *countingObserver) OnSyncError(task *SyncTask, err error) {}
+
+func TestScheduleFor(t *testing.T) {
+	s := &SyncService{config: &config.Config{}}
+	s.config.Sync.Interval = 60
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		pair config.TablePair
+		want time.Time
+	}{
+		{config.TablePair{}, now.Add(time.Minute)},
+		{config.TablePair{Interval: 5}, now.Add(5 * time.Second)},
+		{config.TablePair{Cron: "30 2 * * *"}, time.Date(2024, 1, 1, 2, 30, 0, 0, time.UTC)},
+		{config.TablePair{Cron: "@every 10m"}, now.Add(10 * time.Minute)},
+	}
+	for _, c := range cases {
+		schedule, err := s.scheduleFor(&c.pair)
+		if err != nil {
+			t.Fatalf("解析调度 %+v 失败: %v", c.pair, err)
+		}
+		if got := schedule.Next(now); !got.Equal(c.want) {
+			t.Errorf("调度 %+v 的下次执行时间为 %v，期望 %v", c.pair, got, c.want)
+		}
+	}
+}
+
+func TestScheduleLoop(t *testing.T) {
+	sourceDB, _ := newMockDB(t)
+	observer := &countingObserver{}
+	s := &SyncService{
+		sourceDB:  sourceDB,
+		config:    &config.Config{},
+		observers: []SyncObserver{observer},
+		slots:     make(chan struct{}, 1),
+	}
+	// 模拟库没有设置期望，每轮同步在读取表结构时立即失败返回
+	task := &SyncTask{SourceTable: "user", TargetTable: "user"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	s.scheduleLoop(ctx, task, everySchedule(20*time.Millisecond))
+	if got := observer.starts.Load(); got < 3 {
+		t.Errorf("200ms 内每 20ms 调度一次，只执行了 %d 次", got)
+	}
+
+	// 上一轮仍在执行时跳过调度
+	running := &SyncTask{SourceTable: "user", TargetTable: "user", running: true}
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	before := observer.starts.Load()
+	s.scheduleLoop(ctx, running, everySchedule(10*time.Millisecond))
+	if observer.starts.Load() != before {
+		t.Errorf("正在执行的表不应被再次调度")
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	s := &SyncService{slots: make(chan struct{}, 2), stopCh: make(chan struct{})}
+
+	var current, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !s.acquireSlot() {
+				return
+			}
+			defer s.releaseSlot()
+			n := current.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			current.Add(-1)
+		}()
+	}
+	wg.Wait()
+	if peak.Load() > 2 {
+		t.Errorf("同时执行数为 %d，超过上限 2", peak.Load())
+	}
+
+	// 退出时排队中的任务放弃等待
+	s.slots <- struct{}{}
+	s.slots <- struct{}{}
+	s.beginStop()
+	if s.acquireSlot() {
+		t.Errorf("退出后不应再获得名额")
+	}
+}
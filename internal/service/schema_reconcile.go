@@ -0,0 +1,49 @@
+package service
+
+import (
+	tableschema "github.com/mysql-structure-sync/schema"
+	"gorm.io/gorm"
+)
+
+// 表对的 schema_policy：目标表结构与源表不一致时如何处理
+const (
+	schemaPolicyAll      = "all"      // 执行全部变更，包括修改、删除字段和索引、重建主键
+	schemaPolicyAdditive = "additive" // 只添加缺失的字段、索引和主键，其他差异只告警（默认）
+	schemaPolicyAlert    = "alert"    // 不执行任何 DDL，只告警
+)
+
+// loadTable 读取 db 中表 tableName 的字段、索引和主键
+func loadTable(db *gorm.DB, tableName string) (*tableschema.Table, error) {
+	return tableschema.Load(db.Statement.Context, db.Statement.ConnPool, tableName)
+}
+
+// compareSchema 用 mysql-structure-sync/schema 的对比规则对比源表和目标表，按列映射换成目标表的列名，
+// 返回修复目标表的变更：先添加、修改字段，再修复主键和索引，最后删除多余的字段。
+// 排除的字段和引用它们的索引不同步；脱敏字段的类型可能有意与源表不同，只添加不修改；
+// set 字段和多个源库汇总时的 discriminator 字段只在目标表中，不会被删除，
+// discriminator 由 ensureDiscriminator 加在主键最后，对比主键时去掉，重建时保留
+func (s *SyncService) compareSchema(task *SyncTask, mapping *columnMap, source, target *tableschema.Table) []tableschema.Difference {
+	mapped := make(map[string]bool, len(mapping.source))
+	for _, name := range mapping.source {
+		mapped[name] = true
+	}
+	opts := tableschema.Options{
+		Table: task.TargetTable,
+		ColumnName: func(col string) (string, bool) {
+			if !mapped[col] {
+				return "", false
+			}
+			return mapping.targetName(col), true
+		},
+		AddOnly: make(map[string]bool, len(mapping.masks)),
+		Keep:    mapping.set,
+	}
+	for col := range mapping.masks {
+		opts.AddOnly[col] = true
+	}
+	if s.source != "" && s.config.Sync.Discriminator != "" {
+		opts.Keep = append(append([]string(nil), mapping.set...), s.config.Sync.Discriminator)
+		opts.PrimaryKeySuffix = []string{s.config.Sync.Discriminator}
+	}
+	return tableschema.Compare(source, target, opts)
+}
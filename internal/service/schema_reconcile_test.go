@@ -0,0 +1,100 @@
+package service
+
+import (
+	"reflect"
+	"regexp"
+	"sync/internal/config"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// ddlObserver 记录执行的 DDL
+type ddlObserver struct {
+	LogObserver
+	statements []string
+}
+
+func (o *ddlObserver) OnDDLApplied(task *SyncTask, statement string) {
+	o.statements = append(o.statements, statement)
+}
+
+// indexRows 模拟表结构对比读取的 INFORMATION_SCHEMA.STATISTICS 中一个唯一索引的各列
+func indexRows(index string, columns ...string) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"INDEX_NAME", "COLUMN_NAME", "SUB_PART", "NON_UNIQUE", "INDEX_TYPE"})
+	for _, col := range columns {
+		rows.AddRow(index, col, nil, 0, "BTREE")
+	}
+	return rows
+}
+
+func TestSyncTableSchemaPolicy(t *testing.T) {
+	addColumn := "ALTER TABLE `user_backup` ADD COLUMN `created_at` datetime NULL DEFAULT CURRENT_TIMESTAMP"
+	modifyColumn := "ALTER TABLE `user_backup` MODIFY COLUMN `name` varchar(128) NOT NULL DEFAULT 'it\\'s' COMMENT '姓名'"
+	addIndex := "ALTER TABLE `user_backup` ADD UNIQUE INDEX `uk_name` (`name`(10)) USING BTREE"
+	modifyIndex := "ALTER TABLE `user_backup` DROP INDEX `idx_created`, ADD INDEX `idx_created` (`created_at`, `id`) USING BTREE"
+	dropIndex := "ALTER TABLE `user_backup` DROP INDEX `idx_old`"
+	dropColumn := "ALTER TABLE `user_backup` DROP COLUMN `old`"
+
+	cases := []struct {
+		policy string
+		want   []string
+	}{
+		{"", []string{addColumn, addIndex}},
+		{"additive", []string{addColumn, addIndex}},
+		{"all", []string{modifyColumn, addColumn, modifyIndex, addIndex, dropIndex, dropColumn}},
+		{"alert", nil},
+	}
+	for _, c := range cases {
+		sourceDB, sourceMock := newMockDB(t)
+		targetDB, targetMock := newMockDB(t)
+		cfg := &config.Config{}
+		cfg.Sync.TablePairs = []config.TablePair{{Source: "user", Target: "user_backup", SchemaPolicy: c.policy}}
+		observer := &ddlObserver{}
+		s := &SyncService{sourceDB: sourceDB, targetDB: targetDB, config: cfg, observers: []SyncObserver{observer}}
+		task := &SyncTask{SourceTable: "user", TargetTable: "user_backup"}
+
+		// 源表 name 加长且不可空，新增 created_at；int(11) 与 int 只是显示宽度不同
+		detailColumns := []string{"COLUMN_NAME", "COLUMN_TYPE", "IS_NULLABLE", "COLUMN_DEFAULT", "EXTRA", "COLUMN_COMMENT"}
+		sourceMock.ExpectQuery("INFORMATION_SCHEMA.COLUMNS").WithArgs("user").
+			WillReturnRows(sqlmock.NewRows(detailColumns).
+				AddRow("id", "int(11)", "NO", nil, "auto_increment", "").
+				AddRow("name", "varchar(128)", "NO", "it's", "", "姓名").
+				AddRow("created_at", "datetime", "YES", "CURRENT_TIMESTAMP", "DEFAULT_GENERATED", ""))
+		targetMock.ExpectQuery("INFORMATION_SCHEMA.COLUMNS").WithArgs("user_backup").
+			WillReturnRows(sqlmock.NewRows(detailColumns).
+				AddRow("id", "int", "NO", nil, "auto_increment", "").
+				AddRow("name", "varchar(64)", "YES", nil, "", "").
+				AddRow("old", "int", "YES", nil, "", ""))
+
+		indexColumns := []string{"INDEX_NAME", "COLUMN_NAME", "SUB_PART", "NON_UNIQUE", "INDEX_TYPE"}
+		sourceMock.ExpectQuery("INFORMATION_SCHEMA.STATISTICS").WithArgs("user").
+			WillReturnRows(sqlmock.NewRows(indexColumns).
+				AddRow("PRIMARY", "id", nil, 0, "BTREE").
+				AddRow("idx_created", "created_at", nil, 1, "BTREE").
+				AddRow("idx_created", "id", nil, 1, "BTREE").
+				AddRow("uk_name", "name", 10, 0, "BTREE"))
+		targetMock.ExpectQuery("INFORMATION_SCHEMA.STATISTICS").WithArgs("user_backup").
+			WillReturnRows(sqlmock.NewRows(indexColumns).
+				AddRow("PRIMARY", "id", nil, 0, "BTREE").
+				AddRow("idx_created", "id", nil, 1, "BTREE").
+				AddRow("idx_old", "old", nil, 1, "BTREE"))
+
+		for _, stmt := range c.want {
+			targetMock.ExpectExec(regexp.QuoteMeta(stmt)).WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+
+		if err := s.syncTableSchema(task); err != nil {
+			t.Fatalf("schema_policy %q: 同步表结构失败: %v", c.policy, err)
+		}
+		if !reflect.DeepEqual(observer.statements, c.want) {
+			t.Errorf("schema_policy %q: 通知观察者的 DDL 不符合预期:\n%v", c.policy, observer.statements)
+		}
+		if err := sourceMock.ExpectationsWereMet(); err != nil {
+			t.Errorf("schema_policy %q: 源库期望未满足: %v", c.policy, err)
+		}
+		if err := targetMock.ExpectationsWereMet(); err != nil {
+			t.Errorf("schema_policy %q: 目标库期望未满足: %v", c.policy, err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+// snapshotIDs 为每个快照编号，读取流按编号区分不同快照中的读取
+var snapshotIDs atomic.Uint64
+
+// snapshotConn 一致性快照使用的专用源库连接。一个连接同一时间只能执行一个查询，
+// 多个目标库共用快照时在连接上查询前用 lockSnapshot 加锁
+type snapshotConn struct {
+	*sql.Conn
+	id    uint64
+	mutex sync.Mutex
+}
+
+// lockSnapshot 在 db 的快照连接上查询前加锁，返回解锁函数；db 不是快照时不加锁。
+// 锁只在查询期间持有，查询结果读完后立即解锁
+func lockSnapshot(db *gorm.DB) func() {
+	conn, ok := db.Statement.ConnPool.(*snapshotConn)
+	if !ok {
+		return func() {}
+	}
+	conn.mutex.Lock()
+	return conn.mutex.Unlock
+}
+
+// beginSnapshot 开启读取源表 table 的一致性快照，返回在快照连接上查询的会话。
+// 多个目标库共用源库时，同时在同步这张表的目标库共用一个快照，见 snapshotShare；
+// release 在本服务用完后调用，最后一个使用者调用时结束快照
+func (s *SyncService) beginSnapshot(table string) (*gorm.DB, func(), error) {
+	if s.snapshots == nil {
+		return s.openSnapshot()
+	}
+	return s.snapshots.acquire(s.target, table, s.openSnapshot)
+}
+
+// openSnapshot 从连接池取出一个专用的源库连接，开启只读的一致性快照事务，返回在该连接上查询的会话。
+// 之后在会话上的所有读取看到的都是开启时的数据；release 结束事务并把连接还回连接池，必须调用。
+// 快照期间源库需要保留旧版本的数据，大表的一轮同步时间越长，源库的 undo 日志越多
+func (s *SyncService) openSnapshot() (*gorm.DB, func(), error) {
+	sqlDB, err := s.sourceDB.DB()
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取源库连接池失败: %w", err)
+	}
+	ctx := s.sourceDB.Statement.Context
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取源库连接失败: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, "START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY"); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("开启源库一致性快照失败: %w", err)
+	}
+
+	// 会话的 Statement 是复制出来的，修改 ConnPool 不影响 s.sourceDB；之后的每次查询都继承这个连接
+	snapshot := s.sourceDB.Session(&gorm.Session{Context: ctx})
+	snapshot.Statement.ConnPool = &snapshotConn{Conn: conn, id: snapshotIDs.Add(1)}
+	release := func() {
+		// 只读事务，提交只是结束快照
+		if _, err := conn.ExecContext(ctx, "COMMIT"); err != nil {
+			log.Printf("结束源库一致性快照失败: %v", err)
+		}
+		conn.Close()
+	}
+	return snapshot, release, nil
+}
+
+// snapshotShare 多个目标库共用一个源库时，同一张源表的 full 模式同步共用的一致性快照。
+// 第一个开始同步该表的目标库开启快照，其他目标库在快照结束前开始同步时加入，读到同一时间点的数据；
+// 起点相同的读取经 fanout 的读取流每页只查询一次。所有加入的目标库都结束后快照才结束。
+// 每个目标库一轮只加入一次，它的下一轮遇到仍未结束的快照时开启新的快照
+type snapshotShare struct {
+	mutex     sync.Mutex
+	snapshots map[string]*sharedSnapshot // key: 源表名，最近开启且未结束的快照
+}
+
+type sharedSnapshot struct {
+	db      *gorm.DB
+	release func()
+	users   int             // 正在使用快照的目标库数
+	joined  map[string]bool // 加入过的目标库
+}
+
+func newSnapshotShare() *snapshotShare {
+	return &snapshotShare{snapshots: make(map[string]*sharedSnapshot)}
+}
+
+// acquire 为目标库 target 取得读取 table 的快照：有可以加入的快照时加入，否则用 open 开启新的快照
+func (c *snapshotShare) acquire(target, table string, open func() (*gorm.DB, func(), error)) (*gorm.DB, func(), error) {
+	if shared := c.join(target, table, nil); shared != nil {
+		return shared.db, c.leave(table, shared), nil
+	}
+
+	// 开启快照要等连接池的连接，不能持有锁，否则其他目标库无法结束快照、归还连接
+	db, release, err := open()
+	if err != nil {
+		return nil, nil, err
+	}
+	opened := &sharedSnapshot{db: db, release: release, joined: make(map[string]bool)}
+	shared := c.join(target, table, opened)
+	if shared != opened {
+		// 开启期间其他目标库开启了同一张表的快照，加入它，结束自己的
+		release()
+	}
+	return shared.db, c.leave(table, shared), nil
+}
+
+// join 加入 table 上 target 还没加入过的快照；没有时登记 opened 并加入，opened 为空时返回空
+func (c *snapshotShare) join(target, table string, opened *sharedSnapshot) *sharedSnapshot {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	shared := c.snapshots[table]
+	if shared == nil || shared.joined[target] {
+		if opened == nil {
+			return nil
+		}
+		shared = opened
+		c.snapshots[table] = shared
+	}
+	shared.users++
+	shared.joined[target] = true
+	return shared
+}
+
+// leave 返回目标库用完快照后调用的函数，最后一个使用者调用时结束快照
+func (c *snapshotShare) leave(table string, shared *sharedSnapshot) func() {
+	return func() {
+		c.mutex.Lock()
+		shared.users--
+		last := shared.users == 0
+		if last && c.snapshots[table] == shared {
+			delete(c.snapshots, table)
+		}
+		c.mutex.Unlock()
+		if last {
+			shared.release()
+		}
+	}
+}
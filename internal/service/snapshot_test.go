@@ -0,0 +1,107 @@
+package service
+
+import (
+	"reflect"
+	"sync/internal/config"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestBeginSnapshot(t *testing.T) {
+	sourceDB, sourceMock := newMockDB(t)
+	targetDB, targetMock := newMockDB(t)
+	cfg := &config.Config{}
+	s := &SyncService{sourceDB: sourceDB, targetDB: targetDB, config: cfg}
+
+	// 计数和分页读取都在快照事务内，结束时提交
+	sourceMock.ExpectExec("START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY").WillReturnResult(sqlmock.NewResult(0, 0))
+	sourceMock.ExpectQuery("SELECT count\\(\\*\\) FROM `user`").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	targetMock.ExpectQuery("SELECT count\\(\\*\\) FROM `user_backup`").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	sourceMock.ExpectQuery("SELECT \\* FROM `user` ORDER BY `id` LIMIT").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(1)).AddRow(int64(2)))
+	sourceMock.ExpectExec("COMMIT").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	snapshot, release, err := s.beginSnapshot("user")
+	if err != nil {
+		t.Fatalf("开启快照失败: %v", err)
+	}
+	if needSync, err := s.checkByCount(snapshot, "user", "user_backup"); err != nil || !needSync {
+		t.Fatalf("记录数不一致时应同步: %v %v", needSync, err)
+	}
+
+	cursor := newKeysetCursor("user", []string{"id"}, 100)
+	if records, err := cursor.next(snapshot, ""); err != nil || len(records) != 2 {
+		t.Fatalf("在快照中读取失败: %v %v", records, err)
+	}
+	release()
+
+	if err := sourceMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("源库期望未满足: %v", err)
+	}
+	if err := targetMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("目标库期望未满足: %v", err)
+	}
+}
+
+func TestSharedSnapshot(t *testing.T) {
+	sourceDB, mock := newMockDB(t)
+	cfg := &config.Config{}
+	fan := newFanout()
+	snapshots := newSnapshotShare()
+	newTarget := func(name string) *SyncService {
+		return &SyncService{target: name, sourceDB: sourceDB, config: cfg, fanout: fan, snapshots: snapshots}
+	}
+	backup, report := newTarget("backup"), newTarget("report")
+
+	// 两个目标库在同一个快照中读取，第一页只查询一次
+	mock.ExpectExec("START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT \\* FROM `user` ORDER BY `id` LIMIT").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(1)).AddRow(int64(2)))
+	// backup 的下一轮不再加入 report 还在使用的快照，开启新的快照
+	mock.ExpectExec("START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("COMMIT").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("COMMIT").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	first, releaseBackup, err := backup.beginSnapshot("user")
+	if err != nil {
+		t.Fatalf("开启快照失败: %v", err)
+	}
+	shared, releaseReport, err := report.beginSnapshot("user")
+	if err != nil {
+		t.Fatalf("加入快照失败: %v", err)
+	}
+	if shared != first {
+		t.Fatalf("同时同步同一张表的目标库应共用快照")
+	}
+
+	round := fan.enter("user")
+	fan.enter("user")
+	var records [2][]map[string]interface{}
+	for i, target := range []*SyncService{backup, report} {
+		cursor := newKeysetCursor("user", []string{"id"}, 100)
+		cursor.round = round
+		if records[i], err = cursor.next(shared, ""); err != nil {
+			t.Fatalf("目标库 %s 在快照中读取失败: %v", target.target, err)
+		}
+	}
+	if len(records[0]) != 2 || !reflect.DeepEqual(records[0], records[1]) {
+		t.Errorf("两个目标库读到的页不同: %v, %v", records[0], records[1])
+	}
+
+	releaseBackup()
+	next, releaseNext, err := backup.beginSnapshot("user")
+	if err != nil {
+		t.Fatalf("开启快照失败: %v", err)
+	}
+	if next == shared {
+		t.Errorf("下一轮不应加入上一轮的快照")
+	}
+	releaseNext()
+	// 最后一个使用者结束后快照才结束
+	releaseReport()
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("源库期望未满足: %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"sync/internal/config"
+)
+
+// SyncGroup 把一个源库同步到多个目标库，或把多个源库汇总到一个目标库：每个目标库（源库）一个 SyncService，
+// 状态、检查点、错误和并发名额互不影响，一个慢或出错的库不会拖住其他库。
+// 多个目标库时同一张表的各目标库按同一时间调度，同一轮中起点相同的目标库共用一个读取流（fanout），
+// 每页只读一次源库，依次写入各目标库；full 模式下同时同步同一张表的目标库共用一个一致性快照（snapshotShare），
+// 快照中的读取同样共用
+type SyncGroup struct {
+	config   *config.Config
+	services []*SyncService
+}
+
+// NewSyncGroup 按 database.targets 为每个目标库创建同步服务，共用一个源库连接池；
+// 按 database.sources 为每个源库创建同步服务，共用一个目标库连接池；两者都没有配置时只有一个服务
+func NewSyncGroup(cfg *config.Config) (*SyncGroup, error) {
+	if len(cfg.Database.Sources) > 0 {
+		return newSourceGroup(cfg)
+	}
+	if len(cfg.Database.Targets) == 0 {
+		service, err := NewSyncService(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &SyncGroup{config: cfg, services: []*SyncService{service}}, nil
+	}
+
+	sourceDB, err := initDB(cfg.Database.Source.GetDSN())
+	if err != nil {
+		return nil, fmt.Errorf("初始化源数据库失败: %w", err)
+	}
+
+	fan := newFanout()
+	snapshots := newSnapshotShare()
+	throttle := newSourceThrottle(cfg.Sync.Throttle)
+	group := &SyncGroup{config: cfg}
+	for _, target := range cfg.Database.Targets {
+		targetCfg, err := cfg.ForTarget(target.Name)
+		if err != nil {
+			return nil, err
+		}
+		targetDB, err := initDB(targetCfg.Database.Target.GetDSN())
+		if err != nil {
+			return nil, fmt.Errorf("初始化目标数据库 %s 失败: %w", target.Name, err)
+		}
+
+		service := newSyncService(targetCfg, target.Name, sourceDB, targetDB)
+		service.fanout = fan
+		service.snapshots = snapshots
+		service.throttle = throttle
+		group.services = append(group.services, service)
+		log.Printf("目标库 %s 同步 %d 张表", target.Name, len(targetCfg.Sync.TablePairs))
+	}
+	return group, nil
+}
+
+// newSourceGroup 多个源库汇总到一个目标库，各源库的行由目标表的 discriminator 字段区分
+func newSourceGroup(cfg *config.Config) (*SyncGroup, error) {
+	targetDB, err := initDB(cfg.Database.Target.GetDSN())
+	if err != nil {
+		return nil, fmt.Errorf("初始化目标数据库失败: %w", err)
+	}
+
+	group := &SyncGroup{config: cfg}
+	for _, source := range cfg.Database.Sources {
+		sourceCfg, err := cfg.ForSource(source.Name)
+		if err != nil {
+			return nil, err
+		}
+		sourceDB, err := initDB(sourceCfg.Database.Source.GetDSN())
+		if err != nil {
+			return nil, fmt.Errorf("初始化源数据库 %s 失败: %w", source.Name, err)
+		}
+		group.services = append(group.services, newSyncService(sourceCfg, "", sourceDB, targetDB))
+	}
+	return group, nil
+}
+
+// RegisterObserver 为所有服务注册观察者，SyncTask.Source、SyncTask.Target 区分源库和目标库
+func (g *SyncGroup) RegisterObserver(observer SyncObserver) {
+	for _, service := range g.services {
+		service.RegisterObserver(observer)
+	}
+}
+
+// StartSync 启动所有服务的同步。某个库出错退出时其他库继续同步，全部退出后返回各自的错误
+func (g *SyncGroup) StartSync(ctx context.Context) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(g.services))
+	for i, service := range g.services {
+		wg.Add(1)
+		go func(i int, service *SyncService) {
+			defer wg.Done()
+			if err := service.StartSync(ctx); err != nil {
+				switch {
+				case service.source != "":
+					err = fmt.Errorf("源库 %s: %w", service.source, err)
+				case service.target != "":
+					err = fmt.Errorf("目标库 %s: %w", service.target, err)
+				}
+				if len(g.services) > 1 {
+					log.Printf("同步服务退出: %v", err)
+				}
+				errs[i] = err
+			}
+		}(i, service)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// DryRun 依次对每个服务执行 dry-run，见 SyncService.DryRun
+func (g *SyncGroup) DryRun(sql io.Writer) ([]DryRunReport, error) {
+	var reports []DryRunReport
+	for _, service := range g.services {
+		serviceReports, err := service.DryRun(sql)
+		reports = append(reports, serviceReports...)
+		if err != nil {
+			return reports, err
+		}
+	}
+	return reports, nil
+}
+
+// Stop 取消所有服务进行中的数据库操作
+func (g *SyncGroup) Stop() {
+	for _, service := range g.services {
+		service.Stop()
+	}
+}
+
+// Tasks 返回所有服务的同步任务状态，按源库、目标库、源表名排序
+func (g *SyncGroup) Tasks() []TaskStatus {
+	var statuses []TaskStatus
+	for _, service := range g.services {
+		statuses = append(statuses, service.Tasks()...)
+	}
+	sort.SliceStable(statuses, func(i, j int) bool {
+		if statuses[i].Source != statuses[j].Source {
+			return statuses[i].Source < statuses[j].Source
+		}
+		if statuses[i].Target != statuses[j].Target {
+			return statuses[i].Target < statuses[j].Target
+		}
+		return statuses[i].SourceTable < statuses[j].SourceTable
+	})
+	return statuses
+}
+
+// TriggerSync 在所有同步该表的服务上立即同步一张表
+func (g *SyncGroup) TriggerSync(sourceTable string) error {
+	return g.each(sourceTable, func(s *SyncService) error { return s.TriggerSync(sourceTable) })
+}
+
+// PauseTask 在所有同步该表的服务上暂停一张表
+func (g *SyncGroup) PauseTask(sourceTable string) error {
+	return g.each(sourceTable, func(s *SyncService) error { return s.PauseTask(sourceTable) })
+}
+
+// ResumeTask 在所有同步该表的服务上恢复一张表
+func (g *SyncGroup) ResumeTask(sourceTable string) error {
+	return g.each(sourceTable, func(s *SyncService) error { return s.ResumeTask(sourceTable) })
+}
+
+// Config 返回生效的配置，密码和脱敏密钥已隐去
+func (g *SyncGroup) Config() config.Config {
+	return redactConfig(*g.config)
+}
+
+// each 对同步该表的每个服务执行 fn，没有服务同步该表时返回 ErrTaskNotFound
+func (g *SyncGroup) each(sourceTable string, fn func(s *SyncService) error) error {
+	found := false
+	var errs []error
+	for _, service := range g.services {
+		if _, err := service.task(sourceTable); err != nil {
+			continue
+		}
+		found = true
+		if err := fn(service); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if !found {
+		return ErrTaskNotFound
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,268 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"sync/internal/config"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/robfig/cron/v3"
+)
+
+func TestFanoutSharesPages(t *testing.T) {
+	db, mock := newMockDB(t)
+	fan := newFanout()
+
+	// 两个目标库从同一起点读取，第一页只查询一次
+	mock.ExpectQuery("SELECT \\* FROM `user` ORDER BY `id` LIMIT \\?").WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	// 第二页查询出错，出错的页不保留，另一个目标库自己重新查询
+	mock.ExpectQuery("SELECT \\* FROM `user` WHERE \\(\\(`id` > \\?\\)\\) ORDER BY `id` LIMIT \\?").WithArgs(int64(2), 2).
+		WillReturnError(errors.New("连接断开"))
+	mock.ExpectQuery("SELECT \\* FROM `user` WHERE \\(\\(`id` > \\?\\)\\) ORDER BY `id` LIMIT \\?").WithArgs(int64(2), 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	// 只有一个目标库在同步的表直接查询
+	mock.ExpectQuery("SELECT \\* FROM `node_node` ORDER BY `id` LIMIT \\?").WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	round := fan.enter("user")
+	if fan.enter("user") != round {
+		t.Fatalf("同时同步同一张表的目标库应在同一轮")
+	}
+	backup := newKeysetCursor("user", []string{"id"}, 2)
+	report := newKeysetCursor("user", []string{"id"}, 2)
+	backup.round, report.round = round, round
+
+	first, err := backup.next(db, "")
+	if err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	shared, err := report.next(db, "")
+	if err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if !reflect.DeepEqual(first, shared) || len(first) != 2 || backup.shared || !report.shared {
+		t.Errorf("两个目标库读到的第一页不同: %v, %v", first, shared)
+	}
+	if len(backup.stream.pages) != 0 {
+		t.Errorf("所有目标库取过的页应释放，剩余 %d 页", len(backup.stream.pages))
+	}
+
+	if _, err := backup.next(db, ""); err == nil {
+		t.Fatalf("期望第二页读取出错")
+	}
+	if records, err := report.next(db, ""); err != nil || len(records) != 1 {
+		t.Errorf("另一个目标库应重新读取第二页: %v, %v", records, err)
+	}
+	fan.leave("user", round)
+	fan.leave("user", round)
+	if len(fan.rounds) != 0 {
+		t.Errorf("所有目标库离开后应释放本轮")
+	}
+
+	single := newKeysetCursor("node_node", []string{"id"}, 2)
+	single.round = fan.enter("node_node")
+	if _, err := single.next(db, ""); err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("未满足的数据库期望: %v", err)
+	}
+}
+
+func TestFanoutReadsOnOwn(t *testing.T) {
+	db, mock := newMockDB(t)
+	fan := newFanout()
+	fan.maxPages = 1
+	round := fan.enter("user")
+	fan.enter("user")
+	fan.enter("user")
+
+	// backup 和 report 共用读取流，report 停在第一页后 backup 继续读了两页
+	mock.ExpectQuery("SELECT \\* FROM `user` ORDER BY `id` LIMIT \\?").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("SELECT \\* FROM `user` WHERE \\(\\(`id` > \\?\\)\\) ORDER BY `id` LIMIT \\?").WithArgs(int64(1), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectQuery("SELECT \\* FROM `user` WHERE \\(\\(`id` > \\?\\)\\) ORDER BY `id` LIMIT \\?").WithArgs(int64(2), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	// report 需要的第二页已经释放，从自己的进度接着读
+	mock.ExpectQuery("SELECT \\* FROM `user` WHERE \\(\\(`id` > \\?\\)\\) ORDER BY `id` LIMIT \\?").WithArgs(int64(1), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	// archive 从自己的检查点继续，起点不同，自己读取
+	mock.ExpectQuery("SELECT \\* FROM `user` WHERE \\(\\(`id` > \\?\\)\\) ORDER BY `id` LIMIT \\?").WithArgs(int64(10), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+
+	backup := newKeysetCursor("user", []string{"id"}, 1)
+	report := newKeysetCursor("user", []string{"id"}, 1)
+	archive := newKeysetCursor("user", []string{"id"}, 1)
+	archive.last = []interface{}{int64(10)}
+	backup.round, report.round, archive.round = round, round, round
+
+	if _, err := backup.next(db, ""); err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if _, err := report.next(db, ""); err != nil || !report.shared {
+		t.Fatalf("report 应取到共用的第一页: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := backup.next(db, ""); err != nil {
+			t.Fatalf("读取失败: %v", err)
+		}
+	}
+	if records, err := report.next(db, ""); err != nil || len(records) != 1 || report.shared || !report.solo {
+		t.Errorf("落后的目标库应脱离读取流自己读取: %v, %v", records, err)
+	}
+	if _, err := archive.next(db, ""); err != nil || archive.stream == backup.stream {
+		t.Errorf("起点不同的目标库不应加入读取流: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("未满足的数据库期望: %v", err)
+	}
+}
+
+func TestFanoutNextRun(t *testing.T) {
+	fan := newFanout()
+	schedule, err := cron.ParseStandard("* * * * *")
+	if err != nil {
+		t.Fatalf("解析调度失败: %v", err)
+	}
+	first := fan.nextRun("user", schedule)
+	if second := fan.nextRun("user", schedule); !second.Equal(first) {
+		t.Errorf("各目标库应共用同一张表的调度时间: %v, %v", first, second)
+	}
+	if !first.After(time.Now()) {
+		t.Errorf("调度时间应在将来: %v", first)
+	}
+}
+
+func TestSyncGroupTaskControl(t *testing.T) {
+	newTarget := func(name string, tables ...string) *SyncService {
+		s := newControlTestService("incremental")
+		s.target = name
+		s.tasks = make(map[string]*SyncTask)
+		for _, table := range tables {
+			s.tasks[table] = &SyncTask{Target: name, SourceTable: table, TargetTable: table, Status: "ready"}
+		}
+		return s
+	}
+	cfg := &config.Config{}
+	cfg.Database.Targets = []config.TargetConfig{{Name: "backup", DBConnection: config.DBConnection{Password: "secret"}}}
+	group := &SyncGroup{config: cfg, services: []*SyncService{newTarget("report", "user"), newTarget("backup", "user", "node_node")}}
+
+	tasks := group.Tasks()
+	var order []string
+	for _, task := range tasks {
+		order = append(order, task.Target+"."+task.SourceTable)
+	}
+	if want := []string{"backup.node_node", "backup.user", "report.user"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("任务顺序错误: %v", order)
+	}
+
+	// 暂停作用于所有同步该表的目标库
+	if err := group.PauseTask("user"); err != nil {
+		t.Fatalf("暂停失败: %v", err)
+	}
+	for _, s := range group.services {
+		if !s.tasks["user"].Paused {
+			t.Errorf("目标库 %s 的表 user 未暂停", s.target)
+		}
+	}
+	if !errors.Is(group.TriggerSync("user"), ErrTaskPaused) {
+		t.Errorf("暂停的表不应被手动触发")
+	}
+	if !errors.Is(group.PauseTask("missing"), ErrTaskNotFound) {
+		t.Errorf("没有目标库同步的表应返回 ErrTaskNotFound")
+	}
+
+	if got := group.Config().Database.Targets[0].Password; got != redactedPassword {
+		t.Errorf("目标库密码未脱敏: %s", got)
+	}
+	if cfg.Database.Targets[0].Password != "secret" {
+		t.Errorf("脱敏不应修改生效的配置")
+	}
+}
+
+func TestSourceDiscriminator(t *testing.T) {
+	targetDB, mock := newMockDB(t)
+	cfg := &config.Config{}
+	cfg.Sync.Discriminator = "site"
+	cfg.Sync.TablePairs = []config.TablePair{{Source: "user", Target: "user_all"}}
+	s := &SyncService{source: "gz", config: cfg, targetDB: targetDB}
+	task := &SyncTask{Source: "gz", SourceTable: "user", TargetTable: "user_all", BatchSize: 100}
+
+	m, err := s.columnMapFor("user", []string{"id", "name"})
+	if err != nil {
+		t.Fatalf("解析列映射失败: %v", err)
+	}
+	if want := "`id`, `name`, ('gz') AS `site`"; m.selects() != want {
+		t.Errorf("查询列错误: %s", m.selects())
+	}
+
+	// 目标表没有来源字段时先添加，再加入主键
+	mock.ExpectExec("ALTER TABLE `user_all` ADD COLUMN `site` VARCHAR\\(64\\) NOT NULL DEFAULT ''").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("INFORMATION_SCHEMA.STATISTICS").WithArgs("user_all").
+		WillReturnRows(primaryKeyRows("PRIMARY", "id"))
+	mock.ExpectExec("ALTER TABLE `user_all` DROP PRIMARY KEY, ADD PRIMARY KEY \\(`id`, `site`\\)").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	columns := map[string]bool{"id": true, "name": true}
+	if err := s.ensureDiscriminator(task, columns); err != nil {
+		t.Fatalf("添加来源字段失败: %v", err)
+	}
+	if !columns["site"] {
+		t.Errorf("添加的来源字段应记入目标表字段")
+	}
+
+	// 删除只作用于本源库的行
+	mock.ExpectBegin()
+	mock.ExpectExec("SET FOREIGN_KEY_CHECKS = 0").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM `user_all` WHERE .* AND `site` = 'gz'").WithArgs(int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	deleted, err := s.deleteTargetKeys(task, []string{"id"}, [][]interface{}{{int64(3)}})
+	if err != nil || deleted != 1 {
+		t.Fatalf("删除目标表记录: %d, %v", deleted, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("未满足的预期: %v", err)
+	}
+}
+
+func TestFanoutSharesDiscoveredTables(t *testing.T) {
+	db, mock := newMockDB(t)
+	fan := newFanout()
+	cfg := &config.Config{}
+	cfg.Sync.BatchSize = 100
+	cfg.Sync.Discovery = config.TableDiscovery{Tables: []string{"log_*"}, Target: "{table}"}
+
+	// 两个目标库各自发现 log_202401，之后第一页只查询一次
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery("INFORMATION_SCHEMA.TABLES").WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME"}).AddRow("log_202401"))
+	}
+	mock.ExpectQuery("SELECT \\* FROM `log_202401` ORDER BY `id` LIMIT \\?").WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+
+	var cursors []*keysetCursor
+	for _, target := range []string{"backup", "report"} {
+		s := &SyncService{target: target, sourceDB: db, config: cfg, tasks: make(map[string]*SyncTask), fanout: fan}
+		if _, err := s.discoverTables(); err != nil {
+			t.Fatalf("目标库 %s 发现表失败: %v", target, err)
+		}
+		cursor := newKeysetCursor("log_202401", []string{"id"}, 2)
+		cursor.round = s.fanout.enter("log_202401")
+		cursors = append(cursors, cursor)
+	}
+	for _, cursor := range cursors {
+		if records, err := cursor.next(db, ""); err != nil || len(records) != 2 {
+			t.Fatalf("读取发现的表失败: %v %v", records, err)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("源库期望未满足: %v", err)
+	}
+}
@@ -7,13 +7,36 @@ import (
 type LogObserver struct{}
 
 func (o *LogObserver) OnSyncStart(task *SyncTask) {
-	log.Printf("开始同步表 %s -> %s", task.SourceTable, task.TargetTable)
+	log.Printf("开始同步表 %s -> %s", sourceName(task), targetName(task))
 }
 
 func (o *LogObserver) OnSyncComplete(task *SyncTask) {
-	log.Printf("表同步完成 %s -> %s", task.SourceTable, task.TargetTable)
+	log.Printf("表同步完成 %s -> %s", sourceName(task), targetName(task))
 }
 
 func (o *LogObserver) OnSyncError(task *SyncTask, err error) {
-	log.Printf("表同步错误 %s -> %s: %v", task.SourceTable, task.TargetTable, err)
+	log.Printf("表同步错误 %s -> %s: %v", sourceName(task), targetName(task), err)
 }
+
+// sourceName 多个源库时在源表前加上源库名称
+func sourceName(task *SyncTask) string {
+	if task.Source == "" {
+		return task.SourceTable
+	}
+	return task.Source + "." + task.SourceTable
+}
+
+// targetName 多个目标库时在目标表前加上目标库名称
+func targetName(task *SyncTask) string {
+	if task.Target == "" {
+		return task.TargetTable
+	}
+	return task.Target + "." + task.TargetTable
+}
+
+// 写入行数和 DDL 已在同步过程中输出日志，这里不再重复
+func (o *LogObserver) OnRowsUpserted(task *SyncTask, rows int) {}
+
+func (o *LogObserver) OnRowsDeleted(task *SyncTask, rows int64) {}
+
+func (o *LogObserver) OnDDLApplied(task *SyncTask, statement string) {}
@@ -3,14 +3,17 @@ package service
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"math"
 	"strings"
 	"sync"
+	"sync/internal/binlog"
 	"sync/internal/config"
 	"time"
 
+	tableschema "github.com/mysql-structure-sync/schema"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -29,32 +32,95 @@ type ColumnDetail struct {
 
 // SyncTask 定义单个同步任务
 type SyncTask struct {
+	Source       string // 源库名称，只有一个源库时为空
+	Target       string // 目标库名称，只有一个目标库时为空
 	SourceTable  string
 	TargetTable  string
 	LastSyncTime int64
 	BatchSize    int
 	Status       string
 	Error        error
+	Checkpoint   Checkpoint // 已提交的同步进度
+	Paused       bool       // 暂停后定时同步跳过该表
+	running      bool
+	chunks       *chunkCache      // chunk_checksum 方式缓存的分块边界和各块的变化信号，只在内存中
+	deletes      *deferredDeletes // 按外键顺序同步时推迟到删除阶段的删除，为空时同步过程中直接删除
+	round        *fanoutRound     // 本轮和其他目标库共用源表读取，只在同步过程中设置
+	throttle     string           // 正在限速等待的原因，为空表示没有限速
 	mutex        sync.RWMutex
 }
 
 // SyncService 同步服务
 type SyncService struct {
-	sourceDB  *gorm.DB
-	targetDB  *gorm.DB
+	source   string // 源库名称，多个源库汇总时写入目标表的 discriminator 字段，只有一个源库时为空
+	target   string // 目标库名称，只有一个目标库时为空
+	sourceDB *gorm.DB
+	targetDB *gorm.DB
+	// fanout 多个目标库共用的调度时间和源表读取，为空时各表按自己的调度直接读取源库
+	fanout *fanout
+	// snapshots 多个目标库共用的 full 模式一致性快照，为空时每轮同步开启自己的快照
+	snapshots *snapshotShare
+	// throttle 读取源库的限速，多个目标库的服务共用；为空时不限速
+	throttle  *sourceThrottle
 	config    *config.Config
 	tasks     map[string]*SyncTask // key: sourceTable
 	observers []SyncObserver
-	ctx       context.Context
-	cancel    context.CancelFunc
-	mutex     sync.RWMutex
+	// checkpoints 保存各表的同步进度，为空时不保存
+	checkpoints checkpointStore
+	// dialBinlog 建立 binlog 复制连接，测试时可替换为进程内的替身
+	dialBinlog func(ctx context.Context, pos binlog.Position) (binlog.Streamer, error)
+	// ctx 所有数据库操作使用的上下文，Stop 时取消，进行中的查询随之中断、事务回滚
+	ctx    context.Context
+	cancel context.CancelFunc
+	// stopCh 收到退出信号后关闭：不再开始新的同步和新的批次，进行中的批次继续提交
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	inflight sync.WaitGroup // 进行中的单表同步
+	// slots 限制同时同步的表数，避免一次调度同时打开大量连接
+	slots chan struct{}
+	// dryRun 不为空时不写入任何数据，只记录本应执行的变更，见 DryRun
+	dryRun *dryRun
+	// fkOrder 开启 foreign_key_order 时最近一轮读取的外键顺序，为空时写入目标表关闭外键检查
+	fkOrder *fkOrder
+	mutex   sync.RWMutex
 }
 
 // SyncObserver 同步观察者接口
 type SyncObserver interface {
 	OnSyncStart(task *SyncTask)
 	OnSyncComplete(task *SyncTask)
+	// OnSyncError err 为 *SyncError，可用 ErrorPhase 取出出错的阶段
 	OnSyncError(task *SyncTask, err error)
+	OnRowsUpserted(task *SyncTask, rows int)
+	OnRowsDeleted(task *SyncTask, rows int64)
+	OnDDLApplied(task *SyncTask, statement string)
+}
+
+// 同步阶段，用于区分错误发生的位置
+const (
+	PhaseSchema  = "schema"  // 表结构同步
+	PhaseCheck   = "check"   // 判断是否需要同步
+	PhaseCopy    = "copy"    // 读取源表并写入目标表
+	PhaseCleanup = "cleanup" // 删除目标表多余的记录
+)
+
+// SyncError 带有阶段信息的同步错误
+type SyncError struct {
+	Phase string
+	Err   error
+}
+
+func (e *SyncError) Error() string { return e.Err.Error() }
+
+func (e *SyncError) Unwrap() error { return e.Err }
+
+// ErrorPhase 返回错误发生的阶段，未标记阶段时返回 "unknown"
+func ErrorPhase(err error) string {
+	var syncErr *SyncError
+	if errors.As(err, &syncErr) {
+		return syncErr.Phase
+	}
+	return "unknown"
 }
 
 // NewSyncService 创建同步服务
@@ -69,15 +135,38 @@ func NewSyncService(cfg *config.Config) (*SyncService, error) {
 		return nil, fmt.Errorf("初始化目标数据库失败: %w", err)
 	}
 
+	return newSyncService(cfg, "", sourceDB, targetDB), nil
+}
+
+// newSyncService 用已建立的连接创建同步服务，多个目标库时各目标库的服务共用 sourceDB，
+// 多个源库时各源库的服务共用 targetDB
+func newSyncService(cfg *config.Config, target string, sourceDB, targetDB *gorm.DB) *SyncService {
 	ctx, cancel := context.WithCancel(context.Background())
 
+	// 数据库会话绑定 ctx，之后的每次查询、事务都会在 Stop 时被取消
 	service := &SyncService{
-		sourceDB: sourceDB,
-		targetDB: targetDB,
-		config:   cfg,
-		tasks:    make(map[string]*SyncTask),
-		ctx:      ctx,
-		cancel:   cancel,
+		source:      cfg.SourceName(),
+		target:      target,
+		sourceDB:    sourceDB.WithContext(ctx),
+		targetDB:    targetDB.WithContext(ctx),
+		config:      cfg,
+		tasks:       make(map[string]*SyncTask),
+		checkpoints: newCheckpointStore(cfg.Sync.Checkpoint, targetDB, cfg.SourceName()),
+		ctx:         ctx,
+		cancel:      cancel,
+		stopCh:      make(chan struct{}),
+		slots:       make(chan struct{}, cfg.Sync.MaxConcurrency),
+		throttle:    newSourceThrottle(cfg.Sync.Throttle),
+	}
+	service.dialBinlog = func(ctx context.Context, pos binlog.Position) (binlog.Streamer, error) {
+		return binlog.Dial(ctx, binlog.Config{
+			Host:            cfg.Database.Source.Host,
+			Port:            cfg.Database.Source.Port,
+			User:            cfg.Database.Source.User,
+			Password:        cfg.Database.Source.Password,
+			ServerID:        cfg.Sync.Binlog.ServerID,
+			HeartbeatPeriod: time.Duration(cfg.Sync.Binlog.HeartbeatPeriod) * time.Second,
+		}, pos)
 	}
 
 	// 初始化同步任务
@@ -85,7 +174,7 @@ func NewSyncService(cfg *config.Config) (*SyncService, error) {
 		service.AddSyncTask(pair.Source, pair.Target)
 	}
 
-	return service, nil
+	return service
 }
 
 // AddSyncTask 添加同步任务
@@ -94,11 +183,14 @@ func (s *SyncService) AddSyncTask(sourceTable, targetTable string) {
 	defer s.mutex.Unlock()
 
 	s.tasks[sourceTable] = &SyncTask{
+		Source:       s.source,
+		Target:       s.target,
 		SourceTable:  sourceTable,
 		TargetTable:  targetTable,
 		BatchSize:    s.config.Sync.BatchSize,
 		Status:       "ready",
 		LastSyncTime: 0, // 设置为 0，表示不限制时间
+		Checkpoint:   Checkpoint{SourceTable: sourceTable, TargetTable: targetTable},
 	}
 }
 
@@ -109,29 +201,54 @@ func (s *SyncService) RegisterObserver(observer SyncObserver) {
 	s.observers = append(s.observers, observer)
 }
 
-// StartSync 开始同步
+// StartSync 开始同步；ctx 取消后不再开始新的同步，等进行中的批次提交后返回
 func (s *SyncService) StartSync(ctx context.Context) error {
-	ticker := time.NewTicker(time.Duration(s.config.Sync.Interval) * time.Second)
-	defer ticker.Stop()
-
-	for {
+	go func() {
 		select {
 		case <-ctx.Done():
-			return nil
-		case <-ticker.C:
-			s.syncAll()
+			s.beginStop()
+		case <-s.stopCh:
 		}
+	}()
+	defer s.inflight.Wait()
+	defer s.beginStop()
+
+	// 启动时先按 discovery 的模式发现表，发现的表和 table_pairs 中的表一起恢复检查点
+	if _, err := s.discoverTables(); err != nil {
+		return err
 	}
+	if err := s.loadCheckpoints(); err != nil {
+		return err
+	}
+
+	if s.config.Sync.SyncMode == "binlog" {
+		return s.startBinlogSync(ctx)
+	}
+
+	return s.runSchedules(ctx)
 }
 
-// syncAll 同步所有表
+// syncAll 同步所有表，跳过已暂停和正在执行的表
 func (s *SyncService) syncAll() {
-	var wg sync.WaitGroup
+	// 发现新表时会并发添加任务，先在锁内取出当前的任务
+	s.mutex.RLock()
+	tasks := make([]*SyncTask, 0, len(s.tasks))
 	for _, task := range s.tasks {
+		tasks = append(tasks, task)
+	}
+	s.mutex.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		if s.stopping() || !task.tryStart() {
+			continue
+		}
 		wg.Add(1)
+		s.inflight.Add(1)
 		go func(t *SyncTask) {
 			defer wg.Done()
-			s.syncTable(t)
+			defer s.inflight.Done()
+			s.runTask(t)
 		}(task)
 	}
 	wg.Wait()
@@ -141,165 +258,370 @@ func (s *SyncService) syncAll() {
 func (s *SyncService) syncTable(task *SyncTask) {
 	s.notifyStart(task)
 
+	// 多个目标库时和同时在同步这张表的目标库共用源表读取
+	if s.fanout != nil {
+		task.round = s.fanout.enter(task.SourceTable)
+		defer func() {
+			s.fanout.leave(task.SourceTable, task.round)
+			task.round = nil
+		}()
+	}
+
+	// 目标表不存在时按 create_if_missing 从源表建表，新建的表本轮做一次全量加载
+	created, err := s.ensureTargetTable(task)
+	if err != nil {
+		s.notifyError(task, PhaseSchema, err)
+		return
+	}
+	if created && s.dryRun != nil {
+		if err := s.dryRunNewTable(task); err != nil {
+			s.notifyError(task, PhaseCheck, err)
+			return
+		}
+		s.completeTask(task, true)
+		return
+	}
+
 	// ==========================================
 	// [新增] 步骤：同步表结构 (Schema Sync)
 	// 在获取数据前，先检查并修复目标表缺失的字段
 	// ==========================================
 	if err := s.syncTableSchema(task); err != nil {
-		s.notifyError(task, fmt.Errorf("同步表结构失败: %w", err))
+		s.notifyError(task, PhaseSchema, fmt.Errorf("同步表结构失败: %w", err))
 		return
 	}
 
 	// 获取表的所有字段
 	columns, err := s.getAllColumns(s.sourceDB, task.SourceTable)
 	if err != nil {
-		s.notifyError(task, err)
+		s.notifyError(task, PhaseCheck, err)
 		return
 	}
-
-	// 判断是否需要同步
-	needSync, err := s.needSync(task, columns)
+	// 按表对的 columns 配置决定读取哪些列、写入目标表时的列名
+	mapping, err := s.columnMapFor(task.SourceTable, columns)
 	if err != nil {
-		s.notifyError(task, err)
+		s.notifyError(task, PhaseCheck, err)
 		return
 	}
 
-	if !needSync {
-		task.mutex.Lock()
-		task.Status = "completed"
-		task.mutex.Unlock()
-		s.notifyComplete(task)
+	// update_time 增量同步按 (更新时间, 主键) 记录水位，其他方式按主键记录本轮进度
+	tablePair := s.getTableConfig(task.SourceTable)
+	useWatermark := s.config.Sync.SyncMode == "incremental" && tablePair.CheckMethod == "update_time" && tablePair.UpdateField != ""
+
+	// 双向同步两边互相写入修改过的行，不使用 check_method 判断
+	if tablePair.Bidirectional {
+		if err := s.syncBidirectional(task, columns); err != nil {
+			s.notifyError(task, ErrorPhase(err), err)
+			return
+		}
+		if s.stopping() {
+			s.stopTask(task)
+			return
+		}
+		s.completeTask(task, true)
 		return
 	}
 
-	// 获取源表总记录数
-	var totalCount int64
-	if err := s.sourceDB.Table(task.SourceTable).Count(&totalCount).Error; err != nil {
-		s.notifyError(task, err)
+	// full 模式下本轮读取源表的计数、分页和删除时比对的主键都在同一个一致性快照中，
+	// 同步期间源表的插入、修改不会导致漏读或重复读取
+	source := s.sourceDB
+	if s.config.Sync.SyncMode == "full" {
+		snapshot, release, err := s.beginSnapshot(task.SourceTable)
+		if err != nil {
+			s.notifyError(task, PhaseCheck, err)
+			return
+		}
+		defer release()
+		source = snapshot
+	}
+
+	// dry-run 时目标表没有真正加上缺失的字段，无法比较两边，按需要全量同步处理
+	schemaPending := s.dryRun.schemaPending()
+
+	// chunk_checksum 按主键范围分块比较，只重新同步不一致的块，块内的删除也一并处理
+	if tablePair.CheckMethod == "chunk_checksum" && !schemaPending {
+		if err := s.syncChunks(task, source, mapping); err != nil {
+			s.notifyError(task, ErrorPhase(err), err)
+			return
+		}
+		if s.stopping() {
+			s.stopTask(task)
+			return
+		}
+		if task.deletes != nil {
+			// 块内多出的行留到删除阶段
+			task.deletes.ready, task.deletes.resetKey = true, true
+			return
+		}
+		s.completeTask(task, true)
 		return
 	}
 
-	// 计算总页数
-	batchSize := task.BatchSize
-	totalPages := int(math.Ceil(float64(totalCount) / float64(batchSize)))
+	// 判断是否需要同步
+	needSync := true
+	if !schemaPending && !created {
+		if needSync, err = s.needSync(task, source, mapping); err != nil {
+			s.notifyError(task, PhaseCheck, err)
+			return
+		}
+	}
 
-	// 分页处理数据
-	for page := 0; page < totalPages; page++ {
-		offset := page * batchSize
-		var sourceRecords []map[string]interface{}
+	if !needSync {
+		s.completeTask(task, !useWatermark)
+		return
+	}
+
+	// 按主键游标分批读取源表
+	primaryKey, err := s.getPrimaryKey(s.sourceDB, task.SourceTable)
+	if err != nil {
+		s.notifyError(task, PhaseCopy, err)
+		return
+	}
+	targetKey, err := mapping.targetKey(task.SourceTable, primaryKey)
+	if err != nil {
+		s.notifyError(task, PhaseCopy, err)
+		return
+	}
 
-		// 根据 sync_mode 决定同步方式
-		if s.config.Sync.SyncMode == "full" {
-			// 全量同步
-			if err := s.sourceDB.Table(task.SourceTable).
-				Offset(offset).
-				Limit(batchSize).
-				Find(&sourceRecords).Error; err != nil {
-				s.notifyError(task, err)
+	// 根据 sync_mode 决定同步方式：增量同步按 (更新时间, 主键) 顺序读取水位之后的记录，
+	// 其他情况（full、binlog 模式的初始加载、没有更新时间字段的表）按主键顺序读取全量数据
+	checkpoint := task.checkpoint()
+	var cursor *keysetCursor
+	var where string
+	var whereArgs []interface{}
+	if useWatermark {
+		cursor = newKeysetCursor(task.SourceTable, append([]string{tablePair.UpdateField}, primaryKey...), task.BatchSize)
+		if !checkpoint.UpdateTime.IsZero() && len(checkpoint.PrimaryKey) == len(primaryKey) {
+			cursor.last = append([]interface{}{checkpoint.UpdateTime}, checkpoint.PrimaryKey...)
+		} else {
+			// 没有检查点时，从目标表中最后更新的时间开始
+			var lastTargetUpdate time.Time
+			targetField := mapping.targetName(tablePair.UpdateField)
+			if err := s.scopedTarget(task.TargetTable).
+				Select(targetField).
+				Order(targetField + " DESC").
+				Limit(1).
+				Scan(&lastTargetUpdate).Error; err != nil {
+				s.notifyError(task, PhaseCopy, err)
 				return
 			}
-		} else {
-			// 增量同步
-			tablePair := s.getTableConfig(task.SourceTable)
-			if tablePair.CheckMethod == "update_time" && tablePair.UpdateField != "" {
-				// 获取目标表中最后更新的时间
-				var lastTargetUpdate time.Time
-				if err := s.targetDB.Table(task.TargetTable).
-					Select(tablePair.UpdateField).
-					Order(tablePair.UpdateField + " DESC").
-					Limit(1).
-					Scan(&lastTargetUpdate).Error; err != nil {
-					s.notifyError(task, err)
-					return
-				}
+			where = fmt.Sprintf("`%s` > ?", tablePair.UpdateField)
+			whereArgs = []interface{}{lastTargetUpdate}
+		}
+	} else {
+		cursor = newKeysetCursor(task.SourceTable, primaryKey, task.BatchSize)
+		if len(checkpoint.PrimaryKey) == len(primaryKey) {
+			// 上一轮中断过，从已提交的主键之后继续
+			cursor.last = checkpoint.PrimaryKey
+		}
+	}
 
-				// 只获取源表中更新时间大于目标表最后更新时间的记录
-				if err := s.sourceDB.Table(task.SourceTable).
-					Where(fmt.Sprintf("%s > ?", tablePair.UpdateField), lastTargetUpdate).
-					Offset(offset).
-					Limit(batchSize).
-					Find(&sourceRecords).Error; err != nil {
-					s.notifyError(task, err)
-					return
-				}
-			}
+	cursor.selects = mapping.selects()
+	cursor.filter = tablePair.Filter
+	cursor.round = task.round
+
+	writer, err := s.newBatchWriter(task.TargetTable)
+	if err != nil {
+		s.notifyError(task, PhaseCopy, err)
+		return
+	}
+
+	for {
+		if s.stopping() {
+			s.stopTask(task)
+			return
 		}
 
-		// 同步当前页的数据
-		if err := s.syncBatchData(task.TargetTable, sourceRecords); err != nil {
-			s.notifyError(task, err)
+		sourceRecords, err := cursor.next(source, where, whereArgs...)
+		if err != nil {
+			s.notifyError(task, PhaseCopy, err)
 			return
 		}
+		if len(sourceRecords) == 0 {
+			break
+		}
+
+		// 同步当前批次的数据，检查点随批次一起提交
+		lastRecord := sourceRecords[len(sourceRecords)-1]
+		checkpoint.PrimaryKey = keyOf(lastRecord, primaryKey)
+		if useWatermark {
+			if updateTime, ok := lastRecord[tablePair.UpdateField].(time.Time); ok {
+				checkpoint.UpdateTime = updateTime
+			}
+		}
+		if !cursor.shared {
+			s.throttleRead(task, len(sourceRecords))
+		}
+		if err := s.syncBatchData(writer, mapping.apply(sourceRecords), &checkpoint); err != nil {
+			s.notifyError(task, PhaseCopy, err)
+			return
+		}
+		s.notifyRowsUpserted(task, len(sourceRecords))
+		task.mutex.Lock()
+		task.Checkpoint.UpdateTime = checkpoint.UpdateTime
+		task.Checkpoint.PrimaryKey = checkpoint.PrimaryKey
+		task.mutex.Unlock()
 
-		log.Printf("已同步表 %s 的第 %d/%d 页数据", task.SourceTable, page+1, totalPages)
+		log.Printf("已同步表 %s 主键范围 %v ~ %v 的 %d 条数据", task.SourceTable,
+			keyOf(sourceRecords[0], primaryKey), checkpoint.PrimaryKey, len(sourceRecords))
+	}
+
+	if s.stopping() {
+		s.stopTask(task)
+		return
 	}
 
 	// 删除目标表中不存在于源表的记录
-	if err := s.cleanupTargetTable(task.SourceTable, task.TargetTable, columns); err != nil {
-		s.notifyError(task, fmt.Errorf("清理目标表失败: %w", err))
+	deleted, err := s.cleanupTargetTable(task, source, primaryKey, targetKey)
+	s.notifyRowsDeleted(task, deleted)
+	if err != nil {
+		s.notifyError(task, PhaseCleanup, fmt.Errorf("清理目标表失败: %w", err))
+		return
+	}
+	if s.stopping() {
+		s.stopTask(task)
+		return
+	}
+
+	// 按外键顺序同步时，所有表写入之后子表先删除
+	if task.deletes != nil {
+		task.deletes.ready, task.deletes.resetKey = true, !useWatermark
 		return
 	}
 
+	s.completeTask(task, !useWatermark)
+}
+
+// stopTask 收到退出信号时中止本轮同步，已提交的批次记录在检查点中，重启后继续
+func (s *SyncService) stopTask(task *SyncTask) {
+	task.mutex.Lock()
+	task.Status = "stopped"
+	task.mutex.Unlock()
+	log.Printf("同步服务正在退出，表 %s 的同步在当前批次提交后停止", task.SourceTable)
+}
+
+// completeTask 标记一轮同步成功；resetKey 为 true 时清空本轮主键进度，下一轮从头开始
+func (s *SyncService) completeTask(task *SyncTask, resetKey bool) {
 	task.mutex.Lock()
 	task.Status = "completed"
+	if resetKey {
+		task.Checkpoint.PrimaryKey = nil
+	}
 	task.mutex.Unlock()
 	s.notifyComplete(task)
 }
 
-// [新增] syncTableSchema 对比源表和目标表的结构，自动添加目标表缺失的字段
+// [新增] syncTableSchema 对比源表和目标表的结构（字段、索引和主键），按表对的 schema_policy 修复目标表：
+// additive（默认）只添加缺失的字段、索引和主键，all 执行全部变更，alert 只告警。执行的 DDL 通知观察者
 func (s *SyncService) syncTableSchema(task *SyncTask) error {
-	// 1. 获取源表详细字段信息
-	sourceCols, err := s.getColumnDetails(s.sourceDB, task.SourceTable)
+	// 1. 获取两边的字段、索引和主键
+	source, err := loadTable(s.sourceDB, task.SourceTable)
 	if err != nil {
 		return fmt.Errorf("获取源表结构失败: %w", err)
 	}
-
-	// 2. 获取目标表所有字段名 (为了快速查找是否存在)
-	targetColNames, err := s.getAllColumns(s.targetDB, task.TargetTable)
+	target, err := loadTable(s.targetDB, task.TargetTable)
 	if err != nil {
 		return fmt.Errorf("获取目标表结构失败: %w", err)
 	}
 
+	// MySQL 的列名不区分大小写
 	targetColMap := make(map[string]bool)
-	for _, name := range targetColNames {
-		targetColMap[name] = true
+	for _, col := range target.Columns {
+		targetColMap[strings.ToLower(col.Name)] = true
 	}
 
-	// 3. 遍历源表字段，检查目标表是否缺失
-	for _, col := range sourceCols {
-		if !targetColMap[col.ColumnName] {
-			log.Printf("检测到表 %s 在目标库缺失字段: %s (%s)，正在自动修复...", task.TargetTable, col.ColumnName, col.ColumnType)
+	// 2. 按列映射换成目标表的列名后对比
+	sourceColNames := make([]string, len(source.Columns))
+	for i, col := range source.Columns {
+		sourceColNames[i] = col.Name
+	}
+	mapping, err := s.columnMapFor(task.SourceTable, sourceColNames)
+	if err != nil {
+		return err
+	}
+	changes := s.compareSchema(task, mapping, source, target)
 
-			// 构建 ALTER TABLE 语句
-			// 示例: ALTER TABLE `mytable` ADD COLUMN `new_col` varchar(255) DEFAULT NULL COMMENT 'xxx'
-			sql := fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` %s", task.TargetTable, col.ColumnName, col.ColumnType)
+	// 3. 按策略执行或告警
+	policy := s.getTableConfig(task.SourceTable).SchemaPolicy
+	if policy == "" {
+		policy = schemaPolicyAdditive
+	}
+	for _, change := range changes {
+		if policy == schemaPolicyAlert || (policy == schemaPolicyAdditive && !change.Additive()) {
+			log.Printf("警告: 目标表 %s 与源表结构不一致 (%s %s)，schema_policy 为 %s，未执行: %s",
+				task.TargetTable, change.Type, change.Name, policy, change.SQL)
+			continue
+		}
 
-			// 处理 NOT NULL
-			if col.IsNullable == "NO" {
-				sql += " NOT NULL"
-			} else {
-				sql += " NULL"
-			}
+		log.Printf("检测到目标表 %s 与源表结构不一致 (%s %s)，正在自动修复...", task.TargetTable, change.Type, change.Name)
+		if err := s.execDDL(task, change.SQL); err != nil {
+			log.Printf("修复表结构失败: %v, SQL: %s", err, change.SQL)
+			return err
+		}
+		if change.Type == tableschema.AddColumn {
+			targetColMap[strings.ToLower(change.Name)] = true
+		}
+	}
 
-			// 处理默认值
-			if col.ColumnDefault.Valid {
-				sql += fmt.Sprintf(" DEFAULT '%s'", col.ColumnDefault.String)
-			}
+	if err := s.ensureDiscriminator(task, targetColMap); err != nil {
+		return err
+	}
 
-			// 处理注释
-			if col.ColumnComment != "" {
-				escapedComment := strings.ReplaceAll(col.ColumnComment, "'", "\\'")
-				sql += fmt.Sprintf(" COMMENT '%s'", escapedComment)
-			}
+	// set 字段的类型无法从源表推断，需要事先在目标表中建好
+	for _, name := range mapping.set {
+		if !targetColMap[strings.ToLower(name)] {
+			return fmt.Errorf("目标表 %s 缺少 set 字段 %s，请先在目标表中创建", task.TargetTable, name)
+		}
+	}
+	return nil
+}
 
-			// 执行 DDL
-			if err := s.targetDB.Exec(sql).Error; err != nil {
-				log.Printf("尝试添加字段失败: %v, SQL: %s", err, sql)
-				return err
-			}
-			log.Printf("成功添加字段: %s 到表 %s", col.ColumnName, task.TargetTable)
+// ensureDiscriminator 多个源库汇总时，目标表需要有记录来源的 discriminator 字段，并且该字段在主键中，
+// 否则不同源库中主键相同的行会互相覆盖。targetColumns 为目标表已有的字段（小写）
+func (s *SyncService) ensureDiscriminator(task *SyncTask, targetColumns map[string]bool) error {
+	column := s.config.Sync.Discriminator
+	if column == "" || s.source == "" {
+		return nil
+	}
+
+	if !targetColumns[strings.ToLower(column)] {
+		sql := fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` VARCHAR(64) NOT NULL DEFAULT ''", task.TargetTable, column)
+		if err := s.execDDL(task, sql); err != nil {
+			return fmt.Errorf("添加来源字段 %s 失败: %w", column, err)
+		}
+		log.Printf("已在目标表 %s 添加来源字段 %s", task.TargetTable, column)
+		targetColumns[strings.ToLower(column)] = true
+	}
+
+	primaryKey, err := s.getPrimaryKey(s.targetDB, task.TargetTable)
+	if err != nil {
+		return fmt.Errorf("获取目标表主键失败: %w", err)
+	}
+	for _, col := range primaryKey {
+		if strings.EqualFold(col, column) {
+			return nil
 		}
 	}
+	// 来源字段放在主键最后，自增列仍然是主键的第一列
+	sql := fmt.Sprintf("ALTER TABLE `%s` DROP PRIMARY KEY, ADD PRIMARY KEY (%s)",
+		task.TargetTable, quoteColumns(append(primaryKey, column)))
+	if err := s.execDDL(task, sql); err != nil {
+		return fmt.Errorf("把来源字段 %s 加入目标表主键失败: %w", column, err)
+	}
+	log.Printf("已把来源字段 %s 加入目标表 %s 的主键", column, task.TargetTable)
+	return nil
+}
+
+// execDDL 在目标库执行 DDL 并通知观察者；dry-run 时只记录
+func (s *SyncService) execDDL(task *SyncTask, sql string) error {
+	if s.dryRun != nil {
+		s.dryRunDDL(sql)
+		return nil
+	}
+	if err := s.targetDB.Exec(sql).Error; err != nil {
+		return err
+	}
+	s.notifyDDL(task, sql)
 	return nil
 }
 
@@ -327,7 +649,13 @@ func (s *SyncService) getColumnDetails(db *gorm.DB, tableName string) ([]ColumnD
 }
 
 // 同步批量数据
-func (s *SyncService) syncBatchData(table string, records []map[string]interface{}) error {
+// checkpoint 不为空时随批次保存；检查点存储支持事务时和数据在同一个事务中提交
+func (s *SyncService) syncBatchData(writer *batchWriter, records []map[string]interface{}, checkpoint *Checkpoint) error {
+	return s.writeBatch(s.targetDB, writer, records, checkpoint)
+}
+
+// writeBatch 在 db 上写入一批数据，死锁时重新执行整批；checkpoint 只能和写入目标库的数据一起提交
+func (s *SyncService) writeBatch(db *gorm.DB, writer *batchWriter, records []map[string]interface{}, checkpoint *Checkpoint) error {
 	// 定义重试策略
 	const (
 		retryCount    = 3
@@ -335,162 +663,254 @@ func (s *SyncService) syncBatchData(table string, records []map[string]interface
 		maxRetryDelay = 2 * time.Second
 	)
 
-	return s.targetDB.Transaction(func(tx *gorm.DB) error {
-		// 在事务开始时关闭外键检查，防止 Error 1452 并发死锁
-		if err := tx.Exec("SET FOREIGN_KEY_CHECKS = 0").Error; err != nil {
-			log.Printf("警告: 无法关闭外键检查: %v", err)
-		}
+	// 1. 空记录检查
+	if len(records) == 0 {
+		return nil
+	}
+	if s.dryRun != nil {
+		return s.dryRunUpsert(db, writer, records)
+	}
 
-		// 1. 空记录检查
-		if len(records) == 0 {
+	// 2. 多行写入；单条语句失败由 writer 拆分重试，只有死锁导致整个事务被回滚时才重新执行整批
+	var lastErr error
+	for attempt := 0; attempt < retryCount; attempt++ {
+		lastErr = db.Transaction(func(tx *gorm.DB) error {
+			// 在事务开始时关闭外键检查，防止 Error 1452 并发死锁；按外键顺序写入目标表时保持检查，写回源表时照常关闭
+			if err := setForeignKeyChecks(tx, db == s.targetDB && s.foreignKeyChecks(writer.table)); err != nil {
+				log.Printf("警告: 无法设置外键检查: %v", err)
+			}
+			if err := writer.write(tx, records); err != nil {
+				return err
+			}
+			if checkpoint != nil && s.checkpoints != nil && s.checkpoints.transactional() {
+				return s.saveCheckpoint(tx, checkpoint)
+			}
 			return nil
+		})
+		if lastErr == nil {
+			log.Printf("成功同步 %d 条记录到表 %s", len(records), writer.table)
+			if checkpoint != nil && s.checkpoints != nil && !s.checkpoints.transactional() {
+				return s.saveCheckpoint(nil, checkpoint)
+			}
+			return nil
+		}
+		if !isDeadlock(lastErr) {
+			return fmt.Errorf("批量同步失败: %w", lastErr)
 		}
 
-		// 2. 使用指数退避的重试机制执行SQL
-		var lastErr error
-		for attempt := 0; attempt < retryCount; attempt++ {
-			for _, record := range records {
-				if err := s.syncSingleRecord(tx, table, record); err != nil {
-					lastErr = err
-					// 计算延迟时间（指数退避）
-					delay := time.Duration(float64(baseDelay) * math.Pow(2, float64(attempt)))
-					if delay > maxRetryDelay {
-						delay = maxRetryDelay
-					}
-					log.Printf("同步记录失败，第 %d 次重试，等待 %v: %v", attempt+1, delay, err)
-					time.Sleep(delay)
-					break // 退出当前记录的循环，进行重试
-				}
-			}
-			if lastErr == nil {
-				log.Printf("成功同步 %d 条记录到表 %s", len(records), table)
-				return nil
-			}
+		// 计算延迟时间（指数退避）
+		delay := time.Duration(float64(baseDelay) * math.Pow(2, float64(attempt)))
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+		log.Printf("批量同步遇到死锁，第 %d 次重试，等待 %v: %v", attempt+1, delay, lastErr)
+		if err := sleepContext(db.Statement.Context, delay); err != nil {
+			return fmt.Errorf("批量同步失败: %w", err)
 		}
+	}
 
-		return fmt.Errorf("批量同步失败，已重试 %d 次: %w", retryCount, lastErr)
-	})
+	return fmt.Errorf("批量同步失败，已重试 %d 次: %w", retryCount, lastErr)
 }
 
-// 同步单条记录
-func (s *SyncService) syncSingleRecord(tx *gorm.DB, table string, record map[string]interface{}) error {
-	// 构建字段名和值的列表
-	var columns []string
-	var placeholders []string
-	var values []interface{}
-	var updates []string
-
-	for col, val := range record {
-		columns = append(columns, fmt.Sprintf("`%s`", col))
-		placeholders = append(placeholders, "?")
-		values = append(values, val)
-		updates = append(updates, fmt.Sprintf("`%s` = VALUES(`%s`)", col, col))
-	}
-
-	// 构建 INSERT ... ON DUPLICATE KEY UPDATE 语句
-	sql := fmt.Sprintf("INSERT INTO `%s` (%s) VALUES (%s) ON DUPLICATE KEY UPDATE %s",
-		table,
-		strings.Join(columns, ", "),
-		strings.Join(placeholders, ", "),
-		strings.Join(updates, ", "))
+// ErrNoUsableKey 表既没有主键，也没有全部列非空的唯一索引，无法逐行定位
+var ErrNoUsableKey = errors.New("没有主键，也没有全部列非空的唯一索引")
 
-	// 执行 SQL
-	if err := tx.Exec(sql, values...).Error; err != nil {
-		return fmt.Errorf("更新记录失败: %w", err)
+// getPrimaryKey 按索引中的顺序返回标识一行的列：优先使用主键（支持联合主键），
+// 没有主键时使用列数最少的、全部列非空的唯一索引；都没有时返回 ErrNoUsableKey
+func (s *SyncService) getPrimaryKey(db *gorm.DB, tableName string) ([]string, error) {
+	var rows []struct {
+		IndexName  string         `gorm:"column:INDEX_NAME"`
+		ColumnName sql.NullString `gorm:"column:COLUMN_NAME"` // 函数索引的表达式部分没有列名
+		Nullable   string         `gorm:"column:NULLABLE"`
 	}
-
-	log.Printf("同步记录成功: %v", record)
-	return nil
-}
-
-// --- 动态获取表的主键名 ---
-func (s *SyncService) getPrimaryKey(db *gorm.DB, tableName string) (string, error) {
-	var primaryKey string
-	// 查询 INFORMATION_SCHEMA 获取主键名
 	err := db.Raw(`
-		SELECT COLUMN_NAME
-		FROM INFORMATION_SCHEMA.COLUMNS
+		SELECT INDEX_NAME, COLUMN_NAME, NULLABLE
+		FROM INFORMATION_SCHEMA.STATISTICS
 		WHERE TABLE_SCHEMA = DATABASE()
 		AND TABLE_NAME = ?
-		AND COLUMN_KEY = 'PRI'
-		LIMIT 1`, tableName).Scan(&primaryKey).Error
-
+		AND NON_UNIQUE = 0
+		ORDER BY INDEX_NAME, SEQ_IN_INDEX`, tableName).Scan(&rows).Error
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("获取表 %s 的主键失败: %w", tableName, err)
 	}
-	if primaryKey == "" {
-		// 如果没找到主键，默认回退到 id，但大概率会报错
-		return "id", nil
+
+	var names []string
+	indexes := make(map[string][]string)
+	unusable := make(map[string]bool)
+	for _, row := range rows {
+		if _, ok := indexes[row.IndexName]; !ok {
+			names = append(names, row.IndexName)
+		}
+		indexes[row.IndexName] = append(indexes[row.IndexName], row.ColumnName.String)
+		if !row.ColumnName.Valid || row.Nullable == "YES" {
+			unusable[row.IndexName] = true
+		}
 	}
-	return primaryKey, nil
-}
 
-// 添加清理目标表的方法
-func (s *SyncService) cleanupTargetTable(sourceTable, targetTable string, columns []string) error {
-	// 获取主键字段名 (动态获取，不再写死 "id")
-	primaryKey, err := s.getPrimaryKey(s.targetDB, targetTable)
-	if err != nil {
-		return fmt.Errorf("获取主键失败: %w", err)
+	if columns, ok := indexes["PRIMARY"]; ok {
+		return columns, nil
+	}
+	var best string
+	for _, name := range names {
+		if !unusable[name] && (best == "" || len(indexes[name]) < len(indexes[best])) {
+			best = name
+		}
 	}
-	if primaryKey == "id" {
-		log.Printf("提示: 未在表 %s 中找到显式主键，尝试使用 'id' 进行清理", targetTable)
+	if best == "" {
+		return nil, fmt.Errorf("表 %s %w", tableName, ErrNoUsableKey)
 	}
+	log.Printf("表 %s 没有主键，使用唯一索引 %s (%s) 定位行", tableName, best, strings.Join(indexes[best], ", "))
+	return indexes[best], nil
+}
 
-	// 使用事务包裹清理逻辑，并关闭外键检查
-	return s.targetDB.Transaction(func(tx *gorm.DB) error {
-		// 关闭外键检查，防止删除时因外键约束失败
-		if err := tx.Exec("SET FOREIGN_KEY_CHECKS = 0").Error; err != nil {
-			log.Printf("警告: 清理时无法关闭外键检查: %v", err)
+// cleanupTargetTable 删除目标表中源表已不存在的记录。两边分别按主键顺序分批读取主键，在进程内合并比对：
+// 每批源表主键只和目标表同一主键范围 (上一批末尾, 本批末尾] 内的主键比较，源表读完后目标表剩余的主键都要删除。
+// 范围由 MySQL 按列的排序规则划分，与 ORDER BY 的顺序一致；内存占用只与 batch_size 有关，与表的行数无关
+// 目标表的行标识列名为 targetKey（列映射可能改了名），取值与源表相同。
+// 源表主键不按 filter 过滤：目标表中不满足 filter 的行只要源表还有就保留，只删除源表已删除的行。
+// 按外键顺序同步时只找出要删除的行记入 task.deletes，在删除阶段删除，返回的删除行数为 0
+func (s *SyncService) cleanupTargetTable(task *SyncTask, sourceDB *gorm.DB, primaryKey, targetKey []string) (int64, error) {
+	source := newKeysetCursor(task.SourceTable, primaryKey, task.BatchSize)
+	source.columns = primaryKey
+	source.round = task.round
+
+	var deleted int64
+	var pending [][]interface{}
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
 		}
-
-		// 检查目标表是否为空
-		var count int64
-		if err := tx.Table(targetTable).Count(&count).Error; err != nil {
-			return fmt.Errorf("检查目标表记录数失败: %w", err)
+		if task.deletes != nil {
+			err := task.deletes.add(targetKey, pending, task.BatchSize)
+			pending = pending[:0]
+			return err
 		}
+		n, err := s.deleteTargetKeys(task, targetKey, pending)
+		deleted += n
+		pending = pending[:0]
+		return err
+	}
 
-		// 如果目标表为空，则不需要清理
-		if count == 0 {
-			log.Printf("目标表 `%s` 为空，无需清理", targetTable)
-			return nil
+	var lower []interface{}
+	for {
+		if s.stopping() {
+			return deleted, flush()
 		}
 
-		// 创建临时表来存储需要保留的记录
-		tempTable := fmt.Sprintf("temp_%s_%d", targetTable, time.Now().UnixNano())
+		records, err := source.next(sourceDB, "")
+		if err != nil {
+			return deleted, fmt.Errorf("读取源表主键失败: %w", err)
+		}
+		if !source.shared {
+			s.throttleRead(task, len(records))
+		}
+		sourceKeys := make(map[string]bool, len(records))
+		for _, record := range records {
+			sourceKeys[formatKey(keyOf(record, primaryKey))] = true
+		}
 
-		// 创建临时表
-		createTempTableSQL := fmt.Sprintf("CREATE TEMPORARY TABLE `%s` LIKE `%s`", tempTable, targetTable)
-		if err := tx.Exec(createTempTableSQL).Error; err != nil {
-			return fmt.Errorf("创建临时表失败: %w", err)
+		var upper []interface{}
+		if !source.done {
+			upper = source.last
+		}
+		condition, args := keyRangeCondition(targetKey, lower, upper)
+		target := newKeysetCursor(task.TargetTable, targetKey, task.BatchSize)
+		target.columns = targetKey
+		target.filter = s.targetScope()
+		for {
+			rows, err := target.next(s.targetDB, condition, args...)
+			if err != nil {
+				return deleted, fmt.Errorf("读取目标表主键失败: %w", err)
+			}
+			if len(rows) == 0 {
+				break
+			}
+			for _, row := range rows {
+				if key := keyOf(row, targetKey); !sourceKeys[formatKey(key)] {
+					pending = append(pending, key)
+				}
+			}
+			if len(pending) >= task.BatchSize {
+				if err := flush(); err != nil {
+					return deleted, err
+				}
+			}
 		}
 
-		// 将源表数据复制到临时表
-		copyDataSQL := fmt.Sprintf("INSERT INTO `%s` SELECT * FROM `%s`", tempTable, sourceTable)
-		if err := tx.Exec(copyDataSQL).Error; err != nil {
-			return fmt.Errorf("复制数据到临时表失败: %w", err)
+		if upper == nil {
+			break
 		}
+		lower = upper
+	}
 
-		// 构建主键条件（动态使用 primaryKey）
-		joinCondition := fmt.Sprintf("t1.`%s` = t2.`%s`", primaryKey, primaryKey)
+	if err := flush(); err != nil {
+		return deleted, err
+	}
+	if deleted > 0 {
+		log.Printf("已从目标表 %s 删除 %d 条源表中不存在的记录", task.TargetTable, deleted)
+	}
+	return deleted, nil
+}
 
-		// 删除目标表中不在临时表中的记录
-		deleteSQL := fmt.Sprintf("DELETE t1 FROM `%s` t1 LEFT JOIN `%s` t2 ON %s WHERE t2.`%s` IS NULL",
-			targetTable, tempTable, joinCondition, primaryKey)
+// deleteTargetKeys 按主键分批删除目标表中的记录，返回删除的行数；多个源库汇总时只删除本源库的行
+func (s *SyncService) deleteTargetKeys(task *SyncTask, primaryKey []string, keys [][]interface{}) (int64, error) {
+	if s.dryRun != nil {
+		s.dryRunDelete(task, primaryKey, keys)
+		return 0, nil
+	}
 
-		if result := tx.Exec(deleteSQL); result.Error != nil {
-			return fmt.Errorf("清理目标表失败: %w", result.Error)
-		} else if result.RowsAffected > 0 {
-			log.Printf("已从目标表删除 %d 条不存在的记录", result.RowsAffected)
+	var total int64
+	for start := 0; start < len(keys); start += task.BatchSize {
+		end := min(start+task.BatchSize, len(keys))
+		condition, args := buildKeyCondition(primaryKey, keys[start:end])
+		if scope := s.targetScope(); scope != "" {
+			condition += " AND " + scope
 		}
 
-		// 删除临时表
-		dropTempTableSQL := fmt.Sprintf("DROP TEMPORARY TABLE IF EXISTS `%s`", tempTable)
-		if err := tx.Exec(dropTempTableSQL).Error; err != nil {
-			log.Printf("删除临时表失败: %v", err)
+		err := s.targetDB.Transaction(func(tx *gorm.DB) error {
+			if err := setForeignKeyChecks(tx, s.foreignKeyChecks(task.TargetTable)); err != nil {
+				log.Printf("警告: 删除时无法设置外键检查: %v", err)
+			}
+			result := tx.Exec(fmt.Sprintf("DELETE FROM `%s` WHERE %s", task.TargetTable, condition), args...)
+			if result.Error != nil {
+				return result.Error
+			}
+			total += result.RowsAffected
+			log.Printf("已从目标表 %s 删除 %d 条记录", task.TargetTable, result.RowsAffected)
+			return nil
+		})
+		if err != nil {
+			return total, fmt.Errorf("删除目标表记录失败: %w", err)
 		}
+	}
+	return total, nil
+}
 
-		return nil
-	})
+// keysGoneFromSource 从候选的目标表多余主键中去掉源表仍然存在（只是不满足 filter）的行，返回源表确实已删除的主键
+func (s *SyncService) keysGoneFromSource(db *gorm.DB, sourceTable string, primaryKey []string, keys [][]interface{}, batchSize int) ([][]interface{}, error) {
+	var gone [][]interface{}
+	for start := 0; start < len(keys); start += batchSize {
+		end := min(start+batchSize, len(keys))
+		condition, args := buildKeyCondition(primaryKey, keys[start:end])
+
+		var rows []map[string]interface{}
+		unlock := lockSnapshot(db)
+		err := db.Table(sourceTable).Select(quoteColumns(primaryKey)).Where(condition, args...).Find(&rows).Error
+		unlock()
+		if err != nil {
+			return nil, fmt.Errorf("查询源表主键失败: %w", err)
+		}
+		exists := make(map[string]bool, len(rows))
+		for _, row := range rows {
+			exists[formatKey(keyOf(row, primaryKey))] = true
+		}
+		for _, key := range keys[start:end] {
+			if !exists[formatKey(key)] {
+				gone = append(gone, key)
+			}
+		}
+	}
+	return gone, nil
 }
 
 // 通知方法
@@ -501,27 +921,101 @@ func (s *SyncService) notifyStart(task *SyncTask) {
 }
 
 func (s *SyncService) notifyComplete(task *SyncTask) {
+	now := time.Now()
+	task.mutex.Lock()
+	task.LastSyncTime = now.Unix()
+	task.Checkpoint.LastSuccessAt = now
+	task.mutex.Unlock()
+
+	checkpoint := task.checkpoint()
+	if err := s.saveCheckpoint(nil, &checkpoint); err != nil {
+		log.Printf("警告: %v", err)
+	}
+
 	for _, observer := range s.observers {
 		observer.OnSyncComplete(task)
 	}
 }
 
-func (s *SyncService) notifyError(task *SyncTask, err error) {
+func (s *SyncService) notifyError(task *SyncTask, phase string, err error) {
+	var syncErr *SyncError
+	if !errors.As(err, &syncErr) {
+		err = &SyncError{Phase: phase, Err: err}
+	}
 	task.mutex.Lock()
 	task.Error = err
 	task.Status = "error"
+	task.Checkpoint.LastError = err.Error()
+	task.Checkpoint.LastErrorAt = time.Now()
 	task.mutex.Unlock()
 
+	checkpoint := task.checkpoint()
+	if saveErr := s.saveCheckpoint(nil, &checkpoint); saveErr != nil {
+		log.Printf("警告: %v", saveErr)
+	}
+
 	for _, observer := range s.observers {
 		observer.OnSyncError(task, err)
 	}
 }
 
-// Stop 停止同步服务
+func (s *SyncService) notifyRowsUpserted(task *SyncTask, rows int) {
+	for _, observer := range s.observers {
+		observer.OnRowsUpserted(task, rows)
+	}
+}
+
+func (s *SyncService) notifyRowsDeleted(task *SyncTask, rows int64) {
+	for _, observer := range s.observers {
+		observer.OnRowsDeleted(task, rows)
+	}
+}
+
+func (s *SyncService) notifyDDL(task *SyncTask, statement string) {
+	for _, observer := range s.observers {
+		observer.OnDDLApplied(task, statement)
+	}
+}
+
+// Stop 停止同步服务：不再开始新的同步，并取消所有进行中的数据库操作
 func (s *SyncService) Stop() {
+	s.beginStop()
 	s.cancel()
 }
 
+func (s *SyncService) beginStop() {
+	s.stopOnce.Do(func() {
+		if s.stopCh != nil {
+			close(s.stopCh)
+		}
+	})
+}
+
+// stopping 是否已收到退出信号
+func (s *SyncService) stopping() bool {
+	select {
+	case <-s.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleepContext 等待 d，ctx 取消时提前返回
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 // initDB 初始化数据库连接
 func initDB(dsn string) (*gorm.DB, error) {
 	// 添加 sql_mode 参数来允许无效日期
@@ -578,7 +1072,8 @@ func (s *SyncService) getAllColumns(db *gorm.DB, tableName string) ([]string, er
 }
 
 // 添加比较表数据的方法
-func (s *SyncService) needSync(task *SyncTask, columns []string) (bool, error) {
+// source 为读取源表使用的连接，full 模式下为本轮的一致性快照
+func (s *SyncService) needSync(task *SyncTask, source *gorm.DB, mapping *columnMap) (bool, error) {
 	// 获取表配置
 	tablePair := s.getTableConfig(task.SourceTable)
 
@@ -586,21 +1081,47 @@ func (s *SyncService) needSync(task *SyncTask, columns []string) (bool, error) {
 	case "update_time":
 		if tablePair.UpdateField == "" {
 			log.Printf("警告: 表 %s 配置使用update_time检查但未指定更新时间字段，将使用checksum", task.SourceTable)
-			return s.checkByChecksum(task.SourceTable, task.TargetTable)
+			return s.checkByChecksum(source, task.SourceTable, task.TargetTable, mapping)
 		}
-		return s.checkByUpdateTime(task.SourceTable, task.TargetTable, tablePair.UpdateField)
+		return s.checkByUpdateTime(source, task.SourceTable, task.TargetTable, tablePair.UpdateField, mapping)
 
 	case "count":
-		return s.checkByCount(task.SourceTable, task.TargetTable)
+		return s.checkByCount(source, task.SourceTable, task.TargetTable)
 
 	case "checksum":
 		fallthrough
 	default:
-		return s.checkByChecksum(task.SourceTable, task.TargetTable)
+		return s.checkByChecksum(source, task.SourceTable, task.TargetTable, mapping)
+	}
+}
+
+// targetScope 多个源库汇总时目标表中属于本源库的行的条件，其他情况为空
+func (s *SyncService) targetScope() string {
+	if s.source == "" || s.config.Sync.Discriminator == "" {
+		return ""
 	}
+	return fmt.Sprintf("`%s` = %s", s.config.Sync.Discriminator, sqlLiteral(s.source))
 }
 
-func (s *SyncService) checkByUpdateTime(sourceTable, targetTable, updateField string) (bool, error) {
+// scopedTarget 目标表的查询，多个源库汇总时只包含本源库的行
+func (s *SyncService) scopedTarget(targetTable string) *gorm.DB {
+	query := s.targetDB.Table(targetTable)
+	if scope := s.targetScope(); scope != "" {
+		query = query.Where(scope)
+	}
+	return query
+}
+
+// filteredSource 在 source 上查询源表，配置了 filter 时只包含满足条件的行
+func (s *SyncService) filteredSource(source *gorm.DB, sourceTable string) *gorm.DB {
+	query := source.Table(sourceTable)
+	if filter := s.getTableConfig(sourceTable).Filter; filter != "" {
+		query = query.Where("(" + filter + ")")
+	}
+	return query
+}
+
+func (s *SyncService) checkByUpdateTime(source *gorm.DB, sourceTable, targetTable, updateField string, mapping *columnMap) (bool, error) {
 	// 检查字段是否存在
 	columns, err := s.getAllColumns(s.sourceDB, sourceTable)
 	if err != nil {
@@ -617,27 +1138,34 @@ func (s *SyncService) checkByUpdateTime(sourceTable, targetTable, updateField st
 
 	if !hasUpdateField {
 		log.Printf("警告: 表 %s 不存在更新时间字段 %s，将使用checksum", sourceTable, updateField)
-		return s.checkByChecksum(sourceTable, targetTable)
+		return s.checkByChecksum(source, sourceTable, targetTable, mapping)
 	}
 
 	// 比较最新更新时间
 	var sourceLastUpdate, targetLastUpdate time.Time
-	if err := s.sourceDB.Table(sourceTable).Select(updateField).Order(updateField + " DESC").Limit(1).Scan(&sourceLastUpdate).Error; err != nil {
+	targetField := mapping.targetName(updateField)
+	unlock := lockSnapshot(source)
+	err = s.filteredSource(source, sourceTable).Select(updateField).Order(updateField + " DESC").Limit(1).Scan(&sourceLastUpdate).Error
+	unlock()
+	if err != nil {
 		return true, err
 	}
-	if err := s.targetDB.Table(targetTable).Select(updateField).Order(updateField + " DESC").Limit(1).Scan(&targetLastUpdate).Error; err != nil {
+	if err := s.scopedTarget(targetTable).Select(targetField).Order(targetField + " DESC").Limit(1).Scan(&targetLastUpdate).Error; err != nil {
 		return true, err
 	}
 
 	return !sourceLastUpdate.Equal(targetLastUpdate), nil
 }
 
-func (s *SyncService) checkByCount(sourceTable, targetTable string) (bool, error) {
+func (s *SyncService) checkByCount(source *gorm.DB, sourceTable, targetTable string) (bool, error) {
 	var sourceCount, targetCount int64
-	if err := s.sourceDB.Table(sourceTable).Count(&sourceCount).Error; err != nil {
+	unlock := lockSnapshot(source)
+	err := s.filteredSource(source, sourceTable).Count(&sourceCount).Error
+	unlock()
+	if err != nil {
 		return true, fmt.Errorf("获取源表记录数失败: %w", err)
 	}
-	if err := s.targetDB.Table(targetTable).Count(&targetCount).Error; err != nil {
+	if err := s.scopedTarget(targetTable).Count(&targetCount).Error; err != nil {
 		return true, fmt.Errorf("获取目标表记录数失败: %w", err)
 	}
 
@@ -650,7 +1178,12 @@ func (s *SyncService) checkByCount(sourceTable, targetTable string) (bool, error
 	return false, nil
 }
 
-func (s *SyncService) checkByChecksum(sourceTable, targetTable string) (bool, error) {
+func (s *SyncService) checkByChecksum(source *gorm.DB, sourceTable, targetTable string, mapping *columnMap) (bool, error) {
+	// CHECKSUM TABLE 不能带条件、也不能去掉脱敏的列，配置了 filter、mask 或多个源库汇总时改为按列计算校验值
+	if filter := s.getTableConfig(sourceTable).Filter; filter != "" || len(mapping.masks) > 0 || s.targetScope() != "" {
+		return s.checkByRowChecksum(source, sourceTable, targetTable, filter, mapping)
+	}
+
 	// 定义结构体来接收结果
 	type ChecksumResult struct {
 		Table    string
@@ -660,7 +1193,10 @@ func (s *SyncService) checkByChecksum(sourceTable, targetTable string) (bool, er
 	var sourceResult, targetResult ChecksumResult
 
 	// 获取源表校验和
-	if err := s.sourceDB.Raw("CHECKSUM TABLE " + sourceTable).Scan(&sourceResult).Error; err != nil {
+	unlock := lockSnapshot(source)
+	err := source.Raw("CHECKSUM TABLE " + sourceTable).Scan(&sourceResult).Error
+	unlock()
+	if err != nil {
 		return true, fmt.Errorf("获取源表校验和失败: %w", err)
 	}
 
@@ -679,6 +1215,29 @@ func (s *SyncService) checkByChecksum(sourceTable, targetTable string) (bool, er
 	return false, nil
 }
 
+// checkByRowChecksum 比较源表满足 filter 的行与目标表全部行的行数和校验值，脱敏的列不参与比较。
+// 目标表保留了不满足 filter 的行时两边始终不一致，每轮都会重新同步
+func (s *SyncService) checkByRowChecksum(source *gorm.DB, sourceTable, targetTable, filter string, mapping *columnMap) (bool, error) {
+	whole := &chunkState{}
+	sourceExprs, targetExprs := mapping.checksumExprs()
+	sourceSum, err := (&chunkSide{db: source, table: sourceTable, exprs: sourceExprs, filter: filter}).sum(whole, true)
+	if err != nil {
+		return true, fmt.Errorf("获取源表校验和失败: %w", err)
+	}
+	targetSum, err := (&chunkSide{db: s.targetDB, table: targetTable, exprs: targetExprs, filter: s.targetScope()}).sum(whole, true)
+	if err != nil {
+		return true, fmt.Errorf("获取目标表校验和失败: %w", err)
+	}
+
+	if sourceSum.Cnt != targetSum.Cnt || sourceSum.Crc != targetSum.Crc {
+		log.Printf("表 %s 数据校验和不一致: 源表 %d 行，目标表 %d 行", sourceTable, sourceSum.Cnt, targetSum.Cnt)
+		return true, nil
+	}
+
+	log.Printf("表 %s 数据一致，无需同步", sourceTable)
+	return false, nil
+}
+
 // 获取表配置
 func (s *SyncService) getTableConfig(sourceTable string) *config.TablePair {
 	// 遍历配置中的表配置
@@ -688,10 +1247,12 @@ func (s *SyncService) getTableConfig(sourceTable string) *config.TablePair {
 		}
 	}
 
-	// 如果没有找到对应配置，返回默认配置
+	// 如果没有找到对应配置（包括自动发现的表），返回默认配置
+	discovery := s.config.Sync.Discovery
 	return &config.TablePair{
-		Source:      sourceTable,
-		Target:      sourceTable,
-		CheckMethod: "checksum", // 默认使用 checksum 检查
+		Source:          sourceTable,
+		Target:          discovery.TargetName(sourceTable),
+		CheckMethod:     "checksum", // 默认使用 checksum 检查
+		CreateIfMissing: discovery.CreateIfMissing,
 	}
 }
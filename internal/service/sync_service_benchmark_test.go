@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"github.com/DATA-DOG/go-sqlmock"
 	"math/rand"
+	"strings"
 	"testing"
 	"time"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 // ----------------------------- 模拟配置结构 -----------------------------
@@ -359,3 +361,127 @@ func TestSyncServicePerformance(t *testing.T) {
 		})
 	}
 }
+
+// ----------------------------- 写入方式对比 -----------------------------
+
+var userRecordColumns = []string{"id", "name", "email", "age", "gender", "phone", "address", "status", "created_by", "updated_by", "created_at", "updated_at"}
+
+func openBenchmarkDB(tb testing.TB) (*gorm.DB, sqlmock.Sqlmock) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		tb.Fatalf("创建模拟数据库失败: %v", err)
+	}
+	tb.Cleanup(func() { mockDB.Close() })
+
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      mockDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		tb.Fatalf("打开数据库失败: %v", err)
+	}
+	return db, mock
+}
+
+func generateWriterRecords(count int) []map[string]interface{} {
+	records := generateMockUserRecords(count)
+	for i, record := range records {
+		record["id"] = int64(i + 1)
+	}
+	return records
+}
+
+// writeSingleRows 逐行 INSERT ... ON DUPLICATE KEY UPDATE，即改造前 syncSingleRecord 的写法
+func writeSingleRows(db *gorm.DB, table string, records []map[string]interface{}) error {
+	for _, record := range records {
+		var columns, placeholders, updates []string
+		var values []interface{}
+		for col, val := range record {
+			columns = append(columns, fmt.Sprintf("`%s`", col))
+			placeholders = append(placeholders, "?")
+			values = append(values, val)
+			updates = append(updates, fmt.Sprintf("`%s` = VALUES(`%s`)", col, col))
+		}
+		sql := fmt.Sprintf("INSERT INTO `%s` (%s) VALUES (%s) ON DUPLICATE KEY UPDATE %s",
+			table, strings.Join(columns, ", "), strings.Join(placeholders, ", "), strings.Join(updates, ", "))
+		if err := db.Exec(sql, values...).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expectWrites 设置写入期望，返回预期执行的语句数
+func expectWrites(mock sqlmock.Sqlmock, multiRow bool, size int) int {
+	statements := size
+	if multiRow {
+		rowsPerStatement := maxPlaceholders / len(userRecordColumns)
+		statements = (size + rowsPerStatement - 1) / rowsPerStatement
+	}
+	for i := 0; i < statements; i++ {
+		mock.ExpectExec("INSERT INTO `user_records`").WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	return statements
+}
+
+func runWriter(db *gorm.DB, multiRow bool, records []map[string]interface{}) error {
+	if !multiRow {
+		return writeSingleRows(db, "user_records", records)
+	}
+	writer := &batchWriter{table: "user_records", tableColumns: userRecordColumns, maxAllowedPacket: defaultMaxAllowedPacket}
+	return writer.write(db, records)
+}
+
+func BenchmarkBatchWriter(b *testing.B) {
+	modes := []struct {
+		name     string
+		multiRow bool
+	}{{"SingleRow", false}, {"MultiRow", true}}
+
+	for _, size := range []int{3000, 5000} {
+		records := generateWriterRecords(size)
+		for _, mode := range modes {
+			b.Run(fmt.Sprintf("%s_%d", mode.name, size), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					// 每轮使用新的模拟库，避免期望列表越积越长影响计时
+					b.StopTimer()
+					db, mock := openBenchmarkDB(b)
+					expectWrites(mock, mode.multiRow, size)
+					b.StartTimer()
+
+					if err := runWriter(db, mode.multiRow, records); err != nil {
+						b.Fatalf("写入失败: %v", err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestBatchWriterPerformance(t *testing.T) {
+	for _, size := range []int{3000, 5000, 10000} {
+		t.Run(fmt.Sprintf("DataSize_%d", size), func(t *testing.T) {
+			records := generateWriterRecords(size)
+
+			var durations [2]time.Duration
+			var statements [2]int
+			for i, multiRow := range []bool{false, true} {
+				db, mock := openBenchmarkDB(t)
+				statements[i] = expectWrites(mock, multiRow, size)
+
+				start := time.Now()
+				if err := runWriter(db, multiRow, records); err != nil {
+					t.Fatalf("写入失败: %v", err)
+				}
+				durations[i] = time.Since(start)
+
+				if err := mock.ExpectationsWereMet(); err != nil {
+					t.Errorf("未满足的数据库期望: %v", err)
+				}
+			}
+
+			t.Logf("数据量: %d, 逐行写入 %d 条语句耗时 %v, 多行写入 %d 条语句耗时 %v",
+				size, statements[0], durations[0], statements[1], durations[1])
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"sync/internal/config"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestCleanupTargetTable(t *testing.T) {
+	sourceDB, sourceMock := newMockDB(t)
+	targetDB, targetMock := newMockDB(t)
+
+	task := &SyncTask{SourceTable: "user", TargetTable: "user_backup", BatchSize: 2}
+	s := &SyncService{sourceDB: sourceDB, targetDB: targetDB, config: &config.Config{}}
+
+	// 源表第一批主键 1、3，目标表 (-∞, 3] 内多出 2
+	sourceMock.ExpectQuery("SELECT `id` FROM `user` ORDER BY `id` LIMIT \\?").WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(3))
+	targetMock.ExpectQuery("SELECT `id` FROM `user_backup` WHERE \\(\\(`id` <= \\?\\)\\) ORDER BY `id` LIMIT \\?").
+		WithArgs(int64(3), 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	targetMock.ExpectQuery("SELECT `id` FROM `user_backup` WHERE \\(\\(`id` <= \\?\\)\\) AND \\(\\(`id` > \\?\\)\\) ORDER BY `id` LIMIT \\?").
+		WithArgs(int64(3), int64(2), 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+
+	// 源表最后一批主键 5，目标表 (3, +∞) 内多出 4；攒够一批后删除 2、4
+	sourceMock.ExpectQuery("SELECT `id` FROM `user` WHERE \\(\\(`id` > \\?\\)\\) ORDER BY `id` LIMIT \\?").
+		WithArgs(int64(3), 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	targetMock.ExpectQuery("SELECT `id` FROM `user_backup` WHERE \\(\\(`id` > \\?\\)\\) ORDER BY `id` LIMIT \\?").
+		WithArgs(int64(3), 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4).AddRow(5))
+	targetMock.ExpectBegin()
+	targetMock.ExpectExec("SET FOREIGN_KEY_CHECKS = 0").WillReturnResult(sqlmock.NewResult(0, 0))
+	targetMock.ExpectExec("DELETE FROM `user_backup` WHERE `id` IN \\(\\?, \\?\\)").WithArgs(int64(2), int64(4)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	targetMock.ExpectCommit()
+	targetMock.ExpectQuery("SELECT `id` FROM `user_backup` WHERE \\(\\(`id` > \\?\\)\\) AND \\(\\(`id` > \\?\\)\\) ORDER BY `id` LIMIT \\?").
+		WithArgs(int64(3), int64(5), 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	deleted, err := s.cleanupTargetTable(task, s.sourceDB, []string{"id"}, []string{"id"})
+	if err != nil {
+		t.Fatalf("清理失败: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("期望删除 2 条记录，实际 %d", deleted)
+	}
+
+	if err := sourceMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("源库期望未满足: %v", err)
+	}
+	if err := targetMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("目标库期望未满足: %v", err)
+	}
+}
+
+// primaryKeyRows 模拟 INFORMATION_SCHEMA.STATISTICS 中一个非空唯一索引的各列
+func primaryKeyRows(index string, columns ...string) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"INDEX_NAME", "COLUMN_NAME", "NULLABLE"})
+	for _, col := range columns {
+		rows.AddRow(index, col, "")
+	}
+	return rows
+}
+
+func TestGetPrimaryKey(t *testing.T) {
+	db, mock := newMockDB(t)
+	s := &SyncService{config: &config.Config{}}
+
+	// 联合主键按索引中的顺序返回
+	mock.ExpectQuery("INFORMATION_SCHEMA.STATISTICS").WithArgs("user_group").
+		WillReturnRows(sqlmock.NewRows([]string{"INDEX_NAME", "COLUMN_NAME", "NULLABLE"}).
+			AddRow("PRIMARY", "user_id", "").AddRow("PRIMARY", "group_id", "").
+			AddRow("uk_code", "code", ""))
+	// 没有主键时跳过含可空列和函数部分的索引，选列数最少的非空唯一索引
+	mock.ExpectQuery("INFORMATION_SCHEMA.STATISTICS").WithArgs("node_tag").
+		WillReturnRows(sqlmock.NewRows([]string{"INDEX_NAME", "COLUMN_NAME", "NULLABLE"}).
+			AddRow("uk_email", "email", "YES").
+			AddRow("uk_expr", nil, "").
+			AddRow("uk_node_tag", "node_id", "").AddRow("uk_node_tag", "tag", "").
+			AddRow("uk_uuid", "uuid", ""))
+	// 没有可用的唯一索引
+	mock.ExpectQuery("INFORMATION_SCHEMA.STATISTICS").WithArgs("access_log").
+		WillReturnRows(sqlmock.NewRows([]string{"INDEX_NAME", "COLUMN_NAME", "NULLABLE"}).
+			AddRow("uk_email", "email", "YES"))
+
+	if key, err := s.getPrimaryKey(db, "user_group"); err != nil || !reflect.DeepEqual(key, []string{"user_id", "group_id"}) {
+		t.Errorf("联合主键错误: %v %v", key, err)
+	}
+	if key, err := s.getPrimaryKey(db, "node_tag"); err != nil || !reflect.DeepEqual(key, []string{"uuid"}) {
+		t.Errorf("唯一索引回退错误: %v %v", key, err)
+	}
+	if _, err := s.getPrimaryKey(db, "access_log"); !errors.Is(err, ErrNoUsableKey) {
+		t.Errorf("没有可用的索引时应返回 ErrNoUsableKey，实际: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("未满足的数据库期望: %v", err)
+	}
+}
@@ -0,0 +1,373 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync/internal/config"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// 行差异的类型
+const (
+	DiffMissing = "missing" // 目标表缺少该行
+	DiffExtra   = "extra"   // 目标表多出该行
+	DiffChanged = "changed" // 两边都有但列值不同
+)
+
+// RowDiff 源表和目标表之间的一行差异
+type RowDiff struct {
+	Kind       string
+	PrimaryKey []string
+	Key        []interface{}
+	Columns    []string               // changed 时值不同的列
+	Source     map[string]interface{} // missing、changed 时源表的行
+}
+
+func (d RowDiff) String() string {
+	if d.Kind == DiffChanged {
+		return fmt.Sprintf("%s %s columns=%s", d.Kind, d.keyString(), strings.Join(d.Columns, ","))
+	}
+	return fmt.Sprintf("%s %s", d.Kind, d.keyString())
+}
+
+func (d RowDiff) keyString() string {
+	parts := make([]string, len(d.PrimaryKey))
+	for i, col := range d.PrimaryKey {
+		parts[i] = fmt.Sprintf("%s=%v", col, normalizeKey(d.Key[i : i+1])[0])
+	}
+	return strings.Join(parts, ",")
+}
+
+// DiffOptions 逐行比较时对差异的处理方式
+type DiffOptions struct {
+	Report    func(diff RowDiff) // 每发现一行差异调用一次
+	RepairSQL io.Writer          // 不为空时写入修复语句
+	Apply     bool               // 直接在目标表上修复
+}
+
+// DiffSummary 逐行比较的统计结果
+type DiffSummary struct {
+	SourceRows int64
+	Missing    int64
+	Extra      int64
+	Changed    int64
+}
+
+// Differences 差异行数
+func (d *DiffSummary) Differences() int64 {
+	return d.Missing + d.Extra + d.Changed
+}
+
+// DiffTable 按主键顺序逐行比较一对表：源表按批读取，每批只读取目标表同一主键范围内的行，
+// 范围过滤和排序都由 MySQL 完成，不依赖 Go 中的排序规则。源表的行按列映射转换后，只比较目标表中存在的列。
+// 配置了 filter 时只比较满足条件的行，目标表中源表仍然存在但不满足条件的行不算多出
+func (s *SyncService) DiffTable(pair config.TablePair, opts DiffOptions) (*DiffSummary, error) {
+	// 逐行读取整张表，不输出每条 SQL
+	quiet := &gorm.Session{Logger: logger.Default.LogMode(logger.Warn)}
+	sourceDB, targetDB := s.sourceDB.Session(quiet), s.targetDB.Session(quiet)
+
+	primaryKey, err := s.getPrimaryKey(sourceDB, pair.Source)
+	if err != nil {
+		return nil, fmt.Errorf("获取主键失败: %w", err)
+	}
+	mapping, err := s.diffMapping(sourceDB, targetDB, pair)
+	if err != nil {
+		return nil, err
+	}
+	targetKey, err := mapping.targetKey(pair.Source, primaryKey)
+	if err != nil {
+		return nil, err
+	}
+	columns := mapping.targetColumns()
+
+	batchSize := s.config.Sync.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	task := &SyncTask{SourceTable: pair.Source, TargetTable: pair.Target, BatchSize: batchSize}
+	var writer *batchWriter
+	if opts.Apply {
+		if writer, err = s.newBatchWriter(pair.Target); err != nil {
+			return nil, err
+		}
+	}
+
+	summary := &DiffSummary{}
+	source := newKeysetCursor(pair.Source, primaryKey, batchSize)
+	source.selects = mapping.selects()
+	source.filter = pair.Filter
+	var lower []interface{}
+	for {
+		if s.stopping() {
+			return summary, ErrStopping
+		}
+
+		records, err := source.next(sourceDB, "")
+		if err != nil {
+			return summary, fmt.Errorf("读取源表失败: %w", err)
+		}
+		summary.SourceRows += int64(len(records))
+
+		// 本批覆盖的主键范围 (lower, upper]；源表读完后不设上界，目标表剩下的行都是多余的
+		var upper []interface{}
+		if !source.done {
+			upper = source.last
+		}
+
+		diffs, err := s.diffRange(targetDB, pair, targetKey, columns, mapping.apply(records), lower, upper, batchSize)
+		if err != nil {
+			return summary, err
+		}
+		if pair.Filter != "" {
+			if diffs, err = s.dropFilteredExtras(sourceDB, pair, primaryKey, diffs, batchSize); err != nil {
+				return summary, err
+			}
+		}
+		if err := s.handleDiffs(task, writer, pair, columns, diffs, opts, summary); err != nil {
+			return summary, err
+		}
+
+		if upper == nil {
+			return summary, nil
+		}
+		lower = upper
+	}
+}
+
+// diffMapping 解析表对的列映射，只保留目标表中存在的列；目标表中没有对应源列的字段打印警告后忽略
+func (s *SyncService) diffMapping(sourceDB, targetDB *gorm.DB, pair config.TablePair) (*columnMap, error) {
+	sourceColumns, err := s.getAllColumns(sourceDB, pair.Source)
+	if err != nil {
+		return nil, err
+	}
+	targetColumns, err := s.getAllColumns(targetDB, pair.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping, err := s.columnMapFor(pair.Source, sourceColumns)
+	if err != nil {
+		return nil, err
+	}
+	mapping = mapping.within(pair.Target, targetColumns)
+
+	mapped := make(map[string]bool)
+	for _, col := range mapping.targetColumns() {
+		mapped[strings.ToLower(col)] = true
+	}
+	for _, col := range targetColumns {
+		if !mapped[strings.ToLower(col)] {
+			log.Printf("警告: 源表 %s 没有对应目标字段 %s 的列，比较时忽略", pair.Source, col)
+		}
+	}
+	return mapping, nil
+}
+
+// diffRange 比较一批源表行（已转换为目标表列名）和目标表同一主键范围内的行
+func (s *SyncService) diffRange(targetDB *gorm.DB, pair config.TablePair, primaryKey, columns []string,
+	records []map[string]interface{}, lower, upper []interface{}, batchSize int) ([]RowDiff, error) {
+	sourceRows := make(map[string]map[string]interface{}, len(records))
+	for _, record := range records {
+		sourceRows[formatKey(keyOf(record, primaryKey))] = record
+	}
+
+	var diffs []RowDiff
+	matched := make(map[string]bool, len(records))
+	condition, args := keyRangeCondition(primaryKey, lower, upper)
+	target := newKeysetCursor(pair.Target, primaryKey, batchSize)
+	target.columns = columns
+	target.filter = s.targetScope()
+	for {
+		rows, err := target.next(targetDB, condition, args...)
+		if err != nil {
+			return nil, fmt.Errorf("读取目标表失败: %w", err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		for _, row := range rows {
+			key := keyOf(row, primaryKey)
+			id := formatKey(key)
+			record, ok := sourceRows[id]
+			if !ok {
+				diffs = append(diffs, RowDiff{Kind: DiffExtra, PrimaryKey: primaryKey, Key: key})
+				continue
+			}
+			matched[id] = true
+			if changed := changedColumns(record, row, columns); len(changed) > 0 {
+				diffs = append(diffs, RowDiff{Kind: DiffChanged, PrimaryKey: primaryKey, Key: key, Columns: changed, Source: record})
+			}
+		}
+	}
+
+	for _, record := range records {
+		key := keyOf(record, primaryKey)
+		if !matched[formatKey(key)] {
+			diffs = append(diffs, RowDiff{Kind: DiffMissing, PrimaryKey: primaryKey, Key: key, Source: record})
+		}
+	}
+	return diffs, nil
+}
+
+// dropFilteredExtras 去掉目标表多出、但源表仍然存在（只是不满足 filter）的行，这些行不算差异
+func (s *SyncService) dropFilteredExtras(sourceDB *gorm.DB, pair config.TablePair, primaryKey []string, diffs []RowDiff, batchSize int) ([]RowDiff, error) {
+	var extras [][]interface{}
+	for _, diff := range diffs {
+		if diff.Kind == DiffExtra {
+			extras = append(extras, diff.Key)
+		}
+	}
+	if len(extras) == 0 {
+		return diffs, nil
+	}
+
+	gone, err := s.keysGoneFromSource(sourceDB, pair.Source, primaryKey, extras, batchSize)
+	if err != nil {
+		return nil, err
+	}
+	deleted := make(map[string]bool, len(gone))
+	for _, key := range gone {
+		deleted[formatKey(key)] = true
+	}
+	kept := diffs[:0]
+	for _, diff := range diffs {
+		if diff.Kind != DiffExtra || deleted[formatKey(diff.Key)] {
+			kept = append(kept, diff)
+		}
+	}
+	return kept, nil
+}
+
+// handleDiffs 统计、报告差异，按选项写入修复语句或直接修复目标表
+func (s *SyncService) handleDiffs(task *SyncTask, writer *batchWriter, pair config.TablePair, columns []string,
+	diffs []RowDiff, opts DiffOptions, summary *DiffSummary) error {
+	var upserts []map[string]interface{}
+	var deletes [][]interface{}
+	scope := s.targetScope()
+	for _, diff := range diffs {
+		switch diff.Kind {
+		case DiffMissing:
+			summary.Missing++
+			upserts = append(upserts, diff.Source)
+		case DiffChanged:
+			summary.Changed++
+			upserts = append(upserts, diff.Source)
+		case DiffExtra:
+			summary.Extra++
+			deletes = append(deletes, diff.Key)
+		}
+
+		if opts.Report != nil {
+			opts.Report(diff)
+		}
+		if opts.RepairSQL != nil {
+			if _, err := io.WriteString(opts.RepairSQL, repairStatement(pair.Target, columns, scope, diff)+"\n"); err != nil {
+				return fmt.Errorf("写入修复语句失败: %w", err)
+			}
+		}
+	}
+
+	if !opts.Apply {
+		return nil
+	}
+	if len(upserts) > 0 {
+		if err := s.syncBatchData(writer, upserts, nil); err != nil {
+			return fmt.Errorf("修复目标表失败: %w", err)
+		}
+	}
+	if len(deletes) > 0 {
+		if _, err := s.deleteTargetKeys(task, diffs[0].PrimaryKey, deletes); err != nil {
+			return fmt.Errorf("删除目标表多余的记录失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// changedColumns 返回值不同的列
+func changedColumns(source, target map[string]interface{}, columns []string) []string {
+	var changed []string
+	for _, col := range columns {
+		if !valuesEqual(source[col], target[col]) {
+			changed = append(changed, col)
+		}
+	}
+	return changed
+}
+
+// valuesEqual 比较两边读出的列值，[]byte 与字符串、时间按 MySQL 的文本形式比较
+func valuesEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	values := normalizeKey([]interface{}{a, b})
+	return fmt.Sprint(values[0]) == fmt.Sprint(values[1])
+}
+
+// repairStatement 生成修复一行差异的 SQL：缺少的行 INSERT，不一致的行只 UPDATE 不同的列，多出的行 DELETE。
+// 多个源库汇总时 UPDATE 和 DELETE 加上 scope，不改动其他源库同一主键的行
+func repairStatement(table string, columns []string, scope string, diff RowDiff) string {
+	where := make([]string, len(diff.PrimaryKey), len(diff.PrimaryKey)+1)
+	for i, col := range diff.PrimaryKey {
+		where[i] = fmt.Sprintf("`%s` = %s", col, sqlLiteral(diff.Key[i]))
+	}
+	if scope != "" {
+		where = append(where, scope)
+	}
+
+	switch diff.Kind {
+	case DiffMissing:
+		values := make([]string, len(columns))
+		for i, col := range columns {
+			values[i] = sqlLiteral(diff.Source[col])
+		}
+		return fmt.Sprintf("INSERT INTO `%s` (%s) VALUES (%s);", table, quoteColumns(columns), strings.Join(values, ", "))
+	case DiffChanged:
+		sets := make([]string, len(diff.Columns))
+		for i, col := range diff.Columns {
+			sets[i] = fmt.Sprintf("`%s` = %s", col, sqlLiteral(diff.Source[col]))
+		}
+		return fmt.Sprintf("UPDATE `%s` SET %s WHERE %s;", table, strings.Join(sets, ", "), strings.Join(where, " AND "))
+	default:
+		return fmt.Sprintf("DELETE FROM `%s` WHERE %s;", table, strings.Join(where, " AND "))
+	}
+}
+
+var sqlStringEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\x00", `\0`, "\n", `\n`, "\r", `\r`, "\x1a", `\Z`)
+
+// sqlLiteral 把列值格式化为 MySQL 字面量，非 UTF-8 的二进制数据使用十六进制
+func sqlLiteral(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if x {
+			return "1"
+		}
+		return "0"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(x)
+	case float32:
+		return strconv.FormatFloat(float64(x), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	case time.Time:
+		return "'" + x.Format("2006-01-02 15:04:05.999999") + "'"
+	case []byte:
+		if !utf8.Valid(x) {
+			return fmt.Sprintf("X'%x'", x)
+		}
+		return "'" + sqlStringEscaper.Replace(string(x)) + "'"
+	case string:
+		return "'" + sqlStringEscaper.Replace(x) + "'"
+	default:
+		return "'" + sqlStringEscaper.Replace(fmt.Sprint(x)) + "'"
+	}
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"strings"
+	"sync/internal/config"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestDiffTable(t *testing.T) {
+	sourceDB, sourceMock := newMockDB(t)
+	targetDB, targetMock := newMockDB(t)
+
+	cfg := &config.Config{}
+	cfg.Sync.BatchSize = 2
+	s := &SyncService{sourceDB: sourceDB, targetDB: targetDB, config: cfg}
+
+	sourceMock.ExpectQuery("INFORMATION_SCHEMA.STATISTICS").WithArgs("user").
+		WillReturnRows(primaryKeyRows("PRIMARY", "id"))
+	sourceMock.ExpectQuery("INFORMATION_SCHEMA.COLUMNS").WithArgs("user").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME"}).AddRow("id").AddRow("name").AddRow("remark"))
+	targetMock.ExpectQuery("INFORMATION_SCHEMA.COLUMNS").WithArgs("user_backup").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME"}).AddRow("id").AddRow("name"))
+
+	// 第一批源表 id 1、2，对应目标表主键范围 (-∞, 2]
+	sourceMock.ExpectQuery("SELECT `id`, `name` FROM `user` ORDER BY `id` LIMIT \\?").WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "alice").AddRow(2, "bob"))
+	targetMock.ExpectQuery("SELECT `id`, `name` FROM `user_backup` WHERE \\(\\(`id` <= \\?\\)\\) ORDER BY `id` LIMIT \\?").
+		WithArgs(int64(2), 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "alice").AddRow(2, "bobby"))
+	targetMock.ExpectQuery("SELECT `id`, `name` FROM `user_backup` WHERE \\(\\(`id` <= \\?\\)\\) AND \\(\\(`id` > \\?\\)\\) ORDER BY `id` LIMIT \\?").
+		WithArgs(int64(2), int64(2), 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+
+	// 第二批源表只有 id 3，源表读完，目标表 (2, +∞) 中剩下的行都是多余的
+	sourceMock.ExpectQuery("SELECT `id`, `name` FROM `user` WHERE \\(\\(`id` > \\?\\)\\) ORDER BY `id` LIMIT \\?").
+		WithArgs(int64(2), 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(3, "carol"))
+	targetMock.ExpectQuery("SELECT `id`, `name` FROM `user_backup` WHERE \\(\\(`id` > \\?\\)\\) ORDER BY `id` LIMIT \\?").
+		WithArgs(int64(2), 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(4, "dave"))
+
+	var reported []string
+	var repair strings.Builder
+	summary, err := s.DiffTable(config.TablePair{Source: "user", Target: "user_backup"}, DiffOptions{
+		Report:    func(diff RowDiff) { reported = append(reported, diff.String()) },
+		RepairSQL: &repair,
+	})
+	if err != nil {
+		t.Fatalf("比较失败: %v", err)
+	}
+
+	if summary.SourceRows != 3 || summary.Missing != 1 || summary.Extra != 1 || summary.Changed != 1 {
+		t.Errorf("统计错误: %+v", summary)
+	}
+	wantReported := "changed id=2 columns=name|extra id=4|missing id=3"
+	if got := strings.Join(reported, "|"); got != wantReported {
+		t.Errorf("差异报告错误:\n期望 %s\n实际 %s", wantReported, got)
+	}
+	wantRepair := "UPDATE `user_backup` SET `name` = 'bob' WHERE `id` = 2;\n" +
+		"DELETE FROM `user_backup` WHERE `id` = 4;\n" +
+		"INSERT INTO `user_backup` (`id`, `name`) VALUES (3, 'carol');\n"
+	if repair.String() != wantRepair {
+		t.Errorf("修复语句错误:\n期望 %s\n实际 %s", wantRepair, repair.String())
+	}
+
+	if err := sourceMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("源库期望未满足: %v", err)
+	}
+	if err := targetMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("目标库期望未满足: %v", err)
+	}
+}
+
+func TestDiffTableWithFilter(t *testing.T) {
+	sourceDB, sourceMock := newMockDB(t)
+	targetDB, targetMock := newMockDB(t)
+
+	cfg := &config.Config{}
+	cfg.Sync.BatchSize = 10
+	s := &SyncService{sourceDB: sourceDB, targetDB: targetDB, config: cfg}
+
+	sourceMock.ExpectQuery("INFORMATION_SCHEMA.STATISTICS").WithArgs("user").
+		WillReturnRows(primaryKeyRows("PRIMARY", "id"))
+	sourceMock.ExpectQuery("INFORMATION_SCHEMA.COLUMNS").WithArgs("user").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME"}).AddRow("id").AddRow("name"))
+	targetMock.ExpectQuery("INFORMATION_SCHEMA.COLUMNS").WithArgs("user_backup").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME"}).AddRow("id").AddRow("name"))
+
+	sourceMock.ExpectQuery("SELECT `id`, `name` FROM `user` WHERE \\(status = 'active'\\) ORDER BY `id` LIMIT \\?").WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "alice"))
+	targetMock.ExpectQuery("SELECT `id`, `name` FROM `user_backup` ORDER BY `id` LIMIT \\?").WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "alice").AddRow(2, "bob").AddRow(3, "carol"))
+
+	// id 2 在源表中仍然存在，只是不满足 filter，不算多出；id 3 已从源表删除
+	sourceMock.ExpectQuery("SELECT `id` FROM `user` WHERE `id` IN \\(\\?, \\?\\)").WithArgs(int64(2), int64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+
+	var reported []string
+	pair := config.TablePair{Source: "user", Target: "user_backup", Filter: "status = 'active'"}
+	summary, err := s.DiffTable(pair, DiffOptions{Report: func(diff RowDiff) { reported = append(reported, diff.String()) }})
+	if err != nil {
+		t.Fatalf("比较失败: %v", err)
+	}
+
+	if summary.SourceRows != 1 || summary.Differences() != 1 || summary.Extra != 1 {
+		t.Errorf("统计错误: %+v", summary)
+	}
+	if got := strings.Join(reported, "|"); got != "extra id=3" {
+		t.Errorf("差异报告错误: %s", got)
+	}
+	if err := sourceMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("源库期望未满足: %v", err)
+	}
+	if err := targetMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("目标库期望未满足: %v", err)
+	}
+}
+
+func TestDiffTableMultiSource(t *testing.T) {
+	sourceDB, sourceMock := newMockDB(t)
+	targetDB, targetMock := newMockDB(t)
+
+	cfg := &config.Config{}
+	cfg.Sync.BatchSize = 10
+	cfg.Sync.Discriminator = "src"
+	s := &SyncService{sourceDB: sourceDB, targetDB: targetDB, config: cfg, source: "east"}
+
+	sourceMock.ExpectQuery("INFORMATION_SCHEMA.STATISTICS").WithArgs("user").
+		WillReturnRows(primaryKeyRows("PRIMARY", "id"))
+	sourceMock.ExpectQuery("INFORMATION_SCHEMA.COLUMNS").WithArgs("user").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME"}).AddRow("id").AddRow("name"))
+	targetMock.ExpectQuery("INFORMATION_SCHEMA.COLUMNS").WithArgs("user_backup").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME"}).AddRow("id").AddRow("name").AddRow("src"))
+
+	sourceMock.ExpectQuery("SELECT `id`, `name`, \\('east'\\) AS `src` FROM `user` ORDER BY `id` LIMIT \\?").WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "src"}).AddRow(1, "alice", "east").AddRow(3, "carol", "east"))
+	// 目标表只读本源库的行
+	targetMock.ExpectQuery("SELECT `id`, `name`, `src` FROM `user_backup` WHERE \\(`src` = 'east'\\) ORDER BY `id` LIMIT \\?").WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "src"}).AddRow(1, "alicia", "east").AddRow(2, "bob", "east"))
+
+	var repair strings.Builder
+	summary, err := s.DiffTable(config.TablePair{Source: "user", Target: "user_backup"}, DiffOptions{RepairSQL: &repair})
+	if err != nil {
+		t.Fatalf("比较失败: %v", err)
+	}
+	if summary.Differences() != 3 {
+		t.Errorf("统计错误: %+v", summary)
+	}
+
+	// 其他源库也可能有 id 1、2 的行，UPDATE 和 DELETE 只能改本源库的行
+	wantRepair := "UPDATE `user_backup` SET `name` = 'alice' WHERE `id` = 1 AND `src` = 'east';\n" +
+		"DELETE FROM `user_backup` WHERE `id` = 2 AND `src` = 'east';\n" +
+		"INSERT INTO `user_backup` (`id`, `name`, `src`) VALUES (3, 'carol', 'east');\n"
+	if repair.String() != wantRepair {
+		t.Errorf("修复语句错误:\n期望 %s\n实际 %s", wantRepair, repair.String())
+	}
+
+	if err := sourceMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("源库期望未满足: %v", err)
+	}
+	if err := targetMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("目标库期望未满足: %v", err)
+	}
+}
+
+func TestSQLLiteral(t *testing.T) {
+	cases := []struct {
+		value interface{}
+		want  string
+	}{
+		{nil, "NULL"},
+		{int64(-5), "-5"},
+		{1.5, "1.5"},
+		{true, "1"},
+		{"it's\n", `'it\'s\n'`},
+		{[]byte("abc"), "'abc'"},
+		{[]byte{0xff, 0x00}, "X'ff00'"},
+		{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), "'2024-01-02 03:04:05'"},
+	}
+	for _, c := range cases {
+		if got := sqlLiteral(c.value); got != c.want {
+			t.Errorf("sqlLiteral(%#v) = %s，期望 %s", c.value, got, c.want)
+		}
+	}
+}
+
+func TestValuesEqual(t *testing.T) {
+	if !valuesEqual([]byte("a"), "a") || !valuesEqual(int64(1), int64(1)) || !valuesEqual(nil, nil) {
+		t.Errorf("相同的值应判断为相等")
+	}
+	if valuesEqual(nil, "") || valuesEqual("a", "b") {
+		t.Errorf("不同的值应判断为不等")
+	}
+}
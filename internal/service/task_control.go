@@ -0,0 +1,201 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"sync/internal/config"
+	"time"
+)
+
+var (
+	ErrTaskNotFound = errors.New("同步任务不存在")
+	ErrTaskRunning  = errors.New("同步任务正在执行")
+	ErrTaskPaused   = errors.New("同步任务已暂停")
+	ErrNotSupported = errors.New("binlog 模式下不支持该操作")
+	ErrStopping     = errors.New("同步服务正在退出")
+)
+
+const redactedPassword = "******"
+
+// TaskStatus 同步任务的状态快照，供管理接口展示
+type TaskStatus struct {
+	Source        string        `json:"source,omitempty"`
+	Target        string        `json:"target,omitempty"`
+	SourceTable   string        `json:"source_table"`
+	TargetTable   string        `json:"target_table"`
+	Status        string        `json:"status"`
+	Paused        bool          `json:"paused"`
+	Running       bool          `json:"running"`
+	LastError     string        `json:"last_error,omitempty"`
+	LastErrorAt   *time.Time    `json:"last_error_at,omitempty"`
+	LastSuccessAt *time.Time    `json:"last_success_at,omitempty"`
+	UpdateTime    *time.Time    `json:"checkpoint_update_time,omitempty"`
+	PrimaryKey    []interface{} `json:"checkpoint_primary_key,omitempty"`
+	Throttle      string        `json:"throttle,omitempty"` // 正在限速等待的原因：源库过载、表或源库的每秒行数上限
+}
+
+// Tasks 返回所有同步任务的状态，按源表名排序
+func (s *SyncService) Tasks() []TaskStatus {
+	s.mutex.RLock()
+	tasks := make([]*SyncTask, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		tasks = append(tasks, task)
+	}
+	s.mutex.RUnlock()
+
+	statuses := make([]TaskStatus, 0, len(tasks))
+	for _, task := range tasks {
+		statuses = append(statuses, task.snapshot())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].SourceTable < statuses[j].SourceTable })
+	return statuses
+}
+
+// TriggerSync 立即在后台同步一张表
+func (s *SyncService) TriggerSync(sourceTable string) error {
+	if s.config.Sync.SyncMode == "binlog" {
+		return ErrNotSupported
+	}
+	if s.stopping() {
+		return ErrStopping
+	}
+	task, err := s.task(sourceTable)
+	if err != nil {
+		return err
+	}
+
+	task.mutex.Lock()
+	defer task.mutex.Unlock()
+	if task.Paused {
+		return ErrTaskPaused
+	}
+	if task.running {
+		return ErrTaskRunning
+	}
+	task.running = true
+	s.inflight.Add(1)
+	go func() {
+		defer s.inflight.Done()
+		s.runTask(task)
+	}()
+	return nil
+}
+
+// PauseTask 暂停一张表的定时同步，正在执行的一轮会跑完
+func (s *SyncService) PauseTask(sourceTable string) error {
+	return s.setPaused(sourceTable, true)
+}
+
+// ResumeTask 恢复一张表的定时同步
+func (s *SyncService) ResumeTask(sourceTable string) error {
+	return s.setPaused(sourceTable, false)
+}
+
+// Config 返回生效的配置，密码和脱敏密钥已隐去
+func (s *SyncService) Config() config.Config {
+	return redactConfig(*s.config)
+}
+
+func redactConfig(cfg config.Config) config.Config {
+	cfg.Database.Source.Password = redactedPassword
+	cfg.Database.Target.Password = redactedPassword
+	sources := make([]config.SourceConfig, len(cfg.Database.Sources))
+	for i, source := range cfg.Database.Sources {
+		source.Password = redactedPassword
+		sources[i] = source
+	}
+	cfg.Database.Sources = sources
+	targets := make([]config.TargetConfig, len(cfg.Database.Targets))
+	for i, target := range cfg.Database.Targets {
+		target.Password = redactedPassword
+		targets[i] = target
+	}
+	cfg.Database.Targets = targets
+	if cfg.Sync.MaskSalt != "" {
+		cfg.Sync.MaskSalt = redactedPassword
+	}
+	return cfg
+}
+
+func (s *SyncService) setPaused(sourceTable string, paused bool) error {
+	if s.config.Sync.SyncMode == "binlog" {
+		return ErrNotSupported
+	}
+	task, err := s.task(sourceTable)
+	if err != nil {
+		return err
+	}
+
+	task.mutex.Lock()
+	task.Paused = paused
+	task.mutex.Unlock()
+	return nil
+}
+
+func (s *SyncService) task(sourceTable string) (*SyncTask, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	task, ok := s.tasks[sourceTable]
+	if !ok {
+		return nil, ErrTaskNotFound
+	}
+	return task, nil
+}
+
+// tryStart 检查任务是否可以开始新一轮同步，可以则标记为执行中
+func (t *SyncTask) tryStart() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.Paused || t.running {
+		return false
+	}
+	t.running = true
+	return true
+}
+
+// runTask 执行一轮同步，调用前任务已被标记为执行中；并发名额用完时排队等待
+func (s *SyncService) runTask(task *SyncTask) {
+	defer func() {
+		task.mutex.Lock()
+		task.running = false
+		task.mutex.Unlock()
+	}()
+
+	if !s.acquireSlot() {
+		return
+	}
+	defer s.releaseSlot()
+
+	task.mutex.Lock()
+	task.Status = "running"
+	task.mutex.Unlock()
+	s.syncTable(task)
+}
+
+func (t *SyncTask) snapshot() TaskStatus {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	return TaskStatus{
+		Source:        t.Source,
+		Target:        t.Target,
+		SourceTable:   t.SourceTable,
+		TargetTable:   t.TargetTable,
+		Status:        t.Status,
+		Paused:        t.Paused,
+		Running:       t.running,
+		LastError:     t.Checkpoint.LastError,
+		LastErrorAt:   timePtr(t.Checkpoint.LastErrorAt),
+		LastSuccessAt: timePtr(t.Checkpoint.LastSuccessAt),
+		UpdateTime:    timePtr(t.Checkpoint.UpdateTime),
+		PrimaryKey:    normalizeKey(t.Checkpoint.PrimaryKey),
+		Throttle:      t.throttle,
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync/internal/config"
+	"testing"
+	"time"
+)
+
+func newControlTestService(mode string) *SyncService {
+	cfg := &config.Config{}
+	cfg.Sync.SyncMode = mode
+	cfg.Database.Source.Password = "source-secret"
+	cfg.Database.Target.Password = "target-secret"
+	return &SyncService{
+		config: cfg,
+		tasks:  map[string]*SyncTask{"user": {SourceTable: "user", TargetTable: "user", Status: "ready"}},
+	}
+}
+
+func TestPauseAndTrigger(t *testing.T) {
+	s := newControlTestService("incremental")
+
+	if err := s.PauseTask("user"); err != nil {
+		t.Fatalf("暂停失败: %v", err)
+	}
+	// 暂停后定时同步跳过该表，不会访问数据库
+	s.syncAll()
+	if !errors.Is(s.TriggerSync("user"), ErrTaskPaused) {
+		t.Errorf("暂停的表不应被手动触发")
+	}
+
+	if err := s.ResumeTask("user"); err != nil {
+		t.Fatalf("恢复失败: %v", err)
+	}
+	s.tasks["user"].running = true
+	if !errors.Is(s.TriggerSync("user"), ErrTaskRunning) {
+		t.Errorf("正在执行的表不应重复触发")
+	}
+	if !errors.Is(s.TriggerSync("missing"), ErrTaskNotFound) {
+		t.Errorf("不存在的表应返回 ErrTaskNotFound")
+	}
+
+	if !errors.Is(newControlTestService("binlog").PauseTask("user"), ErrNotSupported) {
+		t.Errorf("binlog 模式不应支持暂停")
+	}
+}
+
+func TestConfigRedacted(t *testing.T) {
+	s := newControlTestService("incremental")
+	cfg := s.Config()
+	if cfg.Database.Source.Password != redactedPassword || cfg.Database.Target.Password != redactedPassword {
+		t.Errorf("密码未脱敏: %+v", cfg.Database)
+	}
+	if s.config.Database.Source.Password != "source-secret" {
+		t.Errorf("脱敏不应修改生效的配置")
+	}
+}
+
+func TestStartSyncStopsOnCancel(t *testing.T) {
+	s := newControlTestService("incremental")
+	s.config.Sync.Interval = 60
+	s.stopCh = make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.StartSync(ctx) }()
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("退出时不应返回错误: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("取消后 StartSync 未返回")
+	}
+
+	if !errors.Is(s.TriggerSync("user"), ErrStopping) {
+		t.Errorf("退出后不应再接受手动触发")
+	}
+	// 退出后定时同步不再开始新的任务
+	s.syncAll()
+	if s.tasks["user"].running {
+		t.Errorf("退出后不应开始新的同步")
+	}
+}
+
+func TestSleepContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if err := sleepContext(ctx, time.Minute); !errors.Is(err, context.Canceled) {
+		t.Errorf("取消后应返回 context.Canceled，实际 %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("取消后应立即返回")
+	}
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"sync/internal/config"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// sourceThrottle 读取一个源库的限速：按表和所有表合计的每秒行数限速，源库负载过高时暂停读取。
+// 多个目标库的服务共用一个源库时共用同一个 sourceThrottle
+type sourceThrottle struct {
+	config config.ThrottleConfig
+	global *rowLimiter // 为空表示不限制
+
+	mutex    sync.Mutex
+	tables   map[string]*rowLimiter // key: 源表名
+	checked  time.Time              // 上次检查源库负载的时间
+	overload string                 // 上次检查时源库过载的原因，为空表示正常
+}
+
+func newSourceThrottle(cfg config.ThrottleConfig) *sourceThrottle {
+	return &sourceThrottle{config: cfg, global: newRowLimiter(cfg.RowsPerSecond), tables: make(map[string]*rowLimiter)}
+}
+
+// table 返回源表的限速器，rowsPerSecond 为 0 时返回空
+func (t *sourceThrottle) table(name string, rowsPerSecond int) *rowLimiter {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	limiter, ok := t.tables[name]
+	if !ok {
+		limiter = newRowLimiter(rowsPerSecond)
+		t.tables[name] = limiter
+	}
+	return limiter
+}
+
+// rowLimiter 每秒行数的限速器。读到一批行之后按行数预约时间，下一批要等前面预约的时间用完，
+// 一批的行数可以超过每秒的上限，长期的平均速度不超过上限
+type rowLimiter struct {
+	rate  float64 // 每秒行数
+	mutex sync.Mutex
+	next  time.Time // 之前的批次预约到的时间
+}
+
+func newRowLimiter(rowsPerSecond int) *rowLimiter {
+	if rowsPerSecond <= 0 {
+		return nil
+	}
+	return &rowLimiter{rate: float64(rowsPerSecond)}
+}
+
+// reserve 为 rows 行预约时间，返回需要等待的时长
+func (l *rowLimiter) reserve(rows int) time.Duration {
+	if l == nil || rows <= 0 {
+		return 0
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(float64(rows) / l.rate * float64(time.Second)))
+	return wait
+}
+
+// throttleRead 从源表读取 rows 行之后调用：源库负载过高时等到恢复，再按表和源库的每秒行数上限等待。
+// 等待的原因记录在任务状态中；收到退出信号时立即返回，由调用方按正常的退出流程停止
+func (s *SyncService) throttleRead(task *SyncTask, rows int) {
+	if s.throttle == nil || s.dryRun != nil {
+		return
+	}
+	defer task.setThrottle("")
+
+	for {
+		overload := s.throttle.sourceOverload(s.sourceDB)
+		if overload == "" {
+			break
+		}
+		task.setThrottle(overload)
+		if !s.pause(time.Duration(s.throttle.config.CheckInterval) * time.Second) {
+			return
+		}
+	}
+
+	tableLimiter := s.throttle.table(task.SourceTable, s.getTableConfig(task.SourceTable).RowsPerSecond)
+	if wait := tableLimiter.reserve(rows); wait > 0 {
+		task.setThrottle("rows_per_second")
+		if !s.pause(wait) {
+			return
+		}
+	}
+	if wait := s.throttle.global.reserve(rows); wait > 0 {
+		task.setThrottle("sync.throttle.rows_per_second")
+		s.pause(wait)
+	}
+}
+
+// pause 等待 d，收到退出信号时提前返回 false
+func (s *SyncService) pause(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-s.stopCh:
+		return false
+	}
+}
+
+func (t *SyncTask) setThrottle(reason string) {
+	t.mutex.Lock()
+	t.throttle = reason
+	t.mutex.Unlock()
+}
+
+// sourceOverload 返回源库过载的原因，为空表示正常。每隔 check_interval 查询一次，期间使用上次的结果；
+// 查询失败时记录日志并按正常处理，监控出错不影响同步
+func (t *sourceThrottle) sourceOverload(db *gorm.DB) string {
+	if t.config.MaxThreadsRunning <= 0 && t.config.MaxReplicaLag <= 0 {
+		return ""
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if time.Since(t.checked) < time.Duration(t.config.CheckInterval)*time.Second {
+		return t.overload
+	}
+	t.checked = time.Now()
+
+	overload := ""
+	if t.config.MaxThreadsRunning > 0 {
+		running, err := threadsRunning(db)
+		if err != nil {
+			log.Printf("查询源库 Threads_running 失败: %v", err)
+		} else if running > t.config.MaxThreadsRunning {
+			overload = fmt.Sprintf("threads_running %d > %d", running, t.config.MaxThreadsRunning)
+		}
+	}
+	if overload == "" && t.config.MaxReplicaLag > 0 {
+		lag, ok, err := replicaLag(db)
+		if err != nil {
+			log.Printf("查询源库复制延迟失败: %v", err)
+		} else if ok && lag > t.config.MaxReplicaLag {
+			overload = fmt.Sprintf("replica_lag %ds > %ds", lag, t.config.MaxReplicaLag)
+		}
+	}
+
+	if overload != t.overload {
+		if overload != "" {
+			log.Printf("源库负载过高（%s），暂停读取", overload)
+		} else {
+			log.Printf("源库负载恢复，继续读取")
+		}
+	}
+	t.overload = overload
+	return overload
+}
+
+// threadsRunning 查询源库当前正在执行的线程数
+func threadsRunning(db *gorm.DB) (int, error) {
+	var name, value string
+	if err := db.Raw("SHOW GLOBAL STATUS LIKE 'Threads_running'").Row().Scan(&name, &value); err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(value)
+}
+
+// replicaLag 查询源库作为从库的复制延迟（秒），源库不是从库或复制线程没有运行时 ok 为 false。
+// MySQL 8.0.22 之前没有 SHOW REPLICA STATUS，改用 SHOW SLAVE STATUS
+func replicaLag(db *gorm.DB) (lag int, ok bool, err error) {
+	rows, err := db.Raw("SHOW REPLICA STATUS").Rows()
+	if err != nil {
+		if rows, err = db.Raw("SHOW SLAVE STATUS").Rows(); err != nil {
+			return 0, false, err
+		}
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, false, err
+	}
+	if !rows.Next() {
+		return 0, false, rows.Err()
+	}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return 0, false, err
+	}
+	for i, column := range columns {
+		if column != "Seconds_Behind_Source" && column != "Seconds_Behind_Master" {
+			continue
+		}
+		if !values[i].Valid {
+			return 0, false, nil
+		}
+		lag, err := strconv.Atoi(values[i].String)
+		return lag, err == nil, err
+	}
+	return 0, false, nil
+}
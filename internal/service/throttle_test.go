@@ -0,0 +1,66 @@
+package service
+
+import (
+	"errors"
+	"sync/internal/config"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestRowLimiter(t *testing.T) {
+	limiter := newRowLimiter(100)
+	// 第一批不等待，之后每批等前面预约的时间用完，一批可以超过每秒的上限
+	if wait := limiter.reserve(50); wait != 0 {
+		t.Errorf("第一批不应等待: %v", wait)
+	}
+	if wait := limiter.reserve(200); wait < 400*time.Millisecond || wait > 500*time.Millisecond {
+		t.Errorf("第二批应等待约 500ms: %v", wait)
+	}
+	if wait := limiter.reserve(1); wait < 2400*time.Millisecond || wait > 2500*time.Millisecond {
+		t.Errorf("第三批应等待约 2.5s: %v", wait)
+	}
+	if newRowLimiter(0).reserve(1000) != 0 {
+		t.Errorf("没有配置上限时不应等待")
+	}
+}
+
+func TestSourceOverload(t *testing.T) {
+	db, mock := newMockDB(t)
+	throttle := newSourceThrottle(config.ThrottleConfig{MaxThreadsRunning: 40, MaxReplicaLag: 10, CheckInterval: 60})
+
+	statusRows := func(n string) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"Variable_name", "Value"}).AddRow("Threads_running", n)
+	}
+	mock.ExpectQuery("SHOW GLOBAL STATUS LIKE 'Threads_running'").WillReturnRows(statusRows("52"))
+	if got := throttle.sourceOverload(db); got != "threads_running 52 > 40" {
+		t.Errorf("Threads_running 超过阈值时应暂停: %q", got)
+	}
+	// 检查间隔内使用上次的结果，不再查询
+	if got := throttle.sourceOverload(db); got != "threads_running 52 > 40" {
+		t.Errorf("检查间隔内应使用上次的结果: %q", got)
+	}
+
+	// 没有 SHOW REPLICA STATUS 的版本改用 SHOW SLAVE STATUS
+	throttle.checked = time.Time{}
+	mock.ExpectQuery("SHOW GLOBAL STATUS LIKE 'Threads_running'").WillReturnRows(statusRows("3"))
+	mock.ExpectQuery("SHOW REPLICA STATUS").WillReturnError(errors.New("syntax error"))
+	mock.ExpectQuery("SHOW SLAVE STATUS").
+		WillReturnRows(sqlmock.NewRows([]string{"Slave_IO_State", "Seconds_Behind_Master"}).AddRow("Waiting for source", "30"))
+	if got := throttle.sourceOverload(db); got != "replica_lag 30s > 10s" {
+		t.Errorf("复制延迟超过阈值时应暂停: %q", got)
+	}
+
+	// 不是从库时只看 Threads_running
+	throttle.checked = time.Time{}
+	mock.ExpectQuery("SHOW GLOBAL STATUS LIKE 'Threads_running'").WillReturnRows(statusRows("3"))
+	mock.ExpectQuery("SHOW REPLICA STATUS").WillReturnRows(sqlmock.NewRows([]string{"Replica_IO_State", "Seconds_Behind_Source"}))
+	if got := throttle.sourceOverload(db); got != "" {
+		t.Errorf("负载正常时不应暂停: %q", got)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("源库期望未满足: %v", err)
+	}
+}
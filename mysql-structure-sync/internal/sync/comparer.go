@@ -96,6 +96,12 @@ func (c *Comparer) Compare(tableName string) (*SyncPlan, error) {
 		return nil, fmt.Errorf("failed to get target table structure: %w", err)
 	}
 
+	return c.comparePlan(tableName, sourceTable, targetTable), nil
+}
+
+// comparePlan builds the sync plan from the loaded table structures.
+// The output of this command is kept as is, the data sync service uses the rules in the schema package
+func (c *Comparer) comparePlan(tableName string, sourceTable, targetTable *TableModel) *SyncPlan {
 	// Create sync plan
 	plan := &SyncPlan{
 		TableName:   tableName,
@@ -112,7 +118,7 @@ func (c *Comparer) Compare(tableName string) (*SyncPlan, error) {
 	// Compare primary keys
 	c.comparePrimaryKeys(sourceTable, targetTable, plan)
 
-	return plan, nil
+	return plan
 }
 
 // getTableStructure fetches the complete structure of a table
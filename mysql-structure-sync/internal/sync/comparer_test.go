@@ -0,0 +1,94 @@
+package sync
+
+import (
+	"database/sql"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// TestComparePlanGolden keeps the reports and SQL scripts of the compare command unchanged.
+// Each comparison loop produces at most one difference per table, so the output does not
+// depend on map iteration order
+func TestComparePlanGolden(t *testing.T) {
+	c := &Comparer{}
+	user := c.comparePlan("user",
+		&TableModel{
+			Name: "user",
+			Columns: []ColumnModel{
+				{Name: "id", DataType: "int(11)", IsNullable: "NO", ColumnKey: "PRI", Extra: "auto_increment"},
+				{Name: "name", DataType: "varchar(64)", IsNullable: "NO", DefaultValue: sql.NullString{String: "it's", Valid: true}},
+				{Name: "updated_at", DataType: "timestamp", IsNullable: "NO",
+					DefaultValue: sql.NullString{String: "CURRENT_TIMESTAMP", Valid: true},
+					Extra:        "DEFAULT_GENERATED on update CURRENT_TIMESTAMP",
+					OnUpdate:     sql.NullString{String: "CURRENT_TIMESTAMP", Valid: true}},
+			},
+			Indexes:    []IndexModel{{Name: "idx_name", Columns: []string{"name"}, NonUnique: 1, IndexType: "BTREE"}},
+			PrimaryKey: &PrimaryKeyModel{Name: "PRIMARY", Columns: []string{"id"}},
+		},
+		&TableModel{
+			Name: "user",
+			Columns: []ColumnModel{
+				{Name: "id", DataType: "int(11)", IsNullable: "NO", ColumnKey: "PRI", Extra: "auto_increment"},
+				{Name: "updated_at", DataType: "datetime", IsNullable: "YES"},
+			},
+			Indexes:    []IndexModel{{Name: "idx_name", Columns: []string{"id"}, NonUnique: 0, IndexType: "BTREE"}},
+			PrimaryKey: &PrimaryKeyModel{Name: "PRIMARY", Columns: []string{"id", "updated_at"}},
+		})
+	log := c.comparePlan("log",
+		&TableModel{
+			Name:       "log",
+			Columns:    []ColumnModel{{Name: "id", DataType: "bigint(20)", IsNullable: "NO", ColumnKey: "PRI"}},
+			Indexes:    []IndexModel{{Name: "uk_id", Columns: []string{"id"}, NonUnique: 0, IndexType: "BTREE"}},
+			PrimaryKey: &PrimaryKeyModel{Name: "PRIMARY", Columns: []string{"id"}},
+		},
+		&TableModel{
+			Name: "log",
+			Columns: []ColumnModel{
+				{Name: "id", DataType: "bigint(20)", IsNullable: "NO"},
+				{Name: "remark", DataType: "text", IsNullable: "YES"},
+			},
+			Indexes: []IndexModel{{Name: "idx_remark", Columns: []string{"remark"}, NonUnique: 1, IndexType: "FULLTEXT"}},
+		})
+	same := c.comparePlan("tag", &TableModel{Name: "tag"}, &TableModel{Name: "tag"})
+
+	merged := MergedSyncPlan{Tables: []SyncPlan{*user, *same, *log}, TotalTables: 3, Status: "pending"}
+	for _, plan := range merged.Tables {
+		merged.TotalDiffs += len(plan.Differences)
+	}
+
+	dir := t.TempDir()
+	outputs := map[string]func(string) error{
+		"user.json":   user.SaveJSON,
+		"user.sql":    user.SaveSQL,
+		"tag.sql":     same.SaveSQL,
+		"merged.json": merged.SaveJSON,
+		"merged.sql":  merged.SaveSQL,
+	}
+	for name, save := range outputs {
+		if err := save(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("save %s: %v", name, err)
+		}
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		golden := filepath.Join("testdata", name+".golden")
+		if *update {
+			if err := os.WriteFile(golden, got, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("%s differs from %s:\n%s", name, golden, got)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Options adapts the comparison to a target table whose name or columns differ from the source.
+// The zero value compares two tables with the same name and the same columns
+type Options struct {
+	// Table is the target table name used in the generated SQL, the source table name when empty
+	Table string
+	// ColumnName maps a source column to its name in the target table. ok is false for columns
+	// that are not synced: they are neither added nor compared, and indexes using them are skipped.
+	// Nil keeps every column under its own name
+	ColumnName func(source string) (target string, ok bool)
+	// AddOnly lists source columns whose definition is not compared once they exist in the target,
+	// e.g. columns that are masked and intentionally stored with a different type
+	AddOnly map[string]bool
+	// Keep lists columns that only exist in the target table and must not be dropped
+	Keep []string
+	// PrimaryKeySuffix lists target columns that follow the source primary key columns in the
+	// target primary key. They are ignored when comparing and kept when the key is rebuilt; when
+	// either table has no primary key the caller manages the target key and it is left alone
+	PrimaryKeySuffix []string
+}
+
+// Compare returns the differences that bring target in line with source: columns are added and
+// modified first, then the primary key and indexes are fixed, and extra columns are dropped last
+// (MySQL removes a dropped column from its indexes)
+func Compare(source, target *Table, opts Options) []Difference {
+	table := opts.Table
+	if table == "" {
+		table = source.Name
+	}
+	columnName := opts.ColumnName
+	if columnName == nil {
+		columnName = func(source string) (string, bool) { return source, true }
+	}
+	var diffs []Difference
+
+	// Columns are matched by their target name, MySQL column names are case insensitive
+	targets := make(map[string]Column, len(target.Columns))
+	for _, col := range target.Columns {
+		targets[strings.ToLower(col.Name)] = col
+	}
+	expected := make(map[string]bool, len(source.Columns)+len(opts.Keep))
+	for _, col := range source.Columns {
+		name, ok := columnName(col.Name)
+		if !ok {
+			continue
+		}
+		expected[strings.ToLower(name)] = true
+		existing, ok := targets[strings.ToLower(name)]
+		switch {
+		case !ok:
+			diffs = append(diffs, Difference{Type: AddColumn, Name: name,
+				Description: fmt.Sprintf("Add column '%s'", name),
+				SQL:         fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN %s", table, ColumnDefinition(name, col))})
+		case !opts.AddOnly[col.Name] && ColumnsDiffer(col, existing):
+			diffs = append(diffs, Difference{Type: ModifyColumn, Name: name,
+				Description: fmt.Sprintf("Modify column '%s'", name),
+				SQL:         fmt.Sprintf("ALTER TABLE `%s` MODIFY COLUMN %s", table, ColumnDefinition(name, col))})
+		}
+	}
+	for _, name := range opts.Keep {
+		expected[strings.ToLower(name)] = true
+	}
+
+	diffs = append(diffs, comparePrimaryKeys(table, source, target, columnName, opts.PrimaryKeySuffix)...)
+	diffs = append(diffs, compareIndexes(table, source, target, columnName)...)
+
+	for _, col := range target.Columns {
+		if !expected[strings.ToLower(col.Name)] {
+			diffs = append(diffs, Difference{Type: DropColumn, Name: col.Name,
+				Description: fmt.Sprintf("Drop column '%s'", col.Name),
+				SQL:         fmt.Sprintf("ALTER TABLE `%s` DROP COLUMN `%s`", table, col.Name)})
+		}
+	}
+	return diffs
+}
+
+// comparePrimaryKeys compares the source primary key, mapped to target names, with the target's
+func comparePrimaryKeys(table string, source, target *Table, columnName func(string) (string, bool), suffix []string) []Difference {
+	var want, have []string
+	for _, col := range source.PrimaryKey {
+		if name, ok := columnName(col); ok {
+			want = append(want, name)
+		}
+	}
+	inSuffix := make(map[string]bool, len(suffix))
+	for _, col := range suffix {
+		inSuffix[strings.ToLower(col)] = true
+	}
+	for _, col := range target.PrimaryKey {
+		if !inSuffix[strings.ToLower(col)] {
+			have = append(have, col)
+		}
+	}
+	rebuilt := append(append([]string(nil), want...), suffix...)
+
+	switch {
+	case len(suffix) > 0 && (len(want) == 0 || len(target.PrimaryKey) == 0):
+		return nil
+	case len(want) == 0 && len(target.PrimaryKey) > 0:
+		return []Difference{{Type: DropPrimaryKey, Name: "PRIMARY", Description: "Drop primary key",
+			SQL: fmt.Sprintf("ALTER TABLE `%s` DROP PRIMARY KEY", table)}}
+	case len(want) > 0 && len(target.PrimaryKey) == 0:
+		return []Difference{{Type: AddPrimaryKey, Name: "PRIMARY", Description: "Add primary key",
+			SQL: fmt.Sprintf("ALTER TABLE `%s` ADD PRIMARY KEY (%s)", table, quoteColumns(rebuilt))}}
+	case !sameColumns(want, have):
+		return []Difference{{Type: DropPrimaryKey, Name: "PRIMARY", Description: "Rebuild primary key",
+			SQL: fmt.Sprintf("ALTER TABLE `%s` DROP PRIMARY KEY, ADD PRIMARY KEY (%s)", table, quoteColumns(rebuilt))}}
+	}
+	return nil
+}
+
+// compareIndexes compares indexes by name. Source indexes using columns that are not synced are
+// skipped, and a target index with the same name as such a source index is kept
+func compareIndexes(table string, source, target *Table, columnName func(string) (string, bool)) []Difference {
+	var diffs []Difference
+	targets := make(map[string]Index, len(target.Indexes))
+	for _, idx := range target.Indexes {
+		targets[strings.ToLower(idx.Name)] = idx
+	}
+	sourceNames := make(map[string]bool, len(source.Indexes))
+	for _, idx := range source.Indexes {
+		sourceNames[strings.ToLower(idx.Name)] = true
+		want, ok := mapIndex(idx, columnName)
+		if !ok {
+			continue
+		}
+		have, ok := targets[strings.ToLower(idx.Name)]
+		switch {
+		case !ok:
+			diffs = append(diffs, Difference{Type: AddIndex, Name: idx.Name,
+				Description: fmt.Sprintf("Add index '%s'", idx.Name),
+				SQL:         fmt.Sprintf("ALTER TABLE `%s` ADD %s", table, IndexDefinition(want))})
+		case IndexesDiffer(want, have):
+			diffs = append(diffs, Difference{Type: ModifyIndex, Name: idx.Name,
+				Description: fmt.Sprintf("Recreate index '%s'", idx.Name),
+				SQL:         fmt.Sprintf("ALTER TABLE `%s` DROP INDEX `%s`, ADD %s", table, have.Name, IndexDefinition(want))})
+		}
+	}
+	for _, idx := range target.Indexes {
+		if !sourceNames[strings.ToLower(idx.Name)] {
+			diffs = append(diffs, Difference{Type: DropIndex, Name: idx.Name,
+				Description: fmt.Sprintf("Drop index '%s'", idx.Name),
+				SQL:         fmt.Sprintf("ALTER TABLE `%s` DROP INDEX `%s`", table, idx.Name)})
+		}
+	}
+	return diffs
+}
+
+// mapIndex renames the columns of a source index to their target names, ok is false when the
+// index uses a column that is not synced
+func mapIndex(idx Index, columnName func(string) (string, bool)) (Index, bool) {
+	mapped := Index{Name: idx.Name, NonUnique: idx.NonUnique, IndexType: idx.IndexType, Columns: make([]string, len(idx.Columns))}
+	for i, col := range idx.Columns {
+		name, prefix := col, ""
+		if p := strings.IndexByte(col, '('); p >= 0 {
+			name, prefix = col[:p], col[p:]
+		}
+		target, ok := columnName(name)
+		if !ok {
+			return Index{}, false
+		}
+		mapped.Columns[i] = target + prefix
+	}
+	return mapped, true
+}
+
+// integerWidth matches the display width of integer types, which MySQL 8.0.19+ no longer shows
+var integerWidth = regexp.MustCompile(`^(tinyint|smallint|mediumint|int|bigint)\(\d+\)`)
+
+// NormalizeType returns the column type used for comparison: lower case, without the display
+// width of integer types
+func NormalizeType(columnType string) string {
+	return integerWidth.ReplaceAllString(strings.ToLower(columnType), "$1")
+}
+
+// onUpdate returns the ON UPDATE clause in EXTRA, e.g. on update CURRENT_TIMESTAMP(3), or ""
+func onUpdate(extra string) string {
+	if i := strings.Index(strings.ToLower(extra), "on update "); i >= 0 {
+		return extra[i:]
+	}
+	return ""
+}
+
+func autoIncrement(extra string) bool {
+	return strings.Contains(strings.ToLower(extra), "auto_increment")
+}
+
+// ColumnsDiffer reports whether two columns differ in type, nullability, default value,
+// auto increment or ON UPDATE. Comments, character sets and generated columns are not compared
+func ColumnsDiffer(source, target Column) bool {
+	if NormalizeType(source.Type) != NormalizeType(target.Type) ||
+		source.IsNullable != target.IsNullable ||
+		source.Default != target.Default {
+		return true
+	}
+	return autoIncrement(source.Extra) != autoIncrement(target.Extra) ||
+		!strings.EqualFold(onUpdate(source.Extra), onUpdate(target.Extra))
+}
+
+// ColumnDefinition returns the column definition used in ADD COLUMN / MODIFY COLUMN,
+// named name in the target table
+func ColumnDefinition(name string, col Column) string {
+	parts := []string{fmt.Sprintf("`%s` %s", name, col.Type)}
+	if col.IsNullable == "NO" {
+		parts = append(parts, "NOT NULL")
+	} else {
+		parts = append(parts, "NULL")
+	}
+	if col.Default.Valid {
+		parts = append(parts, "DEFAULT "+DefaultValue(col))
+	}
+	if clause := onUpdate(col.Extra); clause != "" {
+		parts = append(parts, clause)
+	}
+	if autoIncrement(col.Extra) {
+		parts = append(parts, "AUTO_INCREMENT")
+	}
+	if col.Comment != "" {
+		parts = append(parts, "COMMENT "+Literal(col.Comment))
+	}
+	return strings.Join(parts, " ")
+}
+
+// DefaultValue returns the expression after DEFAULT. INFORMATION_SCHEMA lists defaults without
+// quotes: CURRENT_TIMESTAMP and MySQL 8 expression defaults (EXTRA contains DEFAULT_GENERATED)
+// are used as is, b'0' of a BIT column is already a literal, everything else is quoted as a string
+func DefaultValue(col Column) string {
+	value := col.Default.String
+	switch {
+	case strings.HasPrefix(strings.ToUpper(value), "CURRENT_TIMESTAMP"):
+		return value
+	case strings.Contains(col.Extra, "DEFAULT_GENERATED"):
+		return "(" + value + ")"
+	case strings.HasPrefix(strings.ToLower(col.Type), "bit") && strings.HasPrefix(value, "b'"):
+		return value
+	}
+	return Literal(value)
+}
+
+// Literal quotes s as a MySQL string literal
+func Literal(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// IndexDefinition returns the index definition used after ADD
+func IndexDefinition(idx Index) string {
+	columns := make([]string, len(idx.Columns))
+	for i, col := range idx.Columns {
+		if p := strings.IndexByte(col, '('); p >= 0 {
+			columns[i] = fmt.Sprintf("`%s`%s", col[:p], col[p:])
+		} else {
+			columns[i] = fmt.Sprintf("`%s`", col)
+		}
+	}
+
+	kind, using := "INDEX", ""
+	switch idx.IndexType {
+	case "FULLTEXT", "SPATIAL":
+		kind = idx.IndexType + " INDEX"
+	default:
+		if !idx.NonUnique {
+			kind = "UNIQUE INDEX"
+		}
+		if idx.IndexType != "" {
+			using = " USING " + idx.IndexType
+		}
+	}
+	return fmt.Sprintf("%s `%s` (%s)%s", kind, idx.Name, strings.Join(columns, ", "), using)
+}
+
+// IndexesDiffer reports whether two indexes differ in uniqueness, type or columns (in order)
+func IndexesDiffer(source, target Index) bool {
+	return source.NonUnique != target.NonUnique || source.IndexType != target.IndexType ||
+		!sameColumns(source.Columns, target.Columns)
+}
+
+// sameColumns reports whether two column lists are equal in order, ignoring case
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func quoteColumns(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = fmt.Sprintf("`%s`", col)
+	}
+	return strings.Join(quoted, ", ")
+}
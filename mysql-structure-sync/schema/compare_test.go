@@ -0,0 +1,95 @@
+package schema
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDefaultValue(t *testing.T) {
+	cases := []struct {
+		col  Column
+		want string
+	}{
+		{Column{Type: "varchar(16)", Default: sql.NullString{String: "a'b\\c", Valid: true}}, "'a\\'b\\\\c'"},
+		{Column{Type: "int", Default: sql.NullString{String: "0", Valid: true}}, "'0'"},
+		{Column{Type: "datetime(3)", Default: sql.NullString{String: "CURRENT_TIMESTAMP(3)", Valid: true}, Extra: "DEFAULT_GENERATED"}, "CURRENT_TIMESTAMP(3)"},
+		{Column{Type: "varchar(36)", Default: sql.NullString{String: "uuid()", Valid: true}, Extra: "DEFAULT_GENERATED"}, "(uuid())"},
+		{Column{Type: "bit(1)", Default: sql.NullString{String: "b'0'", Valid: true}}, "b'0'"},
+	}
+	for _, c := range cases {
+		if got := DefaultValue(c.col); got != c.want {
+			t.Errorf("default %q: expected %s, got %s", c.col.Default.String, c.want, got)
+		}
+	}
+}
+
+func TestCompareOptions(t *testing.T) {
+	source := &Table{
+		Name: "user",
+		Columns: []Column{
+			{Name: "id", Type: "int", IsNullable: "NO", Extra: "auto_increment"},
+			{Name: "name", Type: "varchar(64)", IsNullable: "YES"},
+			{Name: "phone", Type: "varchar(20)", IsNullable: "YES"},
+			{Name: "secret", Type: "varchar(20)", IsNullable: "YES"},
+		},
+		Indexes: []Index{
+			{Name: "idx_name", Columns: []string{"name(10)"}, NonUnique: true, IndexType: "BTREE"},
+			{Name: "idx_secret", Columns: []string{"secret"}, NonUnique: true, IndexType: "BTREE"},
+		},
+		PrimaryKey: []string{"id"},
+	}
+	// name is renamed to user_name, phone is masked and stored as char(11), secret is not synced,
+	// source_db and synced_at only exist in the target
+	target := &Table{
+		Name: "user_backup",
+		Columns: []Column{
+			{Name: "id", Type: "int", IsNullable: "NO", Extra: "auto_increment"},
+			{Name: "phone", Type: "char(11)", IsNullable: "YES"},
+			{Name: "source_db", Type: "varchar(64)", IsNullable: "NO"},
+			{Name: "synced_at", Type: "datetime", IsNullable: "YES"},
+		},
+		Indexes: []Index{
+			{Name: "idx_secret", Columns: []string{"phone"}, NonUnique: true, IndexType: "BTREE"},
+		},
+		PrimaryKey: []string{"id", "source_db"},
+	}
+	opts := Options{
+		Table: "user_backup",
+		ColumnName: func(col string) (string, bool) {
+			switch col {
+			case "name":
+				return "user_name", true
+			case "secret":
+				return "", false
+			}
+			return col, true
+		},
+		AddOnly:          map[string]bool{"phone": true},
+		Keep:             []string{"synced_at", "source_db"},
+		PrimaryKeySuffix: []string{"source_db"},
+	}
+
+	var got []string
+	for _, diff := range Compare(source, target, opts) {
+		got = append(got, diff.SQL)
+	}
+	want := []string{
+		"ALTER TABLE `user_backup` ADD COLUMN `user_name` varchar(64) NULL",
+		"ALTER TABLE `user_backup` ADD INDEX `idx_name` (`user_name`(10)) USING BTREE",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected differences:\n%s", strings.Join(got, "\n"))
+	}
+
+	// Without options the same tables are compared column by column under the source table name
+	var types []DifferenceType
+	for _, diff := range Compare(source, target, Options{}) {
+		types = append(types, diff.Type)
+	}
+	wantTypes := []DifferenceType{AddColumn, ModifyColumn, AddColumn, DropPrimaryKey, AddIndex, ModifyIndex, DropColumn, DropColumn}
+	if !reflect.DeepEqual(types, wantTypes) {
+		t.Errorf("unexpected difference types: %v", types)
+	}
+}
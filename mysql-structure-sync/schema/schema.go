@@ -0,0 +1,146 @@
+// Package schema compares the structure of two MySQL tables and generates the DDL that brings
+// the target table in line with the source. It is used by the data sync service; the rules follow
+// the compare command, with type normalisation, default quoting and prefix/functional index handling
+// added. The compare command keeps its own comparer so that its reports and SQL scripts stay unchanged.
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// DifferenceType represents the type of difference between tables
+type DifferenceType string
+
+const (
+	AddColumn      DifferenceType = "ADD_COLUMN"
+	ModifyColumn   DifferenceType = "MODIFY_COLUMN"
+	DropColumn     DifferenceType = "DROP_COLUMN"
+	AddIndex       DifferenceType = "ADD_INDEX"
+	ModifyIndex    DifferenceType = "MODIFY_INDEX"
+	DropIndex      DifferenceType = "DROP_INDEX"
+	AddPrimaryKey  DifferenceType = "ADD_PRIMARY_KEY"
+	DropPrimaryKey DifferenceType = "DROP_PRIMARY_KEY"
+)
+
+// Difference represents a single structural difference between tables
+type Difference struct {
+	Type        DifferenceType `json:"type"`
+	Name        string         `json:"name"`        // Column or index name, PRIMARY for the primary key
+	Description string         `json:"description"` // Human-readable description
+	SQL         string         `json:"sql"`         // SQL to fix the difference
+}
+
+// Additive reports whether the difference only adds structure to the target table
+// and leaves its existing columns and indexes untouched
+func (d Difference) Additive() bool {
+	return d.Type == AddColumn || d.Type == AddIndex || d.Type == AddPrimaryKey
+}
+
+// Table represents the structure of a MySQL table
+type Table struct {
+	Name       string
+	Columns    []Column // in ordinal position
+	Indexes    []Index  // sorted by name, without the primary key
+	PrimaryKey []string // in index order, empty when the table has no primary key
+}
+
+// Column represents a column as listed in INFORMATION_SCHEMA.COLUMNS
+type Column struct {
+	Name       string
+	Type       string // COLUMN_TYPE, e.g. int(11) unsigned
+	IsNullable string // YES / NO
+	Default    sql.NullString
+	Extra      string
+	Comment    string
+}
+
+// Index represents a secondary index
+type Index struct {
+	Name      string
+	Columns   []string // in index order, prefix parts carry their length, e.g. name(10)
+	NonUnique bool
+	IndexType string // BTREE / HASH / FULLTEXT / SPATIAL
+}
+
+// Queryer is implemented by *sql.DB, *sql.Conn and *sql.Tx
+type Queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// Load reads the structure of a table in the current database of db.
+// Functional indexes have no column names and cannot be recreated on the target, so they are skipped
+func Load(ctx context.Context, db Queryer, tableName string) (*Table, error) {
+	table := &Table{Name: tableName}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE, COLUMN_DEFAULT, EXTRA, COLUMN_COMMENT
+		FROM INFORMATION_SCHEMA.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE()
+		AND TABLE_NAME = ?
+		ORDER BY ORDINAL_POSITION`, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query columns: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var col Column
+		if err := rows.Scan(&col.Name, &col.Type, &col.IsNullable, &col.Default, &col.Extra, &col.Comment); err != nil {
+			return nil, fmt.Errorf("failed to scan column row: %w", err)
+		}
+		table.Columns = append(table.Columns, col)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating column rows: %w", err)
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT INDEX_NAME, COLUMN_NAME, SUB_PART, NON_UNIQUE, INDEX_TYPE
+		FROM INFORMATION_SCHEMA.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE()
+		AND TABLE_NAME = ?
+		ORDER BY INDEX_NAME, SEQ_IN_INDEX`, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query indexes: %w", err)
+	}
+	defer rows.Close()
+
+	functional := make(map[string]bool)
+	var indexes []Index
+	for rows.Next() {
+		var name, indexType string
+		var column sql.NullString
+		var subPart sql.NullInt64
+		var nonUnique int
+		if err := rows.Scan(&name, &column, &subPart, &nonUnique, &indexType); err != nil {
+			return nil, fmt.Errorf("failed to scan index row: %w", err)
+		}
+		if !column.Valid {
+			functional[name] = true
+			continue
+		}
+		if name == "PRIMARY" {
+			table.PrimaryKey = append(table.PrimaryKey, column.String)
+			continue
+		}
+		part := column.String
+		if subPart.Valid {
+			part = fmt.Sprintf("%s(%d)", part, subPart.Int64)
+		}
+		if n := len(indexes); n > 0 && indexes[n-1].Name == name {
+			indexes[n-1].Columns = append(indexes[n-1].Columns, part)
+			continue
+		}
+		indexes = append(indexes, Index{Name: name, Columns: []string{part}, NonUnique: nonUnique == 1, IndexType: indexType})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating index rows: %w", err)
+	}
+	for _, idx := range indexes {
+		if !functional[idx.Name] {
+			table.Indexes = append(table.Indexes, idx)
+		}
+	}
+	return table, nil
+}